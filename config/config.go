@@ -1,9 +1,46 @@
 package config
 
 import (
+	"strings"
+	"time"
+
 	"github.com/spf13/viper"
 )
 
+const DefaultMessageEditWindow = 15 * time.Minute
+
+// Password hashing. New hashes use PasswordHashAlgorithm; stored hashes with
+// another algorithm or weaker parameters are upgraded on the next login.
+const (
+	PasswordHashArgon2id = "argon2id"
+	PasswordHashBcrypt   = "bcrypt"
+
+	DefaultBcryptCost        = 12
+	DefaultArgon2Memory      = 19 * 1024
+	DefaultArgon2Iterations  = 2
+	DefaultArgon2Parallelism = 1
+)
+
+// What users who haven't verified their email address may do.
+const (
+	UnverifiedAllow    = "allow"
+	UnverifiedReadOnly = "read_only"
+	UnverifiedDeny     = "deny"
+)
+
+// OAuthProviderConfig configures one sign-in provider. Providers with an
+// Issuer use OpenID Connect discovery; the others need AuthURL, TokenURL
+// and UserInfoURL and must speak the GitHub user API.
+type OAuthProviderConfig struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	AuthURL      string
+	TokenURL     string
+	UserInfoURL  string
+}
+
 type Config struct {
 	DBHost         string `mapstructure:"POSTGRES_HOST"`
 	DBUserName     string `mapstructure:"POSTGRES_USER"`
@@ -11,8 +48,62 @@ type Config struct {
 	DBName         string `mapstructure:"POSTGRES_DB_NAME"`
 	DBPort         string `mapstructure:"POSTGRES_PORT"`
 
-	JwtAccessSecret  string `mapstructure:"JWT_ACCESS_SECRET"`
 	JwtRefreshSecret string `mapstructure:"JWT_REFRESH_SECRET"`
+
+	// Access tokens are signed with the RS256 or Ed25519 keys in JwtKeysDir
+	// ("./keys" by default), using JwtActiveKID or else the last key by name.
+	JwtKeysDir   string `mapstructure:"JWT_KEYS_DIR"`
+	JwtActiveKID string `mapstructure:"JWT_ACTIVE_KID"`
+
+	// RealtimeBroker is "postgres" (default) or "memory"
+	RealtimeBroker string `mapstructure:"REALTIME_BROKER"`
+
+	// MessageEditWindow is how long after sending a message its author may
+	// edit or delete it, e.g. "15m". Zero means DefaultMessageEditWindow.
+	MessageEditWindow time.Duration `mapstructure:"MESSAGE_EDIT_WINDOW"`
+
+	// PasswordHashAlgorithm is "argon2id" (default) or "bcrypt".
+	// Argon2Memory is in KiB. Zero values mean the defaults above.
+	PasswordHashAlgorithm string `mapstructure:"PASSWORD_HASH_ALGORITHM"`
+	BcryptCost            int    `mapstructure:"BCRYPT_COST"`
+	Argon2Memory          uint32 `mapstructure:"ARGON2_MEMORY"`
+	Argon2Iterations      uint32 `mapstructure:"ARGON2_ITERATIONS"`
+	Argon2Parallelism     uint8  `mapstructure:"ARGON2_PARALLELISM"`
+
+	// AppURL is the frontend base URL used in links sent by email
+	AppURL string `mapstructure:"APP_URL"`
+
+	// UnverifiedEmailPolicy is "allow" (default), "read_only" or "deny"
+	UnverifiedEmailPolicy string `mapstructure:"UNVERIFIED_EMAIL_POLICY"`
+
+	// WebAuthn relying party ID, e.g. "example.com", and the comma
+	// separated origins allowed to use passkeys. Origins default to AppURL.
+	WebAuthnRPID      string `mapstructure:"WEBAUTHN_RP_ID"`
+	WebAuthnRPOrigins string `mapstructure:"WEBAUTHN_RP_ORIGINS"`
+
+	// OAuthProviderNames is a comma separated list of sign-in providers,
+	// e.g. "google,github". Each one is read from OAUTH_<NAME>_CLIENT_ID,
+	// _CLIENT_SECRET, _ISSUER, _SCOPES, _AUTH_URL, _TOKEN_URL and
+	// _USERINFO_URL into OAuthProviders. OAuthRedirectURL is the frontend
+	// callback registered with every provider, by default AppURL + "/oauth/callback".
+	OAuthProviderNames string                         `mapstructure:"OAUTH_PROVIDERS"`
+	OAuthRedirectURL   string                         `mapstructure:"OAUTH_REDIRECT_URL"`
+	OAuthProviders     map[string]OAuthProviderConfig `mapstructure:"-"`
+
+	// AdminEmails is a comma separated list of users who are given the
+	// admin role at startup, to bootstrap role assignment. A user only gets
+	// it once they have verified the address, so nobody can claim it by
+	// registering first.
+	AdminEmails string `mapstructure:"ADMIN_EMAILS"`
+
+	// Mailer is "log" (default), "file" or "smtp"
+	Mailer       string `mapstructure:"MAILER"`
+	MailDir      string `mapstructure:"MAIL_DIR"`
+	MailFrom     string `mapstructure:"MAIL_FROM"`
+	SMTPHost     string `mapstructure:"SMTP_HOST"`
+	SMTPPort     string `mapstructure:"SMTP_PORT"`
+	SMTPUsername string `mapstructure:"SMTP_USERNAME"`
+	SMTPPassword string `mapstructure:"SMTP_PASSWORD"`
 }
 
 func LoadConfig(path string) (config Config, err error) {
@@ -28,5 +119,49 @@ func LoadConfig(path string) (config Config, err error) {
 	}
 
 	err = viper.Unmarshal(&config)
+	if config.MessageEditWindow == 0 {
+		config.MessageEditWindow = DefaultMessageEditWindow
+	}
+	if config.PasswordHashAlgorithm == "" {
+		config.PasswordHashAlgorithm = PasswordHashArgon2id
+	}
+	if config.BcryptCost == 0 {
+		config.BcryptCost = DefaultBcryptCost
+	}
+	if config.Argon2Memory == 0 {
+		config.Argon2Memory = DefaultArgon2Memory
+	}
+	if config.Argon2Iterations == 0 {
+		config.Argon2Iterations = DefaultArgon2Iterations
+	}
+	if config.Argon2Parallelism == 0 {
+		config.Argon2Parallelism = DefaultArgon2Parallelism
+	}
+	if config.OAuthRedirectURL == "" {
+		config.OAuthRedirectURL = strings.TrimSuffix(config.AppURL, "/") + "/oauth/callback"
+	}
+	config.OAuthProviders = loadOAuthProviders(config.OAuthProviderNames)
 	return
 }
+
+func loadOAuthProviders(names string) map[string]OAuthProviderConfig {
+	providers := make(map[string]OAuthProviderConfig)
+	for _, name := range strings.Split(names, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		prefix := "OAUTH_" + strings.ToUpper(name) + "_"
+		providers[name] = OAuthProviderConfig{
+			Issuer:       viper.GetString(prefix + "ISSUER"),
+			ClientID:     viper.GetString(prefix + "CLIENT_ID"),
+			ClientSecret: viper.GetString(prefix + "CLIENT_SECRET"),
+			Scopes:       strings.FieldsFunc(viper.GetString(prefix+"SCOPES"), func(r rune) bool { return r == ',' || r == ' ' }),
+			AuthURL:      viper.GetString(prefix + "AUTH_URL"),
+			TokenURL:     viper.GetString(prefix + "TOKEN_URL"),
+			UserInfoURL:  viper.GetString(prefix + "USERINFO_URL"),
+		}
+	}
+	return providers
+}
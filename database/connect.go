@@ -10,8 +10,7 @@ import (
 	"gorm.io/gorm"
 )
 
-func ConnectDB(config *config.Config) {
-	var err error
+func DSN(config *config.Config) string {
 	p := config.DBPort
 	port, err := strconv.ParseUint(p, 10, 32)
 
@@ -19,7 +18,7 @@ func ConnectDB(config *config.Config) {
 		panic("Failed to parse database port.")
 	}
 
-	dns := fmt.Sprintf(
+	return fmt.Sprintf(
 		"host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
 		config.DBHost,
 		port,
@@ -27,12 +26,49 @@ func ConnectDB(config *config.Config) {
 		config.DBUserPassword,
 		config.DBName,
 	)
+}
+
+func ConnectDB(config *config.Config) {
+	var err error
+	dns := DSN(config)
 	DB, err = gorm.Open(postgres.Open(dns), &gorm.Config{})
 
 	if err != nil {
 		panic("Failed to connect to database!")
 	}
 
-	DB.AutoMigrate(&model.User{})
+	Migrate(DB)
+
+	if err := seedRoles(DB, config.AdminEmails); err != nil {
+		panic(fmt.Sprintf("Failed to seed roles: %s", err))
+	}
 	fmt.Println("✅ Database connected.")
 }
+
+// Migrate creates or updates the tables of every model.
+func Migrate(db *gorm.DB) error {
+	return db.AutoMigrate(
+		&model.Permission{},
+		&model.Role{},
+		&model.User{},
+		&model.Conversation{},
+		&model.ConversationMember{},
+		&model.Message{},
+		&model.MessageRevision{},
+		&model.MessageReaction{},
+		&model.RealtimeEvent{},
+		&model.PresenceConnection{},
+		&model.Session{},
+		&model.RefreshToken{},
+		&model.PasswordResetToken{},
+		&model.EmailVerificationToken{},
+		&model.EmailChangeToken{},
+		&model.MagicLinkToken{},
+		&model.RecoveryCode{},
+		&model.Passkey{},
+		&model.PasskeyCeremony{},
+		&model.LoginThrottle{},
+		&model.Identity{},
+		&model.OAuthFlow{},
+	)
+}
@@ -0,0 +1,60 @@
+package database
+
+import (
+	"strings"
+
+	"github.com/kazimovzaman2/Go-jwt-gorm/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// seedRoles makes sure every permission exists and the admin role holds
+// all of them, then gives that role to the users listed in adminEmails
+// who have verified their address. It is safe to run on every start.
+func seedRoles(db *gorm.DB, adminEmails string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		permissions := make([]model.Permission, 0, len(model.AllPermissions))
+		for name, description := range model.AllPermissions {
+			permissions = append(permissions, model.Permission{Name: name, Description: description})
+		}
+		err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "name"}},
+			DoUpdates: clause.AssignmentColumns([]string{"description"}),
+		}).Create(&permissions).Error
+		if err != nil {
+			return err
+		}
+
+		admin := model.Role{Name: model.RoleAdmin, Description: "Full access"}
+		err = tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&admin).Error
+		if err == nil {
+			err = tx.Where("name = ?", model.RoleAdmin).First(&admin).Error
+		}
+		if err != nil {
+			return err
+		}
+
+		err = tx.Exec(
+			"INSERT INTO role_permissions (role_id, permission_id) SELECT ?, id FROM permissions ON CONFLICT DO NOTHING",
+			admin.ID,
+		).Error
+		if err != nil {
+			return err
+		}
+
+		var emails []string
+		for _, email := range strings.Split(adminEmails, ",") {
+			if email = strings.TrimSpace(email); email != "" {
+				emails = append(emails, email)
+			}
+		}
+		if len(emails) == 0 {
+			return nil
+		}
+
+		return tx.Exec(
+			"INSERT INTO user_roles (user_id, role_id) SELECT id, ? FROM users WHERE email IN ? AND email_verified_at IS NOT NULL ON CONFLICT DO NOTHING",
+			admin.ID, emails,
+		).Error
+	})
+}
@@ -0,0 +1,83 @@
+package database
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/kazimovzaman2/Go-jwt-gorm/model"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// openTestDB opens the database named by TEST_DATABASE_DSN and skips the
+// test without one.
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN is not set")
+	}
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func testEmail(t *testing.T) string {
+	t.Helper()
+
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatal(err)
+	}
+	return hex.EncodeToString(b) + "@example.com"
+}
+
+func TestSeedRolesOnlyPromotesVerifiedAddresses(t *testing.T) {
+	db := openTestDB(t)
+
+	now := time.Now()
+	verified := model.User{Email: testEmail(t), FirstName: "Ada", LastName: "Lovelace", EmailVerifiedAt: &now}
+	unverified := model.User{Email: testEmail(t), FirstName: "Mallory", LastName: "Smith"}
+	for _, user := range []*model.User{&verified, &unverified} {
+		if err := db.Create(user).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := seedRoles(db, verified.Email+", "+unverified.Email); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		user      model.User
+		wantAdmin bool
+	}{
+		{"verified address", verified, true},
+		// Anyone could have registered it before the operator.
+		{"unverified address", unverified, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var roles []model.Role
+			if err := db.Model(&tt.user).Association("Roles").Find(&roles); err != nil {
+				t.Fatal(err)
+			}
+			isAdmin := len(roles) == 1 && roles[0].Name == model.RoleAdmin
+			if isAdmin != tt.wantAdmin {
+				t.Fatalf("user has roles %v, want admin: %v", roles, tt.wantAdmin)
+			}
+		})
+	}
+}
@@ -0,0 +1,550 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/kazimovzaman2/Go-jwt-gorm/database"
+	"github.com/kazimovzaman2/Go-jwt-gorm/middleware"
+	"github.com/kazimovzaman2/Go-jwt-gorm/model"
+	"github.com/kazimovzaman2/Go-jwt-gorm/utils"
+	"github.com/kazimovzaman2/Go-jwt-gorm/validation"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	defaultAdminPageSize = 50
+	maxAdminPageSize     = 200
+)
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+var errLastAdmin = errors.New("last admin")
+
+// loadTargetUser resolves the :id user an admin acts on, with their roles.
+// Admins can't act on themselves here, so they can't lock themselves out,
+// nor on users holding every permission they hold, so moderators can't act
+// on each other or on admins. On failure it returns the status and body to
+// respond with.
+func loadTargetUser(c *fiber.Ctx, db *gorm.DB) (model.User, int, *model.ErrorResponse) {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return model.User{}, fiber.StatusBadRequest, &model.ErrorResponse{
+			Status:  "error",
+			Message: "Invalid user ID",
+			Errors:  err.Error(),
+		}
+	}
+
+	actor := middleware.CurrentUser(c)
+	if uint(id) == actor.ID {
+		return model.User{}, fiber.StatusBadRequest, &model.ErrorResponse{
+			Status:  "error",
+			Message: "Use your own account settings for this",
+			Errors:  "Can't act on yourself",
+		}
+	}
+
+	var user model.User
+	if err := db.Preload("Roles").First(&user, id).Error; err != nil {
+		return model.User{}, fiber.StatusNotFound, &model.ErrorResponse{
+			Status:  "error",
+			Message: "User not found",
+			Errors:  err.Error(),
+		}
+	}
+
+	actorPermissions, err := middleware.UserPermissions(db, actor.ID)
+	if err != nil {
+		return model.User{}, fiber.StatusInternalServerError, &model.ErrorResponse{
+			Status:  "error",
+			Message: "Couldn't check permissions",
+			Errors:  err.Error(),
+		}
+	}
+	userPermissions, err := middleware.UserPermissions(db, user.ID)
+	if err != nil {
+		return model.User{}, fiber.StatusInternalServerError, &model.ErrorResponse{
+			Status:  "error",
+			Message: "Couldn't check permissions",
+			Errors:  err.Error(),
+		}
+	}
+	if !outranks(actorPermissions, userPermissions) {
+		return model.User{}, fiber.StatusForbidden, &model.ErrorResponse{
+			Status:  "error",
+			Message: "You can't act on users with the same or more permissions than you",
+			Errors:  "Insufficient rank",
+		}
+	}
+	return user, 0, nil
+}
+
+// outranks reports whether actor holds every permission in target and at
+// least one more.
+func outranks(actor, target map[string]bool) bool {
+	if len(target) >= len(actor) {
+		return false
+	}
+	for permission := range target {
+		if !actor[permission] {
+			return false
+		}
+	}
+	return true
+}
+
+// checkNotLastAdmin returns errLastAdmin when the user is an admin and no
+// other active user is. Admins hold every permission, so none outranks
+// another and only the last admin themselves can drop the role. Call it in
+// the transaction that does: the admin role stays locked until the end,
+// so two admins leaving at once can't each count on the other.
+func checkNotLastAdmin(tx *gorm.DB, userID uint) error {
+	var admin model.Role
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("name = ?", model.RoleAdmin).Limit(1).Find(&admin).Error
+	if err != nil || admin.ID == 0 {
+		return err
+	}
+
+	var isAdmin int64
+	err = tx.Table("user_roles").Where("user_id = ? AND role_id = ?", userID, admin.ID).Count(&isAdmin).Error
+	if err != nil || isAdmin == 0 {
+		return err
+	}
+
+	var others int64
+	err = tx.Raw(`
+		SELECT COUNT(*)
+		FROM user_roles ur
+		JOIN users u ON u.id = ur.user_id
+		WHERE ur.role_id = ? AND ur.user_id <> ? AND u.deleted_at IS NULL AND u.suspended_at IS NULL`,
+		admin.ID, userID,
+	).Scan(&others).Error
+	if err != nil {
+		return err
+	}
+	if others == 0 {
+		return errLastAdmin
+	}
+	return nil
+}
+
+// AdminListUsers is a handler to list and search users
+// @Summary List users
+// @Description List all users, newest first, optionally filtered by a search on email and name or by suspension. Requires the users.read permission.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param q query string false "Search in email, first and last name"
+// @Param suspended query bool false "Only suspended (true) or active (false) users"
+// @Param before query int false "Return users with an ID lower than this cursor"
+// @Param limit query int false "Page size (default 50, max 200)"
+// @Success 200 {object} model.SuccessResponse{data=model.AdminUserPageResponse}
+// @Failure 403 {object} model.ErrorResponse
+// @Failure 500 {object} model.ErrorResponse
+// @Router /admin/users/ [get]
+func AdminListUsers(c *fiber.Ctx) error {
+	db := database.DB
+
+	limit := c.QueryInt("limit", defaultAdminPageSize)
+	if limit < 1 || limit > maxAdminPageSize {
+		limit = defaultAdminPageSize
+	}
+	before := c.QueryInt("before", 0)
+
+	query := db.Preload("Roles")
+	if before > 0 {
+		query = query.Where("id < ?", before)
+	}
+	if search := strings.TrimSpace(c.Query("q")); search != "" {
+		pattern := "%" + likeEscaper.Replace(search) + "%"
+		query = query.Where("email ILIKE ? OR first_name ILIKE ? OR last_name ILIKE ?", pattern, pattern, pattern)
+	}
+	switch c.Query("suspended") {
+	case "true":
+		query = query.Where("suspended_at IS NOT NULL")
+	case "false":
+		query = query.Where("suspended_at IS NULL")
+	}
+
+	var users []model.User
+	if err := query.Order("id DESC").Limit(limit).Find(&users).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Couldn't load users",
+			Errors:  err.Error(),
+		})
+	}
+
+	responseData := model.AdminUserPageResponse{
+		Users: make([]model.AdminUserResponse, 0, len(users)),
+	}
+	for _, user := range users {
+		responseData.Users = append(responseData.Users, utils.AdminUserToResponse(user))
+	}
+	if len(users) == limit {
+		responseData.NextCursor = users[len(users)-1].ID
+	}
+
+	return c.Status(fiber.StatusOK).JSON(model.SuccessResponse{
+		Status:  "success",
+		Message: "Users",
+		Data:    responseData,
+	})
+}
+
+// SuspendUser is a handler to suspend a user
+// @Summary Suspend a user
+// @Description Suspend a user. They are signed out everywhere and can't log in until unsuspended. Requires the users.suspend permission.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "User ID"
+// @Success 200 {object} model.SuccessResponse{data=model.AdminUserResponse}
+// @Failure 400 {object} model.ErrorResponse
+// @Failure 403 {object} model.ErrorResponse
+// @Failure 404 {object} model.ErrorResponse
+// @Failure 500 {object} model.ErrorResponse
+// @Router /admin/users/{id}/suspend/ [post]
+func SuspendUser(c *fiber.Ctx) error {
+	db := database.DB
+
+	user, status, errResp := loadTargetUser(c, db)
+	if errResp != nil {
+		return c.Status(status).JSON(errResp)
+	}
+
+	if user.SuspendedAt == nil {
+		now := time.Now()
+		user.SuspendedAt = &now
+		var revoked []string
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&user).UpdateColumn("suspended_at", now).Error; err != nil {
+				return err
+			}
+			var err error
+			revoked, err = revokeSessions(tx, "user_id = ?", user.ID)
+			return err
+		})
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+				Status:  "error",
+				Message: "Couldn't suspend user",
+				Errors:  err.Error(),
+			})
+		}
+		closeSessionSockets(revoked)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(model.SuccessResponse{
+		Status:  "success",
+		Message: "User suspended",
+		Data:    utils.AdminUserToResponse(user),
+	})
+}
+
+// UnsuspendUser is a handler to lift the suspension of a user
+// @Summary Unsuspend a user
+// @Description Let a suspended user log in again. Requires the users.suspend permission.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "User ID"
+// @Success 200 {object} model.SuccessResponse{data=model.AdminUserResponse}
+// @Failure 400 {object} model.ErrorResponse
+// @Failure 403 {object} model.ErrorResponse
+// @Failure 404 {object} model.ErrorResponse
+// @Failure 500 {object} model.ErrorResponse
+// @Router /admin/users/{id}/unsuspend/ [post]
+func UnsuspendUser(c *fiber.Ctx) error {
+	db := database.DB
+
+	user, status, errResp := loadTargetUser(c, db)
+	if errResp != nil {
+		return c.Status(status).JSON(errResp)
+	}
+
+	if err := db.Model(&user).UpdateColumn("suspended_at", nil).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Couldn't unsuspend user",
+			Errors:  err.Error(),
+		})
+	}
+	user.SuspendedAt = nil
+
+	return c.Status(fiber.StatusOK).JSON(model.SuccessResponse{
+		Status:  "success",
+		Message: "User unsuspended",
+		Data:    utils.AdminUserToResponse(user),
+	})
+}
+
+// AdminDeleteUser is a handler to delete a user
+// @Summary Delete a user
+// @Description Delete a user and everything they own. Requires the users.delete permission.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "User ID"
+// @Success 200 {object} model.SuccessResponse
+// @Failure 400 {object} model.ErrorResponse
+// @Failure 403 {object} model.ErrorResponse
+// @Failure 404 {object} model.ErrorResponse
+// @Failure 500 {object} model.ErrorResponse
+// @Router /admin/users/{id}/ [delete]
+func AdminDeleteUser(c *fiber.Ctx) error {
+	db := database.DB
+
+	user, status, errResp := loadTargetUser(c, db)
+	if errResp != nil {
+		return c.Status(status).JSON(errResp)
+	}
+
+	// Sessions go with the user; revoking them first tells us which
+	// sockets to close.
+	var revoked []string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if revoked, err = revokeSessions(tx, "user_id = ?", user.ID); err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(&user).Error
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Couldn't delete user",
+			Errors:  err.Error(),
+		})
+	}
+	closeSessionSockets(revoked)
+
+	// The user is gone either way, so a leftover image is only logged.
+	if user.ProfileImage != "" {
+		filename := filepath.Base(user.ProfileImage)
+		if err := os.Remove(filepath.Join("./media/avatars", filename)); err != nil && !os.IsNotExist(err) {
+			log.Printf("Failed to delete profile image of user %d: %s", user.ID, err)
+		}
+	}
+
+	return c.Status(fiber.StatusOK).JSON(model.SuccessResponse{
+		Status:  "success",
+		Message: "User deleted",
+		Data:    nil,
+	})
+}
+
+// ForcePasswordReset is a handler to make a user choose a new password
+// @Summary Force a password reset
+// @Description Clear a user's password, sign them out everywhere and email them a reset link. Every login method is refused until they set a new password through it. Requires the users.reset_password permission.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "User ID"
+// @Success 200 {object} model.SuccessResponse
+// @Failure 400 {object} model.ErrorResponse
+// @Failure 403 {object} model.ErrorResponse
+// @Failure 404 {object} model.ErrorResponse
+// @Failure 500 {object} model.ErrorResponse
+// @Router /admin/users/{id}/reset-password/ [post]
+func ForcePasswordReset(c *fiber.Ctx) error {
+	db := database.DB
+
+	user, status, errResp := loadTargetUser(c, db)
+	if errResp != nil {
+		return c.Status(status).JSON(errResp)
+	}
+
+	// An empty hash matches no password, and the flag keeps magic links,
+	// passkeys and providers shut too, so only the emailed link gets the
+	// user back in.
+	var revoked []string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&user).UpdateColumns(map[string]interface{}{
+			"password":                "",
+			"password_reset_required": true,
+		}).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Model(&model.PasswordResetToken{}).
+			Where("user_id = ? AND used_at IS NULL", user.ID).
+			Update("used_at", time.Now()).Error
+		if err != nil {
+			return err
+		}
+		revoked, err = revokeSessions(tx, "user_id = ?", user.ID)
+		return err
+	})
+	if err == nil {
+		closeSessionSockets(revoked)
+		err = sendPasswordResetEmail(db, user, true)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Couldn't reset password",
+			Errors:  err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(model.SuccessResponse{
+		Status:  "success",
+		Message: "Password reset, a link has been sent to the user",
+		Data:    nil,
+	})
+}
+
+// GetRoles is a handler to list the roles that can be assigned
+// @Summary List roles
+// @Description List every role with its permissions. Requires the roles.assign permission.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} model.SuccessResponse{data=[]model.RoleResponse}
+// @Failure 403 {object} model.ErrorResponse
+// @Failure 500 {object} model.ErrorResponse
+// @Router /admin/roles/ [get]
+func GetRoles(c *fiber.Ctx) error {
+	db := database.DB
+
+	var roles []model.Role
+	if err := db.Preload("Permissions").Order("name").Find(&roles).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Couldn't load roles",
+			Errors:  err.Error(),
+		})
+	}
+
+	responseData := make([]model.RoleResponse, 0, len(roles))
+	for _, role := range roles {
+		responseData = append(responseData, utils.RoleToResponse(role))
+	}
+
+	return c.Status(fiber.StatusOK).JSON(model.SuccessResponse{
+		Status:  "success",
+		Message: "Roles",
+		Data:    responseData,
+	})
+}
+
+// AssignRoles is a handler to set the roles of a user
+// @Summary Assign roles
+// @Description Replace the roles of a user with the given ones. Only roles whose permissions the caller holds can be assigned, and only to users with fewer permissions than the caller, so admins can't change each other's roles. Requires the roles.assign permission.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "User ID"
+// @Param input body model.AssignRolesInput true "Role names"
+// @Success 200 {object} model.SuccessResponse{data=model.AdminUserResponse}
+// @Failure 400 {object} model.ErrorResponse
+// @Failure 403 {object} model.ErrorResponse
+// @Failure 404 {object} model.ErrorResponse
+// @Failure 500 {object} model.ErrorResponse
+// @Router /admin/users/{id}/roles/ [put]
+func AssignRoles(c *fiber.Ctx) error {
+	db := database.DB
+
+	user, status, errResp := loadTargetUser(c, db)
+	if errResp != nil {
+		return c.Status(status).JSON(errResp)
+	}
+
+	var input model.AssignRolesInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Invalid input",
+			Errors:  err.Error(),
+		})
+	}
+
+	validationErrors := validation.ValidateStruct(&input)
+	if len(validationErrors) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(validationErrors)
+	}
+
+	var roles []model.Role
+	if err := db.Preload("Permissions").Where("name IN ?", input.Roles).Order("name").Find(&roles).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Couldn't assign roles",
+			Errors:  err.Error(),
+		})
+	}
+	found := make(map[string]bool, len(roles))
+	for _, role := range roles {
+		found[role.Name] = true
+	}
+	for _, name := range input.Roles {
+		if !found[name] {
+			return c.Status(fiber.StatusBadRequest).JSON(model.ErrorResponse{
+				Status:  "error",
+				Message: "Unknown role " + name,
+				Errors:  "Role not found",
+			})
+		}
+	}
+
+	// Nobody can hand out more than they hold.
+	actorPermissions, err := middleware.UserPermissions(db, middleware.CurrentUser(c).ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Couldn't check permissions",
+			Errors:  err.Error(),
+		})
+	}
+	for _, role := range roles {
+		for _, permission := range role.Permissions {
+			if !actorPermissions[permission.Name] {
+				return c.Status(fiber.StatusForbidden).JSON(model.ErrorResponse{
+					Status:  "error",
+					Message: "You can't assign the role " + role.Name + ", it has permissions you don't hold",
+					Errors:  "Insufficient rank",
+				})
+			}
+		}
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM user_roles WHERE user_id = ?", user.ID).Error; err != nil {
+			return err
+		}
+		for _, role := range roles {
+			if err := tx.Exec("INSERT INTO user_roles (user_id, role_id) VALUES (?, ?)", user.ID, role.ID).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Couldn't assign roles",
+			Errors:  err.Error(),
+		})
+	}
+	user.Roles = roles
+
+	return c.Status(fiber.StatusOK).JSON(model.SuccessResponse{
+		Status:  "success",
+		Message: "Roles assigned",
+		Data:    utils.AdminUserToResponse(user),
+	})
+}
@@ -0,0 +1,247 @@
+package handler
+
+import (
+	"fmt"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/kazimovzaman2/Go-jwt-gorm/database"
+	"github.com/kazimovzaman2/Go-jwt-gorm/model"
+	"gorm.io/gorm"
+)
+
+var resetLinkToken = regexp.MustCompile(`reset-password\?token=(\S+)`)
+
+func TestForcePasswordResetBlocksEveryLogin(t *testing.T) {
+	o := newOAuthTest(t)
+	messages := setupTestMailer(t)
+
+	admin := o.createUser(testID(t) + "@example.com")
+	grantPermissions(t, o.db, admin, model.PermissionUsersResetPassword)
+	o.app.Post("/api/admin/users/:id/reset-password/", asUser(admin), ForcePasswordReset)
+	o.app.Post("/api/password/reset/confirm/", ConfirmPasswordReset)
+
+	account := o.account(true)
+	expectLoggedIn(t, o.login(account))
+	userID := o.identityUser(account)
+
+	response := request(t, o.app, fiber.MethodPost, fmt.Sprintf("/api/admin/users/%d/reset-password/", userID), nil)
+	if response.status != fiber.StatusOK {
+		t.Fatalf("forcing a reset returned status %d", response.status)
+	}
+
+	// The provider still vouches for the user, but that's not enough now.
+	if response := o.login(account); response.status != fiber.StatusForbidden {
+		t.Fatalf("login after a forced reset returned status %d, want %d", response.status, fiber.StatusForbidden)
+	}
+
+	match := resetLinkToken.FindStringSubmatch(messages.next(t, account.Email).Body)
+	if match == nil {
+		t.Fatal("reset email has no link")
+	}
+	response = request(t, o.app, fiber.MethodPost, "/api/password/reset/confirm/", model.PasswordResetConfirmInput{
+		Token:    match[1],
+		Password: "a new password",
+	})
+	if response.status != fiber.StatusOK {
+		t.Fatalf("confirming the reset returned status %d", response.status)
+	}
+
+	expectLoggedIn(t, o.login(account))
+}
+
+// grantPermissions gives user a new role holding permissions.
+func grantPermissions(t *testing.T, db *gorm.DB, user model.User, permissions ...string) model.Role {
+	t.Helper()
+
+	role := model.Role{Name: "test-" + testID(t), Description: "Test role"}
+	for _, name := range permissions {
+		var permission model.Permission
+		err := db.Where(model.Permission{Name: name}).
+			Attrs(model.Permission{Description: model.AllPermissions[name]}).
+			FirstOrCreate(&permission).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+		role.Permissions = append(role.Permissions, permission)
+	}
+	if err := db.Create(&role).Error; err != nil {
+		t.Fatal(err)
+	}
+	giveRole(t, db, user, role)
+	return role
+}
+
+// makeAdmin gives user the admin role, creating it if need be.
+func makeAdmin(t *testing.T, db *gorm.DB, user model.User) model.Role {
+	t.Helper()
+
+	role := model.Role{Name: model.RoleAdmin}
+	if err := db.Where(role).Attrs(model.Role{Description: "Full access"}).FirstOrCreate(&role).Error; err != nil {
+		t.Fatal(err)
+	}
+	for name, description := range model.AllPermissions {
+		permission := model.Permission{Name: name}
+		if err := db.Where(permission).Attrs(model.Permission{Description: description}).FirstOrCreate(&permission).Error; err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Model(&role).Association("Permissions").Append(&permission); err != nil {
+			t.Fatal(err)
+		}
+	}
+	giveRole(t, db, user, role)
+	return role
+}
+
+func giveRole(t *testing.T, db *gorm.DB, user model.User, role model.Role) {
+	t.Helper()
+
+	if err := db.Exec("INSERT INTO user_roles (user_id, role_id) VALUES (?, ?)", user.ID, role.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAdminActionsNeedHigherRank(t *testing.T) {
+	tests := []struct {
+		name   string
+		actor  []string
+		target []string
+		admin  bool
+		want   int
+	}{
+		{"user without permissions", []string{model.PermissionUsersSuspend}, nil, false, fiber.StatusOK},
+		{"user with fewer permissions", []string{model.PermissionUsersSuspend, model.PermissionUsersRead}, []string{model.PermissionUsersRead}, false, fiber.StatusOK},
+		{"user with the same permissions", []string{model.PermissionUsersSuspend}, []string{model.PermissionUsersSuspend}, false, fiber.StatusForbidden},
+		{"user with other permissions", []string{model.PermissionUsersSuspend, model.PermissionUsersRead}, []string{model.PermissionUsersDelete}, false, fiber.StatusForbidden},
+		{"admin", []string{model.PermissionUsersSuspend}, nil, true, fiber.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := setupTestDB(t)
+
+			actor := model.User{Email: testID(t) + "@example.com", FirstName: "Actor"}
+			target := model.User{Email: testID(t) + "@example.com", FirstName: "Target"}
+			if err := db.Create(&actor).Error; err != nil {
+				t.Fatal(err)
+			}
+			if err := db.Create(&target).Error; err != nil {
+				t.Fatal(err)
+			}
+			grantPermissions(t, db, actor, tt.actor...)
+			if len(tt.target) > 0 {
+				grantPermissions(t, db, target, tt.target...)
+			}
+			if tt.admin {
+				makeAdmin(t, db, target)
+			}
+
+			app := fiber.New()
+			app.Post("/api/admin/users/:id/suspend/", asUser(actor), SuspendUser)
+
+			response := request(t, app, fiber.MethodPost, fmt.Sprintf("/api/admin/users/%d/suspend/", target.ID), nil)
+			if response.status != tt.want {
+				t.Fatalf("suspend returned status %d, want %d", response.status, tt.want)
+			}
+		})
+	}
+}
+
+func TestAssignRolesOnlyHandsOutHeldPermissions(t *testing.T) {
+	db := setupTestDB(t)
+
+	actor := model.User{Email: testID(t) + "@example.com", FirstName: "Actor"}
+	target := model.User{Email: testID(t) + "@example.com", FirstName: "Target"}
+	other := model.User{Email: testID(t) + "@example.com", FirstName: "Other"}
+	for _, user := range []*model.User{&actor, &target, &other} {
+		if err := db.Create(user).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	grantPermissions(t, db, actor, model.PermissionRolesAssign, model.PermissionUsersRead)
+	reader := grantPermissions(t, db, other, model.PermissionUsersRead)
+	deleter := grantPermissions(t, db, other, model.PermissionUsersDelete)
+
+	app := fiber.New()
+	app.Put("/api/admin/users/:id/roles/", asUser(actor), AssignRoles)
+	path := fmt.Sprintf("/api/admin/users/%d/roles/", target.ID)
+
+	response := request(t, app, fiber.MethodPut, path, model.AssignRolesInput{Roles: []string{reader.Name}})
+	if response.status != fiber.StatusOK {
+		t.Fatalf("assigning a role with held permissions returned status %d", response.status)
+	}
+	response = request(t, app, fiber.MethodPut, path, model.AssignRolesInput{Roles: []string{deleter.Name}})
+	if response.status != fiber.StatusForbidden {
+		t.Fatalf("assigning a role with other permissions returned status %d, want %d", response.status, fiber.StatusForbidden)
+	}
+}
+
+func TestLastAdminStays(t *testing.T) {
+	tests := []struct {
+		name  string
+		other string
+		want  int
+	}{
+		{"only admin", "", fiber.StatusBadRequest},
+		{"another admin", "active", fiber.StatusOK},
+		// A suspended admin can't step in.
+		{"suspended other admin", "suspended", fiber.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := setupTestDB(t)
+
+			// Other tests leave admins behind, so work on a database
+			// without them.
+			tx := db.Begin()
+			t.Cleanup(func() { tx.Rollback() })
+			database.DB = tx
+
+			admin := model.User{Email: testID(t) + "@example.com", FirstName: "Admin"}
+			if err := tx.Create(&admin).Error; err != nil {
+				t.Fatal(err)
+			}
+			role := makeAdmin(t, tx, admin)
+			if err := tx.Exec("DELETE FROM user_roles WHERE role_id = ? AND user_id <> ?", role.ID, admin.ID).Error; err != nil {
+				t.Fatal(err)
+			}
+			if tt.other != "" {
+				other := model.User{Email: testID(t) + "@example.com", FirstName: "Other"}
+				if tt.other == "suspended" {
+					now := time.Now()
+					other.SuspendedAt = &now
+				}
+				if err := tx.Create(&other).Error; err != nil {
+					t.Fatal(err)
+				}
+				giveRole(t, tx, other, role)
+
+				// Neither admin outranks the other, so only they can
+				// give up the role themselves.
+				app := fiber.New()
+				app.Put("/api/admin/users/:id/roles/", asUser(admin), AssignRoles)
+				path := fmt.Sprintf("/api/admin/users/%d/roles/", other.ID)
+				if response := request(t, app, fiber.MethodPut, path, model.AssignRolesInput{Roles: []string{}}); response.status != fiber.StatusForbidden {
+					t.Fatalf("taking the admin role from another admin returned status %d, want %d", response.status, fiber.StatusForbidden)
+				}
+			}
+
+			app := fiber.New()
+			app.Delete("/api/users/me/", asUser(admin), DeleteMe)
+			if response := request(t, app, fiber.MethodDelete, "/api/users/me/", nil); response.status != tt.want {
+				t.Fatalf("deleting the admin returned status %d, want %d", response.status, tt.want)
+			}
+
+			var remaining int64
+			if err := tx.Model(&model.User{}).Where("id = ?", admin.ID).Count(&remaining).Error; err != nil {
+				t.Fatal(err)
+			}
+			if deleted := remaining == 0; deleted != (tt.want == fiber.StatusOK) {
+				t.Fatalf("admin deleted: %v, want %v", deleted, tt.want == fiber.StatusOK)
+			}
+		})
+	}
+}
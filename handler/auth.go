@@ -1,35 +1,255 @@
 package handler
 
 import (
+	"errors"
+	"log"
+	"time"
+
 	"github.com/gofiber/fiber/v2"
-	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 	"github.com/kazimovzaman2/Go-jwt-gorm/config"
 	"github.com/kazimovzaman2/Go-jwt-gorm/database"
+	"github.com/kazimovzaman2/Go-jwt-gorm/middleware"
 	"github.com/kazimovzaman2/Go-jwt-gorm/model"
 	"github.com/kazimovzaman2/Go-jwt-gorm/utils"
-	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	errRefreshTokenInvalid = errors.New("refresh token is invalid or expired")
+	errRefreshTokenReused  = errors.New("refresh token was already used, session revoked")
+	errAccountSuspended    = errors.New("account suspended")
 )
 
 func CheckPasswordHash(password, hash string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
-	return err == nil
+	ok, _ := checkPassword(password, hash)
+	return ok
 }
 
-func generateTokens(user model.User) (string, string, error) {
-	accessToken, err := utils.GenerateAccessToken(user)
+// checkPassword also reports whether the hash should be upgraded to the
+// configured algorithm and parameters.
+func checkPassword(password, hash string) (bool, bool) {
+	// Users who signed up through a provider have no password yet.
+	if hash == "" {
+		compareDummyPassword(password)
+		return false, false
+	}
+	config, _ := config.LoadConfig(".")
+	return utils.VerifyPassword(password, hash, config)
+}
+
+// generateTokens stores a new refresh token for the session and returns it
+// signed together with a matching access token.
+func generateTokens(db *gorm.DB, user model.User, sessionID string) (string, string, error) {
+	stored := model.RefreshToken{
+		ID:        uuid.NewString(),
+		SessionID: sessionID,
+		ExpiresAt: time.Now().Add(utils.RefreshTokenTTL),
+	}
+	if err := db.Create(&stored).Error; err != nil {
+		return "", "", err
+	}
+
+	accessToken, err := utils.GenerateAccessToken(user, sessionID)
 	if err != nil {
 		return "", "", err
 	}
-	refreshToken, err := utils.GenerateRefreshToken(user)
+	refreshToken, err := utils.GenerateRefreshToken(user, stored)
 	if err != nil {
 		return "", "", err
 	}
 	return accessToken, refreshToken, nil
 }
 
+func rehashPassword(db *gorm.DB, user model.User, password string) error {
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+	return db.Model(&user).UpdateColumn("password", hash).Error
+}
+
+// loginDenied reports whether the unverified email policy keeps user from
+// logging in at all.
+func loginDenied(user model.User) bool {
+	cfg, _ := config.LoadConfig(".")
+	return cfg.UnverifiedEmailPolicy == config.UnverifiedDeny && user.EmailVerifiedAt == nil
+}
+
+func emailNotVerified(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusForbidden).JSON(model.ErrorResponse{
+		Status:  "error",
+		Message: "Verify your email address before logging in",
+		Errors:  "Email not verified",
+	})
+}
+
+// completeLogin finishes a login whose first factor passed: it hands out
+// a challenge token when two-factor authentication is on, and otherwise
+// starts a session.
+func completeLogin(c *fiber.Ctx, db *gorm.DB, user model.User) error {
+	if user.SuspendedAt != nil {
+		return accountSuspended(c)
+	}
+	if user.PasswordResetRequired {
+		return passwordResetRequired(c)
+	}
+
+	if user.TOTPEnabledAt != nil {
+		challengeToken, err := utils.GenerateChallengeToken(user)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+				Status:  "error",
+				Message: "Could not login",
+				Errors:  err.Error(),
+			})
+		}
+
+		return c.Status(fiber.StatusOK).JSON(model.SuccessResponse{
+			Status:  "success",
+			Message: "Two-factor authentication required",
+			Data: fiber.Map{
+				"two_factor_required": true,
+				"challenge_token":     challengeToken,
+			},
+		})
+	}
+
+	accessToken, refreshToken, err := startSession(c, db, user)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Could not login",
+			Errors:  err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(model.SuccessResponse{
+		Status:  "success",
+		Message: "Logged in",
+		Data: fiber.Map{
+			"access_token":  accessToken,
+			"refresh_token": refreshToken,
+		},
+	})
+}
+
+func passwordResetRequired(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusForbidden).JSON(model.ErrorResponse{
+		Status:  "error",
+		Message: "Your password has been reset. Choose a new one with the link sent to your email address",
+		Errors:  "Password reset required",
+	})
+}
+
+func accountSuspended(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusForbidden).JSON(model.ErrorResponse{
+		Status:  "error",
+		Message: "Your account has been suspended",
+		Errors:  "Account suspended",
+	})
+}
+
+// startSession opens a new session for user on the device that sent the
+// request and issues its first tokens.
+func startSession(c *fiber.Ctx, db *gorm.DB, user model.User) (string, string, error) {
+	var accessToken, refreshToken string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		session := model.Session{
+			ID:         uuid.NewString(),
+			UserID:     user.ID,
+			UserAgent:  utils.Snippet(c.Get(fiber.HeaderUserAgent), 500),
+			IP:         c.IP(),
+			LastUsedAt: time.Now(),
+		}
+		if err := tx.Create(&session).Error; err != nil {
+			return err
+		}
+
+		var err error
+		accessToken, refreshToken, err = generateTokens(tx, user, session.ID)
+		return err
+	})
+	return accessToken, refreshToken, err
+}
+
+// rotateRefreshToken marks the stored token as used and issues the next
+// access and refresh token pair in the same transaction, so a failure
+// leaves the old token usable. A token that was already used means it
+// leaked, so the whole session is revoked. The session's last use and IP
+// are updated on success.
+func rotateRefreshToken(db *gorm.DB, tokenID string, ip string) (string, string, error) {
+	var stored model.RefreshToken
+	var accessToken, refreshToken string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Preload("Session.User").Where("id = ?", tokenID).First(&stored).Error; err != nil {
+			return errRefreshTokenInvalid
+		}
+		if stored.Session.RevokedAt != nil || stored.ExpiresAt.Before(time.Now()) {
+			return errRefreshTokenInvalid
+		}
+		if stored.Session.User.SuspendedAt != nil {
+			return errAccountSuspended
+		}
+
+		// The conditional update makes concurrent refreshes race on the row,
+		// so exactly one of them wins.
+		result := tx.Model(&model.RefreshToken{}).
+			Where("id = ? AND used_at IS NULL", stored.ID).
+			Update("used_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errRefreshTokenReused
+		}
+
+		err := tx.Model(&model.Session{}).
+			Where("id = ?", stored.SessionID).
+			Updates(map[string]interface{}{"last_used_at": time.Now(), "ip": ip}).Error
+		if err != nil {
+			return err
+		}
+
+		accessToken, refreshToken, err = generateTokens(tx, stored.Session.User, stored.SessionID)
+		return err
+	})
+
+	if errors.Is(err, errRefreshTokenReused) {
+		revoked, revokeErr := revokeSessions(db, "id = ?", stored.SessionID)
+		if revokeErr != nil {
+			return "", "", revokeErr
+		}
+		closeSessionSockets(revoked)
+	}
+	return accessToken, refreshToken, err
+}
+
+// revokeSessions revokes every live session matching the condition and
+// returns their IDs. Pass them to closeSessionSockets once the change is
+// committed.
+func revokeSessions(db *gorm.DB, query interface{}, args ...interface{}) ([]string, error) {
+	var revoked []model.Session
+	err := db.Model(&revoked).
+		Clauses(clause.Returning{Columns: []clause.Column{{Name: "id"}}}).
+		Where(query, args...).
+		Where("revoked_at IS NULL").
+		Update("revoked_at", time.Now()).Error
+	if err != nil {
+		return nil, err
+	}
+
+	sessionIDs := make([]string, 0, len(revoked))
+	for _, session := range revoked {
+		sessionIDs = append(sessionIDs, session.ID)
+	}
+	return sessionIDs, nil
+}
+
 // Login is a handler to login a user and return the access and refresh tokens
 // @Summary Login a user
-// @Description Login a user
+// @Description Login a user. When two-factor authentication is enabled, the response holds a challenge_token to exchange at /jwt/2fa/ instead of the tokens.
 // @Tags jwt
 // @Accept json
 // @Produce json
@@ -37,7 +257,8 @@ func generateTokens(user model.User) (string, string, error) {
 // @Success 200 {object} model.SuccessResponse
 // @Failure 400 {object} model.ErrorResponse
 // @Failure 401 {object} model.ErrorResponse
-// @Failure 404 {object} model.ErrorResponse
+// @Failure 403 {object} model.ErrorResponse
+// @Failure 429 {object} model.ErrorResponse
 // @Failure 500 {object} model.ErrorResponse
 // @Router /jwt/create/ [post]
 func Login(c *fiber.Ctx) error {
@@ -53,46 +274,54 @@ func Login(c *fiber.Ctx) error {
 		})
 	}
 
-	if err := db.Where("email = ?", input.Email).First(&user).Error; err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(model.ErrorResponse{
+	wait, err := loginLockedFor(db, accountThrottleKey(input.Email), ipThrottleKey(c.IP()))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
 			Status:  "error",
-			Message: "User not found",
+			Message: "Could not login",
 			Errors:  err.Error(),
 		})
 	}
+	if wait > 0 {
+		return tooManyLoginAttempts(c, wait)
+	}
 
-	if !CheckPasswordHash(input.Password, user.Password) {
-		return c.Status(fiber.StatusUnauthorized).JSON(model.ErrorResponse{
-			Status:  "error",
-			Message: "The password is incorrect",
-			Errors:  "Invalid password",
-		})
+	// Unknown emails and wrong passwords look the same from outside.
+	var passwordOK, needsRehash bool
+	if err := db.Where("email = ?", input.Email).First(&user).Error; err != nil {
+		compareDummyPassword(input.Password)
+	} else {
+		passwordOK, needsRehash = checkPassword(input.Password, user.Password)
+	}
+	if !passwordOK {
+		if err := recordLoginFailure(db, input.Email, c.IP()); err != nil {
+			log.Printf("Failed to record login failure: %s", err)
+		}
+		return invalidCredentials(c)
 	}
 
-	accessToken, refreshToken, err := generateTokens(user)
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
-			Status:  "error",
-			Message: "Could not login",
-			Errors:  err.Error(),
-		})
+	if err := resetLoginFailures(db, input.Email); err != nil {
+		log.Printf("Failed to reset login failures: %s", err)
 	}
 
-	successResp := model.SuccessResponse{
-		Status:  "success",
-		Message: "Logged in",
-		Data: fiber.Map{
-			"access_token":  accessToken,
-			"refresh_token": refreshToken,
-		},
+	// The plain password is only available now, so this is the moment to
+	// move the stored hash to the current algorithm and cost.
+	if needsRehash {
+		if err := rehashPassword(db, user, input.Password); err != nil {
+			log.Printf("Failed to rehash password of user %d: %s", user.ID, err)
+		}
 	}
 
-	return c.Status(fiber.StatusOK).JSON(successResp)
+	if loginDenied(user) {
+		return emailNotVerified(c)
+	}
+
+	return completeLogin(c, db, user)
 }
 
 // RefreshToken is a handler to refresh the access token using the refresh token
 // @Summary Refresh token
-// @Description Refresh token
+// @Description Exchange a refresh token for a new access and refresh token pair. Every refresh token can be used once; presenting a used one again signs out the whole session.
 // @Tags jwt
 // @Accept json
 // @Produce json
@@ -100,7 +329,7 @@ func Login(c *fiber.Ctx) error {
 // @Success 200 {object} model.SuccessResponse
 // @Failure 400 {object} model.ErrorResponse
 // @Failure 401 {object} model.ErrorResponse
-// @Failure 404 {object} model.ErrorResponse
+// @Failure 403 {object} model.ErrorResponse
 // @Failure 500 {object} model.ErrorResponse
 // @Router /jwt/refresh/ [post]
 func RefreshToken(c *fiber.Ctx) error {
@@ -113,10 +342,7 @@ func RefreshToken(c *fiber.Ctx) error {
 		})
 	}
 
-	config, _ := config.LoadConfig(".")
-	token, err := jwt.Parse(input.RefreshToken, func(token *jwt.Token) (interface{}, error) {
-		return []byte(config.JwtRefreshSecret), nil
-	})
+	claims, err := utils.ParseInternalToken(input.RefreshToken, model.TokenTypeRefresh)
 	if err != nil {
 		return c.Status(fiber.StatusUnauthorized).JSON(model.ErrorResponse{
 			Status:  "error",
@@ -125,8 +351,8 @@ func RefreshToken(c *fiber.Ctx) error {
 		})
 	}
 
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok || !token.Valid {
+	tokenID := claims.ID
+	if tokenID == "" {
 		return c.Status(fiber.StatusUnauthorized).JSON(model.ErrorResponse{
 			Status:  "error",
 			Message: "The token is invalid",
@@ -135,17 +361,17 @@ func RefreshToken(c *fiber.Ctx) error {
 	}
 
 	db := database.DB
-	userID := claims["id"].(float64)
-	var user model.User
-	if err := db.Where("id = ?", userID).First(&user).Error; err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(model.ErrorResponse{
+	accessToken, refreshToken, err := rotateRefreshToken(db, tokenID, c.IP())
+	if errors.Is(err, errRefreshTokenInvalid) || errors.Is(err, errRefreshTokenReused) {
+		return c.Status(fiber.StatusUnauthorized).JSON(model.ErrorResponse{
 			Status:  "error",
-			Message: "User not found",
+			Message: "The token is invalid",
 			Errors:  err.Error(),
 		})
 	}
-
-	accessToken, refreshToken, err := generateTokens(user)
+	if errors.Is(err, errAccountSuspended) {
+		return accountSuspended(c)
+	}
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
 			Status:  "error",
@@ -165,3 +391,65 @@ func RefreshToken(c *fiber.Ctx) error {
 
 	return c.Status(fiber.StatusOK).JSON(successResp)
 }
+
+// Logout is a handler to sign out the current session
+// @Summary Logout
+// @Description Revoke the current session. Its refresh token stops working immediately and so do its access tokens.
+// @Tags jwt
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} model.SuccessResponse
+// @Failure 401 {object} model.ErrorResponse
+// @Failure 500 {object} model.ErrorResponse
+// @Router /jwt/logout/ [post]
+func Logout(c *fiber.Ctx) error {
+	db := database.DB
+
+	revoked, err := revokeSessions(db, "id = ?", middleware.CurrentClaims(c).SessionID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Could not logout",
+			Errors:  err.Error(),
+		})
+	}
+	closeSessionSockets(revoked)
+
+	return c.Status(fiber.StatusOK).JSON(model.SuccessResponse{
+		Status:  "success",
+		Message: "Logged out",
+		Data:    nil,
+	})
+}
+
+// LogoutAll is a handler to sign out every session of the current user
+// @Summary Logout everywhere
+// @Description Revoke every session of the current user, including the current one
+// @Tags jwt
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} model.SuccessResponse
+// @Failure 401 {object} model.ErrorResponse
+// @Failure 500 {object} model.ErrorResponse
+// @Router /jwt/logout-all/ [post]
+func LogoutAll(c *fiber.Ctx) error {
+	db := database.DB
+
+	revoked, err := revokeSessions(db, "user_id = ?", middleware.CurrentUser(c).ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Could not logout",
+			Errors:  err.Error(),
+		})
+	}
+	closeSessionSockets(revoked)
+
+	return c.Status(fiber.StatusOK).JSON(model.SuccessResponse{
+		Status:  "success",
+		Message: "Logged out everywhere",
+		Data:    nil,
+	})
+}
@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/kazimovzaman2/Go-jwt-gorm/model"
+	"gorm.io/gorm"
+)
+
+// createSession signs a new user in and returns the session and its
+// refresh token.
+func createSession(t *testing.T, db *gorm.DB) (model.Session, string) {
+	t.Helper()
+
+	user := model.User{Email: testID(t) + "@example.com", FirstName: "Ada", LastName: "Lovelace"}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	session := model.Session{ID: uuid.NewString(), UserID: user.ID, LastUsedAt: time.Now()}
+	if err := db.Create(&session).Error; err != nil {
+		t.Fatal(err)
+	}
+	_, refreshToken, err := generateTokens(db, user, session.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return session, refreshToken
+}
+
+func refresh(t *testing.T, app *fiber.App, refreshToken string) (testResponse, string) {
+	t.Helper()
+
+	response := request(t, app, fiber.MethodPost, "/api/jwt/refresh/", model.RefreshTokenInput{RefreshToken: refreshToken})
+	var tokens struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	json.Unmarshal(response.Data, &tokens)
+	return response, tokens.RefreshToken
+}
+
+func newRefreshApp() *fiber.App {
+	app := fiber.New()
+	app.Post("/api/jwt/refresh/", RefreshToken)
+	return app
+}
+
+func TestRefreshTokenRotates(t *testing.T) {
+	db := setupTestDB(t)
+	app := newRefreshApp()
+	session, first := createSession(t, db)
+
+	response, second := refresh(t, app, first)
+	if response.status != fiber.StatusOK || second == "" || second == first {
+		t.Fatalf("refresh returned status %d and %s, want a new refresh token", response.status, response.Data)
+	}
+	response, third := refresh(t, app, second)
+	if response.status != fiber.StatusOK || third == "" {
+		t.Fatalf("refresh with the rotated token returned status %d", response.status)
+	}
+
+	// Using a token twice means it leaked, so the whole session goes.
+	if response, _ := refresh(t, app, first); response.status != fiber.StatusUnauthorized {
+		t.Fatalf("reusing a refresh token returned status %d, want %d", response.status, fiber.StatusUnauthorized)
+	}
+	if err := db.First(&session, "id = ?", session.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if session.RevokedAt == nil {
+		t.Fatal("session wasn't revoked after a refresh token was reused")
+	}
+	if response, _ := refresh(t, app, third); response.status != fiber.StatusUnauthorized {
+		t.Fatalf("refresh in a revoked session returned status %d, want %d", response.status, fiber.StatusUnauthorized)
+	}
+}
+
+func TestRefreshTokenRejects(t *testing.T) {
+	db := setupTestDB(t)
+	app := newRefreshApp()
+
+	tests := []struct {
+		name   string
+		change func(session model.Session) error
+		want   int
+	}{
+		{"expired token", func(session model.Session) error {
+			return db.Model(&model.RefreshToken{}).Where("session_id = ?", session.ID).
+				Update("expires_at", time.Now().Add(-time.Minute)).Error
+		}, fiber.StatusUnauthorized},
+		{"unknown token", func(session model.Session) error {
+			return db.Where("session_id = ?", session.ID).Delete(&model.RefreshToken{}).Error
+		}, fiber.StatusUnauthorized},
+		{"revoked session", func(session model.Session) error {
+			return db.Model(&session).Update("revoked_at", time.Now()).Error
+		}, fiber.StatusUnauthorized},
+		{"suspended user", func(session model.Session) error {
+			return db.Model(&model.User{}).Where("id = ?", session.UserID).Update("suspended_at", time.Now()).Error
+		}, fiber.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session, refreshToken := createSession(t, db)
+			if err := tt.change(session); err != nil {
+				t.Fatal(err)
+			}
+
+			if response, _ := refresh(t, app, refreshToken); response.status != tt.want {
+				t.Fatalf("refresh returned status %d, want %d", response.status, tt.want)
+			}
+
+			// A rejected refresh mustn't use the token up.
+			var used int64
+			if err := db.Model(&model.RefreshToken{}).Where("session_id = ? AND used_at IS NOT NULL", session.ID).Count(&used).Error; err != nil {
+				t.Fatal(err)
+			}
+			if used != 0 {
+				t.Fatal("rejected refresh token was marked as used")
+			}
+		})
+	}
+}
@@ -0,0 +1,399 @@
+package handler
+
+import (
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/kazimovzaman2/Go-jwt-gorm/database"
+	"github.com/kazimovzaman2/Go-jwt-gorm/middleware"
+	"github.com/kazimovzaman2/Go-jwt-gorm/model"
+	"github.com/kazimovzaman2/Go-jwt-gorm/utils"
+	"github.com/kazimovzaman2/Go-jwt-gorm/validation"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// findConversation loads a conversation with its members, but only if userID
+// belongs to it. Non-members get gorm.ErrRecordNotFound so the API does not
+// reveal which conversation IDs exist.
+func findConversation(db *gorm.DB, conversationID uint, userID uint) (model.Conversation, error) {
+	var conversation model.Conversation
+	err := db.
+		Joins("JOIN conversation_members ON conversation_members.conversation_id = conversations.id").
+		Where("conversations.id = ? AND conversation_members.user_id = ?", conversationID, userID).
+		Preload("Members.User").
+		First(&conversation).Error
+	return conversation, err
+}
+
+// lastMessages returns the newest message of every given conversation keyed by
+// conversation ID, using a single query.
+func lastMessages(db *gorm.DB, conversationIDs []uint) (map[uint]*model.Message, error) {
+	result := make(map[uint]*model.Message, len(conversationIDs))
+	if len(conversationIDs) == 0 {
+		return result, nil
+	}
+
+	var messages []model.Message
+	err := db.Raw(
+		"SELECT DISTINCT ON (conversation_id) * FROM messages WHERE conversation_id IN ? ORDER BY conversation_id, id DESC",
+		conversationIDs,
+	).Scan(&messages).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range messages {
+		result[messages[i].ConversationID] = &messages[i]
+	}
+	return result, nil
+}
+
+// conversationResponses builds the responses of conversations as seen by
+// userID, loading last messages and unread counts with one query each.
+func conversationResponses(db *gorm.DB, userID uint, conversations []model.Conversation) ([]model.ConversationResponse, error) {
+	conversationIDs := make([]uint, 0, len(conversations))
+	for _, conversation := range conversations {
+		conversationIDs = append(conversationIDs, conversation.ID)
+	}
+
+	last, err := lastMessages(db, conversationIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	unread, err := unreadCounts(db, userID, conversationIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	responses := make([]model.ConversationResponse, 0, len(conversations))
+	for _, conversation := range conversations {
+		response := utils.ConversationToResponse(conversation, last[conversation.ID])
+		response.UnreadCount = unread[conversation.ID]
+		responses = append(responses, response)
+	}
+	return responses, nil
+}
+
+// GetMyConversations is a handler to list the conversations of the current user
+// @Summary List my conversations
+// @Description List the conversations the current user is a member of, most recently active first, with their unread counts
+// @Tags conversation
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} model.SuccessResponse{data=[]model.ConversationResponse}
+// @Failure 500 {object} model.ErrorResponse
+// @Router /conversations/ [get]
+func GetMyConversations(c *fiber.Ctx) error {
+	db := database.DB
+	userID := middleware.CurrentUser(c).ID
+
+	var conversations []model.Conversation
+	err := db.
+		Joins("JOIN conversation_members ON conversation_members.conversation_id = conversations.id").
+		Where("conversation_members.user_id = ?", userID).
+		Preload("Members.User").
+		Order("conversations.updated_at DESC").
+		Find(&conversations).Error
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Couldn't load conversations",
+			Errors:  err.Error(),
+		})
+	}
+
+	responseData, err := conversationResponses(db, userID, conversations)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Couldn't load conversations",
+			Errors:  err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(model.SuccessResponse{
+		Status:  "success",
+		Message: "All conversations",
+		Data:    responseData,
+	})
+}
+
+// GetConversation is a handler to get a conversation by ID
+// @Summary Get a conversation by ID
+// @Description Get a conversation the current user is a member of
+// @Tags conversation
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Conversation ID"
+// @Success 200 {object} model.SuccessResponse{data=model.ConversationResponse}
+// @Failure 404 {object} model.ErrorResponse
+// @Router /conversations/{id}/ [get]
+func GetConversation(c *fiber.Ctx) error {
+	db := database.DB
+	userID := middleware.CurrentUser(c).ID
+
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Invalid conversation ID",
+			Errors:  err.Error(),
+		})
+	}
+
+	conversation, err := findConversation(db, uint(id), userID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Conversation not found",
+			Errors:  err.Error(),
+		})
+	}
+
+	responseData, err := conversationResponses(db, userID, []model.Conversation{conversation})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Couldn't load conversation",
+			Errors:  err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(model.SuccessResponse{
+		Status:  "success",
+		Message: "Conversation found",
+		Data:    responseData[0],
+	})
+}
+
+// CreateConversation is a handler to create a new conversation
+// @Summary Create a conversation
+// @Description Create a conversation between the current user and the given members
+// @Tags conversation
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param input body model.CreateConversationInput true "Create conversation"
+// @Success 201 {object} model.SuccessResponse{data=model.ConversationResponse}
+// @Failure 400 {object} model.ErrorResponse
+// @Failure 500 {object} model.ErrorResponse
+// @Router /conversations/ [post]
+func CreateConversation(c *fiber.Ctx) error {
+	db := database.DB
+	userID := middleware.CurrentUser(c).ID
+
+	var input model.CreateConversationInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Invalid input",
+			Errors:  err.Error(),
+		})
+	}
+
+	validationErrors := validation.ValidateStruct(&input)
+	if len(validationErrors) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(validationErrors)
+	}
+
+	// Deduplicate members and always include the creator
+	memberIDs := []uint{userID}
+	seen := map[uint]bool{userID: true}
+	for _, id := range input.MemberIDs {
+		if !seen[id] {
+			seen[id] = true
+			memberIDs = append(memberIDs, id)
+		}
+	}
+
+	var count int64
+	if err := db.Model(&model.User{}).Where("id IN ?", memberIDs).Count(&count).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Couldn't create conversation",
+			Errors:  err.Error(),
+		})
+	}
+	if int(count) != len(memberIDs) {
+		return c.Status(fiber.StatusBadRequest).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Some members do not exist",
+			Errors:  "Unknown member ID",
+		})
+	}
+
+	conversation := model.Conversation{
+		Type:        model.ConversationTypeGroup,
+		Name:        input.Name,
+		CreatedByID: userID,
+	}
+	for _, id := range memberIDs {
+		role := model.MemberRoleMember
+		if id == userID {
+			role = model.MemberRoleOwner
+		}
+		conversation.Members = append(conversation.Members, model.ConversationMember{UserID: id, Role: role})
+	}
+
+	if err := db.Create(&conversation).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Couldn't create conversation",
+			Errors:  err.Error(),
+		})
+	}
+
+	conversation, err := findConversation(db, conversation.ID, userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Couldn't load conversation",
+			Errors:  err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(model.SuccessResponse{
+		Status:  "success",
+		Message: "Conversation created",
+		Data:    utils.ConversationToResponse(conversation, nil),
+	})
+}
+
+func directKey(a uint, b uint) string {
+	if a > b {
+		a, b = b, a
+	}
+	return fmt.Sprintf("%d:%d", a, b)
+}
+
+// getOrCreateDirectConversation relies on the unique direct_key index: when
+// two requests race, the loser's insert does nothing and it reads the
+// winner's row instead. It reports whether the conversation was created.
+func getOrCreateDirectConversation(db *gorm.DB, userID uint, otherID uint) (model.Conversation, bool, error) {
+	key := directKey(userID, otherID)
+	created := false
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		conversation := model.Conversation{
+			Type:        model.ConversationTypeDirect,
+			CreatedByID: userID,
+			DirectKey:   &key,
+		}
+		result := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "direct_key"}},
+			DoNothing: true,
+		}).Create(&conversation)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+
+		created = true
+		members := []model.ConversationMember{
+			{ConversationID: conversation.ID, UserID: userID, Role: model.MemberRoleMember},
+			{ConversationID: conversation.ID, UserID: otherID, Role: model.MemberRoleMember},
+		}
+		return tx.Create(&members).Error
+	})
+	if err != nil {
+		return model.Conversation{}, false, err
+	}
+
+	// A soft-deleted thread still owns the key, so bring it back.
+	if err := db.Unscoped().Model(&model.Conversation{}).
+		Where("direct_key = ? AND deleted_at IS NOT NULL", key).
+		Update("deleted_at", nil).Error; err != nil {
+		return model.Conversation{}, false, err
+	}
+
+	var conversation model.Conversation
+	if err := db.Where("direct_key = ?", key).First(&conversation).Error; err != nil {
+		return model.Conversation{}, false, err
+	}
+
+	conversation, err = findConversation(db, conversation.ID, userID)
+	return conversation, created, err
+}
+
+// GetOrCreateDirectConversation is a handler to open a direct conversation with a user
+// @Summary Open a direct conversation
+// @Description Return the direct conversation between the current user and the given user, creating it if it does not exist yet
+// @Tags conversation
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "User ID"
+// @Success 200 {object} model.SuccessResponse{data=model.ConversationResponse}
+// @Success 201 {object} model.SuccessResponse{data=model.ConversationResponse}
+// @Failure 400 {object} model.ErrorResponse
+// @Failure 404 {object} model.ErrorResponse
+// @Failure 500 {object} model.ErrorResponse
+// @Router /users/{id}/dm/ [post]
+func GetOrCreateDirectConversation(c *fiber.Ctx) error {
+	db := database.DB
+	userID := middleware.CurrentUser(c).ID
+
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Invalid user ID",
+			Errors:  err.Error(),
+		})
+	}
+	otherID := uint(id)
+
+	if otherID == userID {
+		return c.Status(fiber.StatusBadRequest).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Can't start a direct conversation with yourself",
+			Errors:  "Invalid user ID",
+		})
+	}
+
+	var other model.User
+	if err := db.First(&other, otherID).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "User with the provided ID not found",
+			Errors:  err.Error(),
+		})
+	}
+
+	conversation, created, err := getOrCreateDirectConversation(db, userID, other.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Couldn't open conversation",
+			Errors:  err.Error(),
+		})
+	}
+
+	responseData, err := conversationResponses(db, userID, []model.Conversation{conversation})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Couldn't load conversation",
+			Errors:  err.Error(),
+		})
+	}
+
+	status := fiber.StatusOK
+	message := "Conversation found"
+	if created {
+		status = fiber.StatusCreated
+		message = "Conversation created"
+	}
+
+	return c.Status(status).JSON(model.SuccessResponse{
+		Status:  "success",
+		Message: message,
+		Data:    responseData[0],
+	})
+}
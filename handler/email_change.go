@@ -0,0 +1,242 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/kazimovzaman2/Go-jwt-gorm/config"
+	"github.com/kazimovzaman2/Go-jwt-gorm/database"
+	"github.com/kazimovzaman2/Go-jwt-gorm/mailer"
+	"github.com/kazimovzaman2/Go-jwt-gorm/middleware"
+	"github.com/kazimovzaman2/Go-jwt-gorm/model"
+	"github.com/kazimovzaman2/Go-jwt-gorm/utils"
+	"github.com/kazimovzaman2/Go-jwt-gorm/validation"
+	"gorm.io/gorm"
+)
+
+const emailChangeTTL = 24 * time.Hour
+
+var (
+	errEmailChangeTokenInvalid = errors.New("email change token is invalid or expired")
+	errEmailTaken              = errors.New("email already exists")
+)
+
+func emailTaken(db *gorm.DB, email string) (bool, error) {
+	var count int64
+	err := db.Model(&model.User{}).Where("email = ?", email).Count(&count).Error
+	return count > 0, err
+}
+
+// ChangeEmail is a handler to start changing the email address of the current user
+// @Summary Change email address
+// @Description Email a confirmation link to the new address, valid for 24 hours, and let the old address know about the request. The current password is required. The address only changes once the link is confirmed at /users/email-change/confirm/.
+// @Tags user
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param input body model.ChangeEmailInput true "New email address and current password"
+// @Success 200 {object} model.SuccessResponse
+// @Failure 400 {object} model.ErrorResponse
+// @Failure 429 {object} model.ErrorResponse
+// @Failure 500 {object} model.ErrorResponse
+// @Router /users/me/email/ [post]
+func ChangeEmail(c *fiber.Ctx) error {
+	db := database.DB
+	user := middleware.CurrentUser(c)
+
+	var input model.ChangeEmailInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Invalid input",
+			Errors:  err.Error(),
+		})
+	}
+
+	validationErrors := validation.ValidateStruct(&input)
+	if len(validationErrors) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(validationErrors)
+	}
+
+	if ok, err := checkCurrentPassword(c, db, user, input.Password); !ok {
+		return err
+	}
+
+	if strings.EqualFold(input.Email, user.Email) {
+		return c.Status(fiber.StatusBadRequest).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "This is already your email address",
+			Errors:  "Email unchanged",
+		})
+	}
+
+	taken, err := emailTaken(db, input.Email)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Couldn't change email address",
+			Errors:  err.Error(),
+		})
+	}
+	if taken {
+		return c.Status(fiber.StatusBadRequest).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "User with this email already exists",
+			Errors:  "Email already exists",
+		})
+	}
+
+	token, tokenHash, err := utils.GenerateOpaqueToken()
+	if err == nil {
+		err = db.Create(&model.EmailChangeToken{
+			UserID:    user.ID,
+			NewEmail:  input.Email,
+			TokenHash: tokenHash,
+			ExpiresAt: time.Now().Add(emailChangeTTL),
+		}).Error
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Couldn't change email address",
+			Errors:  err.Error(),
+		})
+	}
+
+	config, _ := config.LoadConfig(".")
+	sendMail(mailer.Message{
+		To:      input.Email,
+		Subject: "Confirm your new email address",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nOpen the link below to use this address for your account. It expires in 24 hours.\n\n%s/confirm-email-change?token=%s\n\nIf you didn't ask for this, you can ignore this email.",
+			user.FirstName, config.AppURL, token,
+		),
+	})
+	sendMail(mailer.Message{
+		To:      user.Email,
+		Subject: "Your email address is being changed",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nSomeone asked to change the email address of your account to %s. It will only change once the link sent to that address is opened.\n\nIf you didn't do this, change your password right away.",
+			user.FirstName, input.Email,
+		),
+	})
+
+	return c.Status(fiber.StatusOK).JSON(model.SuccessResponse{
+		Status:  "success",
+		Message: "A confirmation link has been sent to the new address",
+		Data:    nil,
+	})
+}
+
+// ConfirmEmailChange is a handler to switch to the new email address with the emailed token
+// @Summary Confirm email change
+// @Description Replace the user's email address with the new one using the token from the confirmation email. The new address counts as verified.
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param input body model.ConfirmEmailChangeInput true "Confirmation token"
+// @Success 200 {object} model.SuccessResponse{data=model.MeResponse}
+// @Failure 400 {object} model.ErrorResponse
+// @Failure 500 {object} model.ErrorResponse
+// @Router /users/email-change/confirm/ [post]
+func ConfirmEmailChange(c *fiber.Ctx) error {
+	db := database.DB
+
+	var input model.ConfirmEmailChangeInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Invalid input",
+			Errors:  err.Error(),
+		})
+	}
+
+	validationErrors := validation.ValidateStruct(&input)
+	if len(validationErrors) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(validationErrors)
+	}
+
+	var user model.User
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var changeToken model.EmailChangeToken
+		err := tx.Preload("User").
+			Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", utils.HashOpaqueToken(input.Token), time.Now()).
+			First(&changeToken).Error
+		if err != nil {
+			return errEmailChangeTokenInvalid
+		}
+		user = changeToken.User
+
+		// Confirming one address burns the links sent to any other.
+		result := tx.Model(&model.EmailChangeToken{}).
+			Where("user_id = ? AND used_at IS NULL", user.ID).
+			Update("used_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errEmailChangeTokenInvalid
+		}
+
+		// The address may have been registered since the link was sent.
+		taken, err := emailTaken(tx, changeToken.NewEmail)
+		if err != nil {
+			return err
+		}
+		if taken {
+			return errEmailTaken
+		}
+
+		now := time.Now()
+		user.Email = changeToken.NewEmail
+		user.EmailVerifiedAt = &now
+		err = tx.Model(&user).Updates(map[string]interface{}{
+			"email":             user.Email,
+			"email_verified_at": now,
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		// Links sent to the old address must not work anymore.
+		err = tx.Model(&model.PasswordResetToken{}).
+			Where("user_id = ? AND used_at IS NULL", user.ID).
+			Update("used_at", now).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(&model.MagicLinkToken{}).
+			Where("user_id = ? AND used_at IS NULL", user.ID).
+			Update("used_at", now).Error
+	})
+	if errors.Is(err, errEmailChangeTokenInvalid) {
+		return c.Status(fiber.StatusBadRequest).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Invalid or expired confirmation link",
+			Errors:  err.Error(),
+		})
+	}
+	if errors.Is(err, errEmailTaken) {
+		return c.Status(fiber.StatusBadRequest).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "User with this email already exists",
+			Errors:  "Email already exists",
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Couldn't change email address",
+			Errors:  err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(model.SuccessResponse{
+		Status:  "success",
+		Message: "Email address changed",
+		Data:    utils.MeToResponse(user),
+	})
+}
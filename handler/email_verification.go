@@ -0,0 +1,187 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/kazimovzaman2/Go-jwt-gorm/config"
+	"github.com/kazimovzaman2/Go-jwt-gorm/database"
+	"github.com/kazimovzaman2/Go-jwt-gorm/mailer"
+	"github.com/kazimovzaman2/Go-jwt-gorm/middleware"
+	"github.com/kazimovzaman2/Go-jwt-gorm/model"
+	"github.com/kazimovzaman2/Go-jwt-gorm/utils"
+	"github.com/kazimovzaman2/Go-jwt-gorm/validation"
+	"gorm.io/gorm"
+)
+
+const (
+	emailVerificationTTL = 24 * time.Hour
+
+	// verificationResendInterval limits how often a user can have the
+	// verification email sent again.
+	verificationResendInterval = time.Minute
+)
+
+var errVerificationTokenInvalid = errors.New("verification token is invalid or expired")
+
+// sendVerificationEmail stores a new verification token for the user's
+// current address and emails the link to it.
+func sendVerificationEmail(db *gorm.DB, user model.User) error {
+	token, tokenHash, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	err = db.Create(&model.EmailVerificationToken{
+		UserID:    user.ID,
+		Email:     user.Email,
+		TokenHash: tokenHash,
+		ExpiresAt: time.Now().Add(emailVerificationTTL),
+	}).Error
+	if err != nil {
+		return err
+	}
+
+	config, _ := config.LoadConfig(".")
+	sendMail(mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nOpen the link below to verify your email address. It expires in 24 hours.\n\n%s/verify-email?token=%s",
+			user.FirstName, config.AppURL, token,
+		),
+	})
+	return nil
+}
+
+// VerifyEmail is a handler to verify an email address with the emailed token
+// @Summary Verify email address
+// @Description Mark the user's email address as verified using the token from the verification email
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param input body model.VerifyEmailInput true "Verification token"
+// @Success 200 {object} model.SuccessResponse{data=model.MeResponse}
+// @Failure 400 {object} model.ErrorResponse
+// @Failure 500 {object} model.ErrorResponse
+// @Router /users/verify-email/ [post]
+func VerifyEmail(c *fiber.Ctx) error {
+	db := database.DB
+
+	var input model.VerifyEmailInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Invalid input",
+			Errors:  err.Error(),
+		})
+	}
+
+	validationErrors := validation.ValidateStruct(&input)
+	if len(validationErrors) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(validationErrors)
+	}
+
+	var user model.User
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var verificationToken model.EmailVerificationToken
+		err := tx.Preload("User").
+			Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", utils.HashOpaqueToken(input.Token), time.Now()).
+			First(&verificationToken).Error
+		if err != nil || verificationToken.User.Email != verificationToken.Email {
+			return errVerificationTokenInvalid
+		}
+		user = verificationToken.User
+
+		result := tx.Model(&model.EmailVerificationToken{}).
+			Where("user_id = ? AND used_at IS NULL", user.ID).
+			Update("used_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errVerificationTokenInvalid
+		}
+
+		if user.EmailVerifiedAt == nil {
+			now := time.Now()
+			user.EmailVerifiedAt = &now
+			return tx.Model(&user).Update("email_verified_at", now).Error
+		}
+		return nil
+	})
+	if errors.Is(err, errVerificationTokenInvalid) {
+		return c.Status(fiber.StatusBadRequest).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Invalid or expired verification link",
+			Errors:  err.Error(),
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Couldn't verify email address",
+			Errors:  err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(model.SuccessResponse{
+		Status:  "success",
+		Message: "Email address verified",
+		Data:    utils.MeToResponse(user),
+	})
+}
+
+// ResendVerificationEmail is a handler to send the verification email again
+// @Summary Resend verification email
+// @Description Send a new verification link to the current user's email address. Can be called once a minute.
+// @Tags user
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} model.SuccessResponse
+// @Failure 400 {object} model.ErrorResponse
+// @Failure 429 {object} model.ErrorResponse
+// @Failure 500 {object} model.ErrorResponse
+// @Router /users/me/verify-email/resend/ [post]
+func ResendVerificationEmail(c *fiber.Ctx) error {
+	db := database.DB
+
+	user := middleware.CurrentUser(c)
+
+	if user.EmailVerifiedAt != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Email address is already verified",
+			Errors:  "Already verified",
+		})
+	}
+
+	var recent int64
+	db.Model(&model.EmailVerificationToken{}).
+		Where("user_id = ? AND created_at > ?", user.ID, time.Now().Add(-verificationResendInterval)).
+		Count(&recent)
+	if recent > 0 {
+		return c.Status(fiber.StatusTooManyRequests).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Please wait a minute before requesting another email",
+			Errors:  "Too many requests",
+		})
+	}
+
+	if err := sendVerificationEmail(db, user); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Couldn't send verification email",
+			Errors:  err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(model.SuccessResponse{
+		Status:  "success",
+		Message: "Verification email sent",
+		Data:    nil,
+	})
+}
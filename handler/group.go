@@ -0,0 +1,513 @@
+package handler
+
+import (
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/kazimovzaman2/Go-jwt-gorm/database"
+	"github.com/kazimovzaman2/Go-jwt-gorm/middleware"
+	"github.com/kazimovzaman2/Go-jwt-gorm/model"
+	"github.com/kazimovzaman2/Go-jwt-gorm/realtime"
+	"github.com/kazimovzaman2/Go-jwt-gorm/utils"
+	"github.com/kazimovzaman2/Go-jwt-gorm/validation"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var roleRank = map[string]int{
+	model.MemberRoleMember: 1,
+	model.MemberRoleAdmin:  2,
+	model.MemberRoleOwner:  3,
+}
+
+func findMember(conversation model.Conversation, userID uint) *model.ConversationMember {
+	for i := range conversation.Members {
+		if conversation.Members[i].UserID == userID {
+			return &conversation.Members[i]
+		}
+	}
+	return nil
+}
+
+// loadGroup resolves the :id group conversation and the current user's
+// membership in it. On failure it returns the status and body to respond with.
+func loadGroup(c *fiber.Ctx, db *gorm.DB) (model.Conversation, *model.ConversationMember, int, *model.ErrorResponse) {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return model.Conversation{}, nil, fiber.StatusBadRequest, &model.ErrorResponse{
+			Status:  "error",
+			Message: "Invalid conversation ID",
+			Errors:  err.Error(),
+		}
+	}
+
+	userID := middleware.CurrentUser(c).ID
+	conversation, err := findConversation(db, uint(id), userID)
+	if err != nil {
+		return model.Conversation{}, nil, fiber.StatusNotFound, &model.ErrorResponse{
+			Status:  "error",
+			Message: "Conversation not found",
+			Errors:  err.Error(),
+		}
+	}
+
+	if conversation.Type != model.ConversationTypeGroup {
+		return model.Conversation{}, nil, fiber.StatusBadRequest, &model.ErrorResponse{
+			Status:  "error",
+			Message: "Only group conversations have managed membership",
+			Errors:  "Not a group conversation",
+		}
+	}
+
+	return conversation, findMember(conversation, userID), 0, nil
+}
+
+// loadTarget resolves the :user_id member of conversation.
+func loadTarget(c *fiber.Ctx, conversation model.Conversation) (*model.ConversationMember, int, *model.ErrorResponse) {
+	targetID, err := c.ParamsInt("user_id")
+	if err != nil {
+		return nil, fiber.StatusBadRequest, &model.ErrorResponse{
+			Status:  "error",
+			Message: "Invalid user ID",
+			Errors:  err.Error(),
+		}
+	}
+
+	target := findMember(conversation, uint(targetID))
+	if target == nil {
+		return nil, fiber.StatusNotFound, &model.ErrorResponse{
+			Status:  "error",
+			Message: "User is not a member of this conversation",
+			Errors:  "Member not found",
+		}
+	}
+	return target, 0, nil
+}
+
+func forbidden(c *fiber.Ctx, message string) error {
+	return c.Status(fiber.StatusForbidden).JSON(model.ErrorResponse{
+		Status:  "error",
+		Message: message,
+		Errors:  "Forbidden",
+	})
+}
+
+func touchConversation(tx *gorm.DB, conversationID uint) error {
+	return tx.Model(&model.Conversation{}).
+		Where("id = ?", conversationID).
+		Update("updated_at", gorm.Expr("NOW()")).Error
+}
+
+// UpdateConversation is a handler to rename a group or change its avatar
+// @Summary Update a group
+// @Description Rename a group conversation or change its avatar. The avatar must be a base64 image, or an empty string to remove it. Requires admin or owner.
+// @Tags group
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Conversation ID"
+// @Param input body model.UpdateConversationInput true "Group data"
+// @Success 200 {object} model.SuccessResponse{data=model.ConversationResponse}
+// @Failure 400 {object} model.ErrorResponse
+// @Failure 403 {object} model.ErrorResponse
+// @Failure 404 {object} model.ErrorResponse
+// @Failure 500 {object} model.ErrorResponse
+// @Router /conversations/{id}/ [patch]
+func UpdateConversation(c *fiber.Ctx) error {
+	db := database.DB
+
+	conversation, actor, status, errResp := loadGroup(c, db)
+	if errResp != nil {
+		return c.Status(status).JSON(errResp)
+	}
+	if roleRank[actor.Role] < roleRank[model.MemberRoleAdmin] {
+		return forbidden(c, "Only admins can update the group")
+	}
+
+	var input model.UpdateConversationInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Invalid input",
+			Errors:  err.Error(),
+		})
+	}
+
+	validationErrors := validation.ValidateStruct(&input)
+	if len(validationErrors) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(validationErrors)
+	}
+
+	if input.Name != nil {
+		conversation.Name = *input.Name
+	}
+
+	// Save group avatar
+	if input.Avatar != nil {
+		switch {
+		case *input.Avatar == "":
+			conversation.Avatar = ""
+		case utils.IsBase64(*input.Avatar):
+			imagePath, err := utils.SaveBase64Image(*input.Avatar)
+			if err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+					Status:  "error",
+					Message: "Couldn't save group avatar",
+					Errors:  err.Error(),
+				})
+			}
+
+			conversation.Avatar = fmt.Sprintf("http://localhost:8000/%s", imagePath)
+		default:
+			return c.Status(fiber.StatusBadRequest).JSON(model.ErrorResponse{
+				Status:  "error",
+				Message: "Avatar must be a base64 encoded image",
+				Errors:  "Invalid avatar",
+			})
+		}
+	}
+
+	err := db.Model(&conversation).Updates(map[string]interface{}{
+		"name":   conversation.Name,
+		"avatar": conversation.Avatar,
+	}).Error
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Couldn't update group",
+			Errors:  err.Error(),
+		})
+	}
+
+	responseData := utils.ConversationToResponse(conversation, nil)
+	publishToConversation(conversation, realtime.EventConversationUpdated, responseData)
+
+	return c.Status(fiber.StatusOK).JSON(model.SuccessResponse{
+		Status:  "success",
+		Message: "Group updated",
+		Data:    responseData,
+	})
+}
+
+// AddMembers is a handler to add users to a group
+// @Summary Add group members
+// @Description Add users to a group conversation. Users who are already members are ignored. Requires admin or owner.
+// @Tags group
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Conversation ID"
+// @Param input body model.AddMembersInput true "Users to add"
+// @Success 200 {object} model.SuccessResponse{data=model.ConversationResponse}
+// @Failure 400 {object} model.ErrorResponse
+// @Failure 403 {object} model.ErrorResponse
+// @Failure 404 {object} model.ErrorResponse
+// @Failure 500 {object} model.ErrorResponse
+// @Router /conversations/{id}/members/ [post]
+func AddMembers(c *fiber.Ctx) error {
+	db := database.DB
+
+	conversation, actor, status, errResp := loadGroup(c, db)
+	if errResp != nil {
+		return c.Status(status).JSON(errResp)
+	}
+	if roleRank[actor.Role] < roleRank[model.MemberRoleAdmin] {
+		return forbidden(c, "Only admins can add members")
+	}
+
+	var input model.AddMembersInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Invalid input",
+			Errors:  err.Error(),
+		})
+	}
+
+	validationErrors := validation.ValidateStruct(&input)
+	if len(validationErrors) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(validationErrors)
+	}
+
+	var newMembers []model.ConversationMember
+	var newUserIDs []uint
+	seen := map[uint]bool{}
+	for _, id := range input.UserIDs {
+		if seen[id] || findMember(conversation, id) != nil {
+			continue
+		}
+		seen[id] = true
+		newUserIDs = append(newUserIDs, id)
+		newMembers = append(newMembers, model.ConversationMember{
+			ConversationID: conversation.ID,
+			UserID:         id,
+			Role:           model.MemberRoleMember,
+		})
+	}
+
+	if len(newMembers) > 0 {
+		var count int64
+		if err := db.Model(&model.User{}).Where("id IN ?", newUserIDs).Count(&count).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+				Status:  "error",
+				Message: "Couldn't add members",
+				Errors:  err.Error(),
+			})
+		}
+		if int(count) != len(newMembers) {
+			return c.Status(fiber.StatusBadRequest).JSON(model.ErrorResponse{
+				Status:  "error",
+				Message: "Some members do not exist",
+				Errors:  "Unknown member ID",
+			})
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&newMembers).Error; err != nil {
+				return err
+			}
+			return touchConversation(tx, conversation.ID)
+		})
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+				Status:  "error",
+				Message: "Couldn't add members",
+				Errors:  err.Error(),
+			})
+		}
+	}
+
+	conversation, err := findConversation(db, conversation.ID, actor.UserID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Couldn't load conversation",
+			Errors:  err.Error(),
+		})
+	}
+
+	responseData := utils.ConversationToResponse(conversation, nil)
+	if len(newMembers) > 0 {
+		publishToConversation(conversation, realtime.EventMemberAdded, responseData)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(model.SuccessResponse{
+		Status:  "success",
+		Message: "Members added",
+		Data:    responseData,
+	})
+}
+
+// RemoveMember is a handler to remove a user from a group
+// @Summary Remove a group member
+// @Description Remove a member from a group conversation. Admins can remove members, the owner can also remove admins.
+// @Tags group
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Conversation ID"
+// @Param user_id path int true "User ID"
+// @Success 200 {object} model.SuccessResponse
+// @Failure 400 {object} model.ErrorResponse
+// @Failure 403 {object} model.ErrorResponse
+// @Failure 404 {object} model.ErrorResponse
+// @Failure 500 {object} model.ErrorResponse
+// @Router /conversations/{id}/members/{user_id}/ [delete]
+func RemoveMember(c *fiber.Ctx) error {
+	db := database.DB
+
+	conversation, actor, status, errResp := loadGroup(c, db)
+	if errResp != nil {
+		return c.Status(status).JSON(errResp)
+	}
+
+	target, status, errResp := loadTarget(c, conversation)
+	if errResp != nil {
+		return c.Status(status).JSON(errResp)
+	}
+
+	if target.UserID == actor.UserID {
+		return c.Status(fiber.StatusBadRequest).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Use the leave endpoint to leave a group",
+			Errors:  "Can't remove yourself",
+		})
+	}
+	if roleRank[actor.Role] < roleRank[model.MemberRoleAdmin] || roleRank[actor.Role] <= roleRank[target.Role] {
+		return forbidden(c, "You can't remove this member")
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(target).Error; err != nil {
+			return err
+		}
+		return touchConversation(tx, conversation.ID)
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Couldn't remove member",
+			Errors:  err.Error(),
+		})
+	}
+
+	// Published to the members before removal so the removed user is told too.
+	publishToConversation(conversation, realtime.EventMemberRemoved, fiber.Map{"user_id": target.UserID})
+
+	return c.Status(fiber.StatusOK).JSON(model.SuccessResponse{
+		Status:  "success",
+		Message: "Member removed",
+		Data:    nil,
+	})
+}
+
+// LeaveConversation is a handler to leave a group
+// @Summary Leave a group
+// @Description Leave a group conversation. When the owner leaves, ownership passes to the longest-standing admin, or to the longest-standing member if there are no admins.
+// @Tags group
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Conversation ID"
+// @Success 200 {object} model.SuccessResponse
+// @Failure 400 {object} model.ErrorResponse
+// @Failure 404 {object} model.ErrorResponse
+// @Failure 500 {object} model.ErrorResponse
+// @Router /conversations/{id}/leave/ [post]
+func LeaveConversation(c *fiber.Ctx) error {
+	db := database.DB
+
+	conversation, actor, status, errResp := loadGroup(c, db)
+	if errResp != nil {
+		return c.Status(status).JSON(errResp)
+	}
+
+	var successor *model.ConversationMember
+	if actor.Role == model.MemberRoleOwner {
+		for i := range conversation.Members {
+			member := &conversation.Members[i]
+			if member.UserID == actor.UserID {
+				continue
+			}
+			if successor == nil ||
+				roleRank[member.Role] > roleRank[successor.Role] ||
+				(member.Role == successor.Role && member.CreatedAt.Before(successor.CreatedAt)) {
+				successor = member
+			}
+		}
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(actor).Error; err != nil {
+			return err
+		}
+		if len(conversation.Members) == 1 {
+			return tx.Delete(&conversation).Error
+		}
+		if successor != nil {
+			successor.Role = model.MemberRoleOwner
+			if err := tx.Model(successor).Update("role", successor.Role).Error; err != nil {
+				return err
+			}
+		}
+		return touchConversation(tx, conversation.ID)
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Couldn't leave group",
+			Errors:  err.Error(),
+		})
+	}
+
+	publishToConversation(conversation, realtime.EventMemberRemoved, fiber.Map{"user_id": actor.UserID})
+	if successor != nil {
+		publishToConversation(conversation, realtime.EventMemberUpdated, utils.MemberToResponse(*successor))
+	}
+
+	return c.Status(fiber.StatusOK).JSON(model.SuccessResponse{
+		Status:  "success",
+		Message: "Left group",
+		Data:    nil,
+	})
+}
+
+// PromoteMember is a handler to make a group member an admin
+// @Summary Promote a group member
+// @Description Make a member of a group conversation an admin. Requires owner.
+// @Tags group
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Conversation ID"
+// @Param user_id path int true "User ID"
+// @Success 200 {object} model.SuccessResponse{data=model.MemberResponse}
+// @Failure 400 {object} model.ErrorResponse
+// @Failure 403 {object} model.ErrorResponse
+// @Failure 404 {object} model.ErrorResponse
+// @Failure 500 {object} model.ErrorResponse
+// @Router /conversations/{id}/members/{user_id}/promote/ [post]
+func PromoteMember(c *fiber.Ctx) error {
+	return changeMemberRole(c, model.MemberRoleMember, model.MemberRoleAdmin)
+}
+
+// DemoteMember is a handler to make a group admin a plain member
+// @Summary Demote a group admin
+// @Description Make an admin of a group conversation a plain member. Requires owner.
+// @Tags group
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Conversation ID"
+// @Param user_id path int true "User ID"
+// @Success 200 {object} model.SuccessResponse{data=model.MemberResponse}
+// @Failure 400 {object} model.ErrorResponse
+// @Failure 403 {object} model.ErrorResponse
+// @Failure 404 {object} model.ErrorResponse
+// @Failure 500 {object} model.ErrorResponse
+// @Router /conversations/{id}/members/{user_id}/demote/ [post]
+func DemoteMember(c *fiber.Ctx) error {
+	return changeMemberRole(c, model.MemberRoleAdmin, model.MemberRoleMember)
+}
+
+func changeMemberRole(c *fiber.Ctx, from string, to string) error {
+	db := database.DB
+
+	conversation, actor, status, errResp := loadGroup(c, db)
+	if errResp != nil {
+		return c.Status(status).JSON(errResp)
+	}
+	if actor.Role != model.MemberRoleOwner {
+		return forbidden(c, "Only the owner can change member roles")
+	}
+
+	target, status, errResp := loadTarget(c, conversation)
+	if errResp != nil {
+		return c.Status(status).JSON(errResp)
+	}
+	if target.Role != from {
+		return c.Status(fiber.StatusBadRequest).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: fmt.Sprintf("Only a member with the %s role can become %s", from, to),
+			Errors:  "Invalid role change",
+		})
+	}
+
+	target.Role = to
+	if err := db.Model(target).Update("role", target.Role).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Couldn't change member role",
+			Errors:  err.Error(),
+		})
+	}
+
+	responseData := utils.MemberToResponse(*target)
+	publishToConversation(conversation, realtime.EventMemberUpdated, responseData)
+
+	return c.Status(fiber.StatusOK).JSON(model.SuccessResponse{
+		Status:  "success",
+		Message: "Member role changed",
+		Data:    responseData,
+	})
+}
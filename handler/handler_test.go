@@ -0,0 +1,192 @@
+package handler
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/kazimovzaman2/Go-jwt-gorm/database"
+	"github.com/kazimovzaman2/Go-jwt-gorm/mailer"
+	"github.com/kazimovzaman2/Go-jwt-gorm/middleware"
+	"github.com/kazimovzaman2/Go-jwt-gorm/model"
+	"github.com/kazimovzaman2/Go-jwt-gorm/signing"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// setupTestDB points the handlers at the Postgres database named by
+// TEST_DATABASE_DSN, e.g. "host=localhost user=postgres dbname=app_test
+// sslmode=disable", and skips the test without one. Tests leave their rows
+// behind, so give them a database of their own.
+func setupTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN is not set")
+	}
+
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+
+	previous := database.DB
+	database.DB = db
+	t.Cleanup(func() { database.DB = previous })
+
+	setupTestConfig(t)
+	setupTestKeys(t)
+	return db
+}
+
+// setupTestConfig runs the test in a directory with a .env file, which is
+// where config.LoadConfig looks.
+func setupTestConfig(t *testing.T) {
+	t.Helper()
+
+	dir := t.TempDir()
+	env := "APP_URL=http://localhost:3000\nJWT_REFRESH_SECRET=test-secret\nUNVERIFIED_EMAIL_POLICY=allow\n"
+	if err := os.WriteFile(filepath.Join(dir, ".env"), []byte(env), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+func setupTestKeys(t *testing.T) {
+	t.Helper()
+
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keySet, err := signing.NewKeySet([]*signing.Key{{
+		ID:        "test",
+		Algorithm: signing.AlgorithmEdDSA,
+		Private:   private,
+		Public:    public,
+	}}, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	previous := signing.DefaultKeySet
+	signing.DefaultKeySet = keySet
+	t.Cleanup(func() { signing.DefaultKeySet = previous })
+}
+
+// asUser stands in for the auth middleware and makes user the current user.
+// Its claims name no stored session.
+func asUser(user model.User) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		c.Locals(middleware.CurrentUserKey, user)
+		c.Locals(middleware.ClaimsKey, &model.TokenClaims{})
+		return c.Next()
+	}
+}
+
+// testMailer hands the messages sent during a test to it.
+type testMailer chan mailer.Message
+
+func (m testMailer) Send(message mailer.Message) error {
+	m <- message
+	return nil
+}
+
+func setupTestMailer(t *testing.T) testMailer {
+	t.Helper()
+
+	messages := make(testMailer, 16)
+	previous := mailer.DefaultMailer
+	mailer.DefaultMailer = messages
+	t.Cleanup(func() { mailer.DefaultMailer = previous })
+	return messages
+}
+
+// next waits for the next message sent to to.
+func (m testMailer) next(t *testing.T, to string) mailer.Message {
+	t.Helper()
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case message := <-m:
+			if message.To == to {
+				return message
+			}
+		case <-timeout:
+			t.Fatalf("no email sent to %s", to)
+		}
+	}
+}
+
+// testID returns a random string to keep the rows of a test apart from
+// those other tests left behind.
+func testID(t *testing.T) string {
+	t.Helper()
+
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatal(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// testResponse is the part of a response the tests look at.
+type testResponse struct {
+	status  int
+	cookies []*http.Cookie
+	Data    json.RawMessage `json:"data"`
+}
+
+// request sends a JSON request to app with the given cookies.
+func request(t *testing.T, app *fiber.App, method, path string, body interface{}, cookies ...*http.Cookie) testResponse {
+	t.Helper()
+
+	var reader bytes.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader.Reset(encoded)
+	}
+	req := httptest.NewRequest(method, path, &reader)
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	response := testResponse{status: resp.StatusCode, cookies: resp.Cookies()}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		t.Fatalf("%s %s: couldn't decode response: %s", method, path, err)
+	}
+	return response
+}
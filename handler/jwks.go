@@ -0,0 +1,14 @@
+package handler
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/kazimovzaman2/Go-jwt-gorm/signing"
+)
+
+// GetJWKS serves the public keys that verify access tokens as a standard
+// JWK Set, so other services can check tokens without sharing a secret.
+// Keys are matched by the kid header of the token.
+func GetJWKS(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+	return c.Status(fiber.StatusOK).JSON(signing.DefaultKeySet.JWKS())
+}
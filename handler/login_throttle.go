@@ -0,0 +1,158 @@
+package handler
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/kazimovzaman2/Go-jwt-gorm/model"
+	"gorm.io/gorm"
+)
+
+const (
+	// Failures allowed before a key gets locked. Clients get more room
+	// because many users can share an IP behind NAT.
+	accountFailureLimit = 5
+	ipFailureLimit      = 20
+
+	// The first lockout lasts loginLockoutBase and doubles with every
+	// further failure, up to loginLockoutMax.
+	loginLockoutBase = 30 * time.Second
+	loginLockoutMax  = 15 * time.Minute
+
+	// Failures are forgotten after this long without a new one.
+	loginFailureWindow = time.Hour
+
+	// Emailed links an address or a client can request before further
+	// requests are locked, using the same backoff as failed logins.
+	accountLinkRequestLimit = 3
+	ipLinkRequestLimit      = 20
+)
+
+var (
+	dummyPasswordHash     string
+	dummyPasswordHashOnce sync.Once
+)
+
+// compareDummyPassword spends as long as a real password check, so that
+// response times don't tell unknown emails apart from wrong passwords.
+func compareDummyPassword(password string) {
+	dummyPasswordHashOnce.Do(func() {
+		dummyPasswordHash, _ = hashPassword("dummy password for unknown accounts")
+	})
+	CheckPasswordHash(password, dummyPasswordHash)
+}
+
+func accountThrottleKey(email string) string {
+	return "email:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipThrottleKey(ip string) string {
+	return "ip:" + ip
+}
+
+// loginLockedFor returns how long the longest lock among keys still lasts.
+func loginLockedFor(db *gorm.DB, keys ...string) (time.Duration, error) {
+	var throttles []model.LoginThrottle
+	err := db.Where("key IN ? AND locked_until > ?", keys, time.Now()).Find(&throttles).Error
+	if err != nil {
+		return 0, err
+	}
+
+	var wait time.Duration
+	for _, throttle := range throttles {
+		if remaining := time.Until(*throttle.LockedUntil); remaining > wait {
+			wait = remaining
+		}
+	}
+	return wait, nil
+}
+
+// recordLoginFailure counts a failure for the account and the client and
+// locks whichever went over its limit.
+func recordLoginFailure(db *gorm.DB, email string, ip string) error {
+	if err := recordThrottleFailure(db, accountThrottleKey(email), accountFailureLimit); err != nil {
+		return err
+	}
+	return recordThrottleFailure(db, ipThrottleKey(ip), ipFailureLimit)
+}
+
+func recordThrottleFailure(db *gorm.DB, key string, limit int) error {
+	now := time.Now()
+
+	// One statement, so concurrent failures from other processes all count.
+	var failures int
+	err := db.Raw(`
+		INSERT INTO login_throttles (key, failures, updated_at) VALUES (?, 1, ?)
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE WHEN login_throttles.updated_at < ? THEN 1 ELSE login_throttles.failures + 1 END,
+			updated_at = EXCLUDED.updated_at
+		RETURNING failures`,
+		key, now, now.Add(-loginFailureWindow),
+	).Scan(&failures).Error
+	if err != nil {
+		return err
+	}
+
+	lockout := lockoutFor(failures, limit)
+	if lockout == 0 {
+		return nil
+	}
+	return db.Model(&model.LoginThrottle{}).Where("key = ?", key).Update("locked_until", now.Add(lockout)).Error
+}
+
+// lockoutFor returns how long a key with the given failures gets locked,
+// or zero while it is below its limit.
+func lockoutFor(failures int, limit int) time.Duration {
+	if failures < limit {
+		return 0
+	}
+	if excess := failures - limit; excess < 16 {
+		return min(loginLockoutBase<<excess, loginLockoutMax)
+	}
+	return loginLockoutMax
+}
+
+// throttleLinkRequest counts a request for an emailed link of the given
+// kind against the address and the client. Unknown addresses are counted
+// too, so the limit doesn't tell them apart. While either is locked it
+// returns how long for, and nothing is counted.
+func throttleLinkRequest(db *gorm.DB, kind string, email string, ip string) (time.Duration, error) {
+	accountKey := kind + ":" + accountThrottleKey(email)
+	clientKey := kind + ":" + ipThrottleKey(ip)
+
+	wait, err := loginLockedFor(db, accountKey, clientKey)
+	if err != nil || wait > 0 {
+		return wait, err
+	}
+	if err := recordThrottleFailure(db, accountKey, accountLinkRequestLimit); err != nil {
+		return 0, err
+	}
+	return 0, recordThrottleFailure(db, clientKey, ipLinkRequestLimit)
+}
+
+// resetLoginFailures clears the account's failures after a successful
+// login. The client's count is left alone, since one IP guessing many
+// accounts may still get some right.
+func resetLoginFailures(db *gorm.DB, email string) error {
+	return db.Where("key = ?", accountThrottleKey(email)).Delete(&model.LoginThrottle{}).Error
+}
+
+func tooManyLoginAttempts(c *fiber.Ctx, wait time.Duration) error {
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(wait.Seconds())+1))
+	return c.Status(fiber.StatusTooManyRequests).JSON(model.ErrorResponse{
+		Status:  "error",
+		Message: "Too many failed login attempts, try again later",
+		Errors:  "Too many requests",
+	})
+}
+
+func invalidCredentials(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusUnauthorized).JSON(model.ErrorResponse{
+		Status:  "error",
+		Message: "Invalid email or password",
+		Errors:  "Invalid credentials",
+	})
+}
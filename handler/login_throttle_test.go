@@ -0,0 +1,99 @@
+package handler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kazimovzaman2/Go-jwt-gorm/model"
+)
+
+func TestLockoutFor(t *testing.T) {
+	tests := []struct {
+		name     string
+		failures int
+		limit    int
+		want     time.Duration
+	}{
+		{"no failures", 0, accountFailureLimit, 0},
+		{"below the limit", accountFailureLimit - 1, accountFailureLimit, 0},
+		{"at the limit", accountFailureLimit, accountFailureLimit, 30 * time.Second},
+		{"one over", accountFailureLimit + 1, accountFailureLimit, time.Minute},
+		{"two over", accountFailureLimit + 2, accountFailureLimit, 2 * time.Minute},
+		{"four over", accountFailureLimit + 4, accountFailureLimit, 8 * time.Minute},
+		{"five over", accountFailureLimit + 5, accountFailureLimit, 15 * time.Minute},
+		{"far over", accountFailureLimit + 15, accountFailureLimit, 15 * time.Minute},
+		// Shifting by this much would overflow.
+		{"overflow", accountFailureLimit + 64, accountFailureLimit, 15 * time.Minute},
+		{"IP below the limit", ipFailureLimit - 1, ipFailureLimit, 0},
+		{"IP at the limit", ipFailureLimit, ipFailureLimit, 30 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := lockoutFor(tt.failures, tt.limit); got != tt.want {
+				t.Fatalf("lockoutFor(%d, %d) = %s, want %s", tt.failures, tt.limit, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecordLoginFailureEscalates(t *testing.T) {
+	db := setupTestDB(t)
+	email := testID(t) + "@example.com"
+	ip := testID(t)
+
+	for failures := 1; failures <= accountFailureLimit+2; failures++ {
+		if err := recordLoginFailure(db, email, ip); err != nil {
+			t.Fatal(err)
+		}
+		wait, err := loginLockedFor(db, accountThrottleKey(email), ipThrottleKey(ip))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := lockoutFor(failures, accountFailureLimit)
+		if wait > want || wait < want-5*time.Second {
+			t.Fatalf("after %d failures the account is locked for %s, want %s", failures, wait, want)
+		}
+	}
+
+	// The client stays below its own, higher limit.
+	if wait, err := loginLockedFor(db, ipThrottleKey(ip)); err != nil || wait != 0 {
+		t.Fatalf("client is locked for %s (%v), want 0", wait, err)
+	}
+
+	if err := resetLoginFailures(db, email); err != nil {
+		t.Fatal(err)
+	}
+	if wait, err := loginLockedFor(db, accountThrottleKey(email)); err != nil || wait != 0 {
+		t.Fatalf("after a successful login the account is locked for %s (%v), want 0", wait, err)
+	}
+}
+
+func TestRecordLoginFailureForgetsOldFailures(t *testing.T) {
+	db := setupTestDB(t)
+	email := testID(t) + "@example.com"
+	ip := testID(t)
+
+	for i := 0; i < accountFailureLimit-1; i++ {
+		if err := recordLoginFailure(db, email, ip); err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := db.Model(&model.LoginThrottle{}).
+		Where("key = ?", accountThrottleKey(email)).
+		Update("updated_at", time.Now().Add(-loginFailureWindow-time.Minute)).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := recordLoginFailure(db, email, ip); err != nil {
+		t.Fatal(err)
+	}
+	var throttle model.LoginThrottle
+	if err := db.Where("key = ?", accountThrottleKey(email)).First(&throttle).Error; err != nil {
+		t.Fatal(err)
+	}
+	if throttle.Failures != 1 || throttle.LockedUntil != nil {
+		t.Fatalf("account has %d failures, locked until %v, want 1 and no lock", throttle.Failures, throttle.LockedUntil)
+	}
+}
@@ -0,0 +1,215 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/kazimovzaman2/Go-jwt-gorm/config"
+	"github.com/kazimovzaman2/Go-jwt-gorm/database"
+	"github.com/kazimovzaman2/Go-jwt-gorm/mailer"
+	"github.com/kazimovzaman2/Go-jwt-gorm/model"
+	"github.com/kazimovzaman2/Go-jwt-gorm/utils"
+	"github.com/kazimovzaman2/Go-jwt-gorm/validation"
+	"gorm.io/gorm"
+)
+
+const magicLinkTTL = 15 * time.Minute
+
+var errMagicLinkInvalid = errors.New("sign-in link is invalid or expired")
+
+// sendMagicLink stores a sign-in link bound to nonceHash for the account
+// registered with email, if any, and emails it.
+func sendMagicLink(db *gorm.DB, email string, nonceHash string) error {
+	var user model.User
+	err := db.Where("email = ?", email).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	token, tokenHash, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return err
+	}
+	err = db.Create(&model.MagicLinkToken{
+		UserID:    user.ID,
+		TokenHash: tokenHash,
+		NonceHash: nonceHash,
+		ExpiresAt: time.Now().Add(magicLinkTTL),
+	}).Error
+	if err != nil {
+		return err
+	}
+
+	config, _ := config.LoadConfig(".")
+	sendMail(mailer.Message{
+		To:      user.Email,
+		Subject: "Your sign-in link",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nOpen the link below in the same browser to sign in. It expires in 15 minutes and works once.\n\n%s/magic-link?token=%s\n\nIf you didn't ask for this, you can ignore this email.",
+			user.FirstName, config.AppURL, token,
+		),
+	})
+	return nil
+}
+
+// RequestMagicLink is a handler to email a sign-in link
+// @Summary Request a sign-in link
+// @Description Email a single-use sign-in link, valid for 15 minutes. The returned nonce must be sent together with the token from the link, so the link only works in the browser that asked for it. The response is the same whether or not the address is registered. Requests are rate limited per address and per client.
+// @Tags jwt
+// @Accept json
+// @Produce json
+// @Param input body model.MagicLinkRequestInput true "Account email"
+// @Success 200 {object} model.SuccessResponse{data=model.MagicLinkResponse}
+// @Failure 400 {object} model.ErrorResponse
+// @Failure 429 {object} model.ErrorResponse
+// @Failure 500 {object} model.ErrorResponse
+// @Router /jwt/magic-link/ [post]
+func RequestMagicLink(c *fiber.Ctx) error {
+	db := database.DB
+
+	var input model.MagicLinkRequestInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Invalid input",
+			Errors:  err.Error(),
+		})
+	}
+
+	validationErrors := validation.ValidateStruct(&input)
+	if len(validationErrors) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(validationErrors)
+	}
+
+	wait, err := throttleLinkRequest(db, "magic-link", input.Email, c.IP())
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Couldn't send sign-in link",
+			Errors:  err.Error(),
+		})
+	}
+	if wait > 0 {
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(wait.Seconds())+1))
+		return c.Status(fiber.StatusTooManyRequests).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Too many sign-in links requested, try again later",
+			Errors:  "Too many requests",
+		})
+	}
+
+	nonce, nonceHash, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Couldn't send sign-in link",
+			Errors:  err.Error(),
+		})
+	}
+
+	// The lookup runs after the response, so its timing doesn't reveal
+	// whether the address is registered.
+	email := input.Email
+	go func() {
+		if err := sendMagicLink(db, email, nonceHash); err != nil {
+			log.Printf("Failed to send sign-in link: %s", err)
+		}
+	}()
+
+	return c.Status(fiber.StatusOK).JSON(model.SuccessResponse{
+		Status:  "success",
+		Message: "If the address is registered, a sign-in link has been sent",
+		Data:    model.MagicLinkResponse{Nonce: nonce},
+	})
+}
+
+// MagicLinkLogin is a handler to log in with an emailed sign-in link
+// @Summary Log in with a sign-in link
+// @Description Exchange the token from a sign-in link and the nonce returned when it was requested for an access and refresh token pair. Opening the link also verifies the email address. When two-factor authentication is enabled, a challenge_token is returned instead, to be completed at /jwt/2fa/.
+// @Tags jwt
+// @Accept json
+// @Produce json
+// @Param input body model.MagicLinkLoginInput true "Token and nonce"
+// @Success 200 {object} model.SuccessResponse
+// @Failure 400 {object} model.ErrorResponse
+// @Failure 401 {object} model.ErrorResponse
+// @Failure 403 {object} model.ErrorResponse
+// @Failure 500 {object} model.ErrorResponse
+// @Router /jwt/magic-link/login/ [post]
+func MagicLinkLogin(c *fiber.Ctx) error {
+	db := database.DB
+
+	var input model.MagicLinkLoginInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Invalid input",
+			Errors:  err.Error(),
+		})
+	}
+
+	validationErrors := validation.ValidateStruct(&input)
+	if len(validationErrors) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(validationErrors)
+	}
+
+	var user model.User
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// A wrong nonce leaves the link unused, so whoever intercepted it
+		// can't burn it for the browser it belongs to.
+		var linkToken model.MagicLinkToken
+		err := tx.Preload("User").
+			Where("token_hash = ? AND nonce_hash = ? AND used_at IS NULL AND expires_at > ?",
+				utils.HashOpaqueToken(input.Token), utils.HashOpaqueToken(input.Nonce), time.Now()).
+			First(&linkToken).Error
+		if err != nil {
+			return errMagicLinkInvalid
+		}
+		user = linkToken.User
+
+		result := tx.Model(&model.MagicLinkToken{}).
+			Where("user_id = ? AND used_at IS NULL", user.ID).
+			Update("used_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errMagicLinkInvalid
+		}
+
+		// The link reached the inbox, which is all verification proves.
+		if user.EmailVerifiedAt == nil {
+			now := time.Now()
+			user.EmailVerifiedAt = &now
+			return tx.Model(&user).Update("email_verified_at", now).Error
+		}
+		return nil
+	})
+	if errors.Is(err, errMagicLinkInvalid) {
+		return c.Status(fiber.StatusUnauthorized).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Invalid or expired sign-in link",
+			Errors:  err.Error(),
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Could not login",
+			Errors:  err.Error(),
+		})
+	}
+
+	if err := resetLoginFailures(db, user.Email); err != nil {
+		log.Printf("Failed to reset login failures: %s", err)
+	}
+
+	return completeLogin(c, db, user)
+}
@@ -0,0 +1,651 @@
+package handler
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/kazimovzaman2/Go-jwt-gorm/config"
+	"github.com/kazimovzaman2/Go-jwt-gorm/database"
+	"github.com/kazimovzaman2/Go-jwt-gorm/middleware"
+	"github.com/kazimovzaman2/Go-jwt-gorm/model"
+	"github.com/kazimovzaman2/Go-jwt-gorm/realtime"
+	"github.com/kazimovzaman2/Go-jwt-gorm/utils"
+	"github.com/kazimovzaman2/Go-jwt-gorm/validation"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultMessagePageSize = 50
+	maxMessagePageSize     = 100
+)
+
+var (
+	errParentNotFound = errors.New("parent message not found in this conversation")
+	errQuoteNotFound  = errors.New("quoted message not found in this conversation")
+)
+
+// sendMessage stores a message and bumps the conversation so it sorts first
+// in the conversation list. Replies are attached to the root of the thread and
+// update its reply counters in the same transaction. The caller must have
+// checked membership.
+func sendMessage(db *gorm.DB, conversationID uint, senderID uint, input model.SendMessageInput) (model.Message, error) {
+	message := model.Message{
+		ConversationID: conversationID,
+		SenderID:       senderID,
+		Body:           input.Body,
+	}
+	var quoted *model.Message
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if input.ParentID != nil {
+			var parent model.Message
+			if err := tx.Where("conversation_id = ? AND deleted_at IS NULL", conversationID).First(&parent, *input.ParentID).Error; err != nil {
+				return errParentNotFound
+			}
+			rootID := parent.ID
+			if parent.ParentID != nil {
+				rootID = *parent.ParentID
+			}
+			message.ParentID = &rootID
+		}
+
+		if input.QuotedID != nil {
+			quoted = new(model.Message)
+			if err := tx.Where("conversation_id = ? AND deleted_at IS NULL", conversationID).First(quoted, *input.QuotedID).Error; err != nil {
+				return errQuoteNotFound
+			}
+			message.QuotedID = &quoted.ID
+		}
+
+		if err := tx.Create(&message).Error; err != nil {
+			return err
+		}
+
+		if message.ParentID != nil {
+			err := tx.Model(&model.Message{}).
+				Where("id = ?", *message.ParentID).
+				Updates(map[string]interface{}{
+					"reply_count":   gorm.Expr("reply_count + 1"),
+					"last_reply_at": message.CreatedAt,
+				}).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		// Sending a message means having read everything before it
+		err := tx.Model(&model.ConversationMember{}).
+			Where("conversation_id = ? AND user_id = ?", conversationID, senderID).
+			Updates(map[string]interface{}{
+				"last_read_message_id": message.ID,
+				"last_read_at":         message.CreatedAt,
+			}).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Model(&model.Conversation{}).
+			Where("id = ?", conversationID).
+			Update("updated_at", time.Now()).Error
+	})
+
+	message.Quoted = quoted
+	return message, err
+}
+
+// publishNewMessage announces a new message and, for thread replies, the
+// updated counters of the thread root.
+func publishNewMessage(db *gorm.DB, conversation model.Conversation, message model.MessageResponse) {
+	publishToConversation(conversation, realtime.EventMessageCreated, message)
+
+	if message.ParentID != nil {
+		publishThreadUpdated(db, conversation, *message.ParentID)
+	}
+}
+
+// publishThreadUpdated announces the current reply counters of a thread root.
+func publishThreadUpdated(db *gorm.DB, conversation model.Conversation, rootID uint) {
+	var root model.Message
+	if err := db.Preload("Quoted").First(&root, rootID).Error; err == nil {
+		publishToConversation(conversation, realtime.EventThreadUpdated, utils.MessageToResponse(root))
+	}
+}
+
+// CreateMessage is a handler to post a message to a conversation
+// @Summary Post a message
+// @Description Post a message to a conversation the current user is a member of. Set parent_id to reply in a thread and quoted_id to quote another message inline.
+// @Tags message
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Conversation ID"
+// @Param input body model.SendMessageInput true "Message"
+// @Success 201 {object} model.SuccessResponse{data=model.MessageResponse}
+// @Failure 400 {object} model.ErrorResponse
+// @Failure 404 {object} model.ErrorResponse
+// @Failure 500 {object} model.ErrorResponse
+// @Router /conversations/{id}/messages/ [post]
+func CreateMessage(c *fiber.Ctx) error {
+	db := database.DB
+	userID := middleware.CurrentUser(c).ID
+
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Invalid conversation ID",
+			Errors:  err.Error(),
+		})
+	}
+
+	conversation, err := findConversation(db, uint(id), userID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Conversation not found",
+			Errors:  err.Error(),
+		})
+	}
+
+	var input model.SendMessageInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Invalid input",
+			Errors:  err.Error(),
+		})
+	}
+
+	validationErrors := validation.ValidateStruct(&input)
+	if len(validationErrors) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(validationErrors)
+	}
+
+	message, err := sendMessage(db, conversation.ID, userID, input)
+	if errors.Is(err, errParentNotFound) || errors.Is(err, errQuoteNotFound) {
+		return c.Status(fiber.StatusBadRequest).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Referenced message not found",
+			Errors:  err.Error(),
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Couldn't send message",
+			Errors:  err.Error(),
+		})
+	}
+
+	responseData := utils.MessageToResponse(message)
+	publishNewMessage(db, conversation, responseData)
+
+	return c.Status(fiber.StatusCreated).JSON(model.SuccessResponse{
+		Status:  "success",
+		Message: "Message sent",
+		Data:    responseData,
+	})
+}
+
+// GetMessages is a handler to page through the history of a conversation
+// @Summary Get conversation messages
+// @Description Get the top-level messages of a conversation, newest first. Thread replies are only returned by the thread endpoint. Pass next_cursor from the previous page as "before" to load older messages.
+// @Tags message
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Conversation ID"
+// @Param before query int false "Only return messages with an ID lower than this"
+// @Param limit query int false "Page size (default 50, max 100)"
+// @Success 200 {object} model.SuccessResponse{data=model.MessagePageResponse}
+// @Failure 400 {object} model.ErrorResponse
+// @Failure 404 {object} model.ErrorResponse
+// @Failure 500 {object} model.ErrorResponse
+// @Router /conversations/{id}/messages/ [get]
+func GetMessages(c *fiber.Ctx) error {
+	db := database.DB
+	userID := middleware.CurrentUser(c).ID
+
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Invalid conversation ID",
+			Errors:  err.Error(),
+		})
+	}
+
+	conversation, err := findConversation(db, uint(id), userID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Conversation not found",
+			Errors:  err.Error(),
+		})
+	}
+
+	limit := c.QueryInt("limit", defaultMessagePageSize)
+	if limit < 1 || limit > maxMessagePageSize {
+		limit = defaultMessagePageSize
+	}
+	before := c.QueryInt("before", 0)
+
+	query := db.Preload("Quoted").Where("conversation_id = ? AND parent_id IS NULL", conversation.ID)
+	if before > 0 {
+		query = query.Where("id < ?", before)
+	}
+
+	var messages []model.Message
+	if err := query.Order("id DESC").Limit(limit).Find(&messages).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Couldn't load messages",
+			Errors:  err.Error(),
+		})
+	}
+
+	responseData := model.MessagePageResponse{
+		Messages: make([]model.MessageResponse, 0, len(messages)),
+	}
+	for _, message := range messages {
+		responseData.Messages = append(responseData.Messages, utils.MessageToResponse(message))
+	}
+	if err := attachReactions(db, userID, responseData.Messages); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Couldn't load messages",
+			Errors:  err.Error(),
+		})
+	}
+	if len(messages) == limit {
+		responseData.NextCursor = messages[len(messages)-1].ID
+	}
+
+	return c.Status(fiber.StatusOK).JSON(model.SuccessResponse{
+		Status:  "success",
+		Message: "Messages",
+		Data:    responseData,
+	})
+}
+
+// loadMessage resolves the :id conversation and its :message_id message for
+// the current user. On failure it returns the status and body to respond with.
+func loadMessage(c *fiber.Ctx, db *gorm.DB) (model.Conversation, model.Message, int, *model.ErrorResponse) {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return model.Conversation{}, model.Message{}, fiber.StatusBadRequest, &model.ErrorResponse{
+			Status:  "error",
+			Message: "Invalid conversation ID",
+			Errors:  err.Error(),
+		}
+	}
+
+	messageID, err := c.ParamsInt("message_id")
+	if err != nil {
+		return model.Conversation{}, model.Message{}, fiber.StatusBadRequest, &model.ErrorResponse{
+			Status:  "error",
+			Message: "Invalid message ID",
+			Errors:  err.Error(),
+		}
+	}
+
+	conversation, err := findConversation(db, uint(id), middleware.CurrentUser(c).ID)
+	if err != nil {
+		return model.Conversation{}, model.Message{}, fiber.StatusNotFound, &model.ErrorResponse{
+			Status:  "error",
+			Message: "Conversation not found",
+			Errors:  err.Error(),
+		}
+	}
+
+	var message model.Message
+	if err := db.Preload("Quoted").Where("conversation_id = ?", conversation.ID).First(&message, messageID).Error; err != nil {
+		return model.Conversation{}, model.Message{}, fiber.StatusNotFound, &model.ErrorResponse{
+			Status:  "error",
+			Message: "Message not found",
+			Errors:  err.Error(),
+		}
+	}
+
+	return conversation, message, 0, nil
+}
+
+// isModerator reports whether userID moderates conversation, i.e. is an
+// admin or the owner of a group.
+func isModerator(conversation model.Conversation, userID uint) bool {
+	member := findMember(conversation, userID)
+	return conversation.Type == model.ConversationTypeGroup &&
+		member != nil &&
+		roleRank[member.Role] >= roleRank[model.MemberRoleAdmin]
+}
+
+// EditMessage is a handler to edit a message
+// @Summary Edit a message
+// @Description Edit one of your own messages within the configured edit window. The previous body is kept as a revision.
+// @Tags message
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Conversation ID"
+// @Param message_id path int true "Message ID"
+// @Param input body model.EditMessageInput true "New message body"
+// @Success 200 {object} model.SuccessResponse{data=model.MessageResponse}
+// @Failure 400 {object} model.ErrorResponse
+// @Failure 403 {object} model.ErrorResponse
+// @Failure 404 {object} model.ErrorResponse
+// @Failure 500 {object} model.ErrorResponse
+// @Router /conversations/{id}/messages/{message_id}/ [patch]
+func EditMessage(c *fiber.Ctx) error {
+	db := database.DB
+	userID := middleware.CurrentUser(c).ID
+	config, _ := config.LoadConfig(".")
+
+	conversation, message, status, errResp := loadMessage(c, db)
+	if errResp != nil {
+		return c.Status(status).JSON(errResp)
+	}
+
+	if message.SenderID != userID {
+		return forbidden(c, "You can only edit your own messages")
+	}
+	if message.DeletedAt != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Deleted messages can't be edited",
+			Errors:  "Message deleted",
+		})
+	}
+	if time.Since(message.CreatedAt) > config.MessageEditWindow {
+		return forbidden(c, "The edit window for this message has passed")
+	}
+
+	var input model.EditMessageInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Invalid input",
+			Errors:  err.Error(),
+		})
+	}
+
+	validationErrors := validation.ValidateStruct(&input)
+	if len(validationErrors) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(validationErrors)
+	}
+
+	now := time.Now()
+	err := db.Transaction(func(tx *gorm.DB) error {
+		revision := model.MessageRevision{
+			MessageID: message.ID,
+			EditorID:  userID,
+			Body:      message.Body,
+		}
+		if err := tx.Create(&revision).Error; err != nil {
+			return err
+		}
+
+		message.Body = input.Body
+		message.EditedAt = &now
+		return tx.Model(&message).Updates(map[string]interface{}{
+			"body":      message.Body,
+			"edited_at": message.EditedAt,
+		}).Error
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Couldn't edit message",
+			Errors:  err.Error(),
+		})
+	}
+
+	responseData := utils.MessageToResponse(message)
+	publishToConversation(conversation, realtime.EventMessageUpdated, responseData)
+
+	return c.Status(fiber.StatusOK).JSON(model.SuccessResponse{
+		Status:  "success",
+		Message: "Message edited",
+		Data:    responseData,
+	})
+}
+
+// DeleteMessage is a handler to delete a message
+// @Summary Delete a message
+// @Description Delete one of your own messages within the configured edit window. Group admins can delete any message at any time. The message stays in the history as a deleted placeholder.
+// @Tags message
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Conversation ID"
+// @Param message_id path int true "Message ID"
+// @Success 200 {object} model.SuccessResponse{data=model.MessageResponse}
+// @Failure 400 {object} model.ErrorResponse
+// @Failure 403 {object} model.ErrorResponse
+// @Failure 404 {object} model.ErrorResponse
+// @Failure 500 {object} model.ErrorResponse
+// @Router /conversations/{id}/messages/{message_id}/ [delete]
+func DeleteMessage(c *fiber.Ctx) error {
+	db := database.DB
+	userID := middleware.CurrentUser(c).ID
+	config, _ := config.LoadConfig(".")
+
+	conversation, message, status, errResp := loadMessage(c, db)
+	if errResp != nil {
+		return c.Status(status).JSON(errResp)
+	}
+
+	if message.DeletedAt != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Message already deleted",
+			Errors:  "Message deleted",
+		})
+	}
+
+	if !isModerator(conversation, userID) {
+		if message.SenderID != userID {
+			return forbidden(c, "You can only delete your own messages")
+		}
+		if time.Since(message.CreatedAt) > config.MessageEditWindow {
+			return forbidden(c, "The edit window for this message has passed")
+		}
+	}
+
+	now := time.Now()
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// The last body is kept as a revision so moderators can still see it
+		revision := model.MessageRevision{
+			MessageID: message.ID,
+			EditorID:  userID,
+			Body:      message.Body,
+		}
+		if err := tx.Create(&revision).Error; err != nil {
+			return err
+		}
+
+		message.Body = ""
+		message.DeletedAt = &now
+		err := tx.Model(&message).Updates(map[string]interface{}{
+			"body":       message.Body,
+			"deleted_at": message.DeletedAt,
+		}).Error
+		if err != nil || message.ParentID == nil {
+			return err
+		}
+
+		// The root only counts replies that are still there
+		return tx.Model(&model.Message{}).
+			Where("id = ?", *message.ParentID).
+			Updates(map[string]interface{}{
+				"reply_count": gorm.Expr("GREATEST(reply_count - 1, 0)"),
+				"last_reply_at": gorm.Expr(
+					"(SELECT MAX(created_at) FROM messages WHERE parent_id = ? AND deleted_at IS NULL)",
+					*message.ParentID,
+				),
+			}).Error
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Couldn't delete message",
+			Errors:  err.Error(),
+		})
+	}
+
+	responseData := utils.MessageToResponse(message)
+	publishToConversation(conversation, realtime.EventMessageDeleted, responseData)
+	if message.ParentID != nil {
+		publishThreadUpdated(db, conversation, *message.ParentID)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(model.SuccessResponse{
+		Status:  "success",
+		Message: "Message deleted",
+		Data:    responseData,
+	})
+}
+
+// GetMessageRevisions is a handler to get the edit history of a message
+// @Summary Get message revisions
+// @Description Get the previous bodies of an edited or deleted message, oldest first. Requires group admin or owner.
+// @Tags message
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Conversation ID"
+// @Param message_id path int true "Message ID"
+// @Success 200 {object} model.SuccessResponse{data=[]model.MessageRevisionResponse}
+// @Failure 403 {object} model.ErrorResponse
+// @Failure 404 {object} model.ErrorResponse
+// @Failure 500 {object} model.ErrorResponse
+// @Router /conversations/{id}/messages/{message_id}/revisions/ [get]
+func GetMessageRevisions(c *fiber.Ctx) error {
+	db := database.DB
+
+	conversation, message, status, errResp := loadMessage(c, db)
+	if errResp != nil {
+		return c.Status(status).JSON(errResp)
+	}
+
+	if !isModerator(conversation, middleware.CurrentUser(c).ID) {
+		return forbidden(c, "Only group admins can see message revisions")
+	}
+
+	var revisions []model.MessageRevision
+	if err := db.Where("message_id = ?", message.ID).Order("id ASC").Find(&revisions).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Couldn't load revisions",
+			Errors:  err.Error(),
+		})
+	}
+
+	responseData := make([]model.MessageRevisionResponse, 0, len(revisions))
+	for _, revision := range revisions {
+		responseData = append(responseData, utils.MessageRevisionToResponse(revision))
+	}
+
+	return c.Status(fiber.StatusOK).JSON(model.SuccessResponse{
+		Status:  "success",
+		Message: "Message revisions",
+		Data:    responseData,
+	})
+}
+
+// GetThread is a handler to page through the replies of a thread
+// @Summary Get a thread
+// @Description Get the root message of a thread, its replies newest first and everyone who took part. Pass next_cursor from the previous page as "before" to load older replies.
+// @Tags message
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Conversation ID"
+// @Param message_id path int true "Root message ID"
+// @Param before query int false "Only return replies with an ID lower than this"
+// @Param limit query int false "Page size (default 50, max 100)"
+// @Success 200 {object} model.SuccessResponse{data=model.ThreadResponse}
+// @Failure 400 {object} model.ErrorResponse
+// @Failure 404 {object} model.ErrorResponse
+// @Failure 500 {object} model.ErrorResponse
+// @Router /conversations/{id}/messages/{message_id}/thread/ [get]
+func GetThread(c *fiber.Ctx) error {
+	db := database.DB
+
+	_, root, status, errResp := loadMessage(c, db)
+	if errResp != nil {
+		return c.Status(status).JSON(errResp)
+	}
+	if root.ParentID != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Message is a reply, open the thread of its parent instead",
+			Errors:  "Not a thread root",
+		})
+	}
+
+	limit := c.QueryInt("limit", defaultMessagePageSize)
+	if limit < 1 || limit > maxMessagePageSize {
+		limit = defaultMessagePageSize
+	}
+	before := c.QueryInt("before", 0)
+
+	query := db.Preload("Quoted").Where("parent_id = ?", root.ID)
+	if before > 0 {
+		query = query.Where("id < ?", before)
+	}
+
+	var replies []model.Message
+	if err := query.Order("id DESC").Limit(limit).Find(&replies).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Couldn't load thread",
+			Errors:  err.Error(),
+		})
+	}
+
+	var participants []model.User
+	err := db.
+		Where("id = ? OR id IN (?)", root.SenderID, db.Model(&model.Message{}).Select("sender_id").Where("parent_id = ?", root.ID)).
+		Order("id").
+		Find(&participants).Error
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Couldn't load thread",
+			Errors:  err.Error(),
+		})
+	}
+
+	responseData := model.ThreadResponse{
+		Root:         utils.MessageToResponse(root),
+		Replies:      make([]model.MessageResponse, 0, len(replies)),
+		Participants: make([]model.UserResponse, 0, len(participants)),
+	}
+	for _, reply := range replies {
+		responseData.Replies = append(responseData.Replies, utils.MessageToResponse(reply))
+	}
+
+	withRoot := append([]model.MessageResponse{responseData.Root}, responseData.Replies...)
+	if err := attachReactions(db, middleware.CurrentUser(c).ID, withRoot); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Couldn't load thread",
+			Errors:  err.Error(),
+		})
+	}
+	responseData.Root = withRoot[0]
+	responseData.Replies = withRoot[1:]
+	for _, participant := range participants {
+		responseData.Participants = append(responseData.Participants, utils.UserToResponse(participant))
+	}
+	if len(replies) == limit {
+		responseData.NextCursor = replies[len(replies)-1].ID
+	}
+
+	return c.Status(fiber.StatusOK).JSON(model.SuccessResponse{
+		Status:  "success",
+		Message: "Thread",
+		Data:    responseData,
+	})
+}
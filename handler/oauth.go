@@ -0,0 +1,510 @@
+package handler
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/kazimovzaman2/Go-jwt-gorm/config"
+	"github.com/kazimovzaman2/Go-jwt-gorm/database"
+	"github.com/kazimovzaman2/Go-jwt-gorm/middleware"
+	"github.com/kazimovzaman2/Go-jwt-gorm/model"
+	"github.com/kazimovzaman2/Go-jwt-gorm/oauth"
+	"github.com/kazimovzaman2/Go-jwt-gorm/utils"
+	"github.com/kazimovzaman2/Go-jwt-gorm/validation"
+	"gorm.io/gorm"
+)
+
+// oauthFlowCookie holds the browser nonce of the provider sign-in in
+// progress. Only the browser that began a flow can finish it.
+const oauthFlowCookie = "oauth_flow"
+
+var (
+	errOAuthEmailMissing    = errors.New("provider returned no email address")
+	errOAuthEmailUnverified = errors.New("provider email address is not verified")
+	errIdentityTaken        = errors.New("identity is linked to another user")
+	errIdentityExists       = errors.New("user already has an identity at this provider")
+)
+
+func providerNotFound(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusNotFound).JSON(model.ErrorResponse{
+		Status:  "error",
+		Message: "Sign-in provider not found",
+		Errors:  "Unknown provider",
+	})
+}
+
+// beginOAuthFlow answers a begin request with the provider's authorization URL.
+func beginOAuthFlow(c *fiber.Ctx, db *gorm.DB, userID *uint) error {
+	provider, ok := oauth.Providers[c.Params("provider")]
+	if !ok {
+		return providerNotFound(c)
+	}
+
+	authURL, state, browserNonce, err := oauth.BeginFlow(db, provider, userID)
+	if err != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Couldn't reach the sign-in provider",
+			Errors:  err.Error(),
+		})
+	}
+	setOAuthFlowCookie(c, browserNonce, time.Now().Add(oauth.FlowTTL))
+
+	return c.Status(fiber.StatusOK).JSON(model.SuccessResponse{
+		Status:  "success",
+		Message: "Continue at the sign-in provider",
+		Data: model.OAuthBeginResponse{
+			AuthorizationURL: authURL,
+			State:            state,
+		},
+	})
+}
+
+// setOAuthFlowCookie stores the browser nonce of a flow, or clears it when
+// expires has passed.
+func setOAuthFlowCookie(c *fiber.Ctx, browserNonce string, expires time.Time) {
+	config, _ := config.LoadConfig(".")
+	c.Cookie(&fiber.Cookie{
+		Name:     oauthFlowCookie,
+		Value:    browserNonce,
+		Path:     "/api/",
+		Expires:  expires,
+		Secure:   strings.HasPrefix(config.AppURL, "https://"),
+		HTTPOnly: true,
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+}
+
+// finishOAuthFlow checks the state of a finish request and redeems its code.
+// It writes the error response itself and returns ok=false on failure.
+func finishOAuthFlow(c *fiber.Ctx, db *gorm.DB, userID *uint) (string, oauth.Identity, bool, error) {
+	var input model.OAuthFinishInput
+	if err := c.BodyParser(&input); err != nil {
+		return "", oauth.Identity{}, false, c.Status(fiber.StatusBadRequest).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Invalid input",
+			Errors:  err.Error(),
+		})
+	}
+
+	validationErrors := validation.ValidateStruct(&input)
+	if len(validationErrors) > 0 {
+		return "", oauth.Identity{}, false, c.Status(fiber.StatusBadRequest).JSON(validationErrors)
+	}
+
+	flow, err := oauth.TakeFlow(db, input.State, c.Cookies(oauthFlowCookie), userID)
+	if errors.Is(err, oauth.ErrFlowNotFound) {
+		return "", oauth.Identity{}, false, c.Status(fiber.StatusBadRequest).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "The sign-in has expired, try again",
+			Errors:  err.Error(),
+		})
+	}
+	if err != nil {
+		return "", oauth.Identity{}, false, c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Couldn't finish sign-in",
+			Errors:  err.Error(),
+		})
+	}
+
+	setOAuthFlowCookie(c, "", time.Unix(0, 0))
+
+	provider, ok := oauth.Providers[flow.Provider]
+	if !ok {
+		return "", oauth.Identity{}, false, providerNotFound(c)
+	}
+
+	identity, err := provider.Exchange(input.Code, flow.CodeVerifier, flow.Nonce)
+	if err != nil {
+		return "", oauth.Identity{}, false, c.Status(fiber.StatusUnauthorized).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "The sign-in provider rejected the sign-in",
+			Errors:  err.Error(),
+		})
+	}
+	return flow.Provider, identity, true, nil
+}
+
+// findOrCreateOAuthUser returns the user identity signs in as. A new
+// identity is linked to the user with the same email address, or a user is
+// created for it, but only when the provider vouches for that address.
+func findOrCreateOAuthUser(db *gorm.DB, providerName string, identity oauth.Identity) (model.User, error) {
+	var user model.User
+	var revoked []string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+
+		var linked model.Identity
+		err := tx.Preload("User").Where("provider = ? AND subject = ?", providerName, identity.Subject).First(&linked).Error
+		if err == nil {
+			user = linked.User
+			return tx.Model(&linked).Updates(map[string]interface{}{
+				"email":        identity.Email,
+				"last_used_at": now,
+			}).Error
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		if identity.Email == "" {
+			return errOAuthEmailMissing
+		}
+		// Otherwise anyone could claim an address at a provider that
+		// doesn't check it, and take over or squat its account here.
+		if !identity.EmailVerified {
+			return errOAuthEmailUnverified
+		}
+
+		err = tx.Where("email = ?", identity.Email).First(&user).Error
+		switch {
+		case err == nil:
+			if user.EmailVerifiedAt == nil {
+				if revoked, err = claimUnverifiedUser(tx, &user, now); err != nil {
+					return err
+				}
+			}
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			// Users created here have no password until they reset it.
+			user = model.User{
+				Email:           identity.Email,
+				FirstName:       identity.FirstName,
+				LastName:        identity.LastName,
+				EmailVerifiedAt: &now,
+			}
+			if user.FirstName == "" {
+				user.FirstName, _, _ = strings.Cut(identity.Email, "@")
+			}
+			if err := tx.Create(&user).Error; err != nil {
+				return err
+			}
+		default:
+			return err
+		}
+
+		return tx.Create(&model.Identity{
+			UserID:     user.ID,
+			Provider:   providerName,
+			Subject:    identity.Subject,
+			Email:      identity.Email,
+			LastUsedAt: &now,
+		}).Error
+	})
+	if err == nil {
+		closeSessionSockets(revoked)
+	}
+	return user, err
+}
+
+// claimUnverifiedUser hands a user who never verified their email address
+// to whoever the provider says owns it. Anyone could have registered the
+// address, so every way in they set up is removed: the password, second
+// factors, passkeys, other identities, outstanding emailed links and
+// sessions. It returns the revoked sessions for closeSessionSockets.
+func claimUnverifiedUser(tx *gorm.DB, user *model.User, now time.Time) ([]string, error) {
+	err := tx.Model(user).UpdateColumns(map[string]interface{}{
+		"password":          "",
+		"totp_secret":       "",
+		"totp_enabled_at":   nil,
+		"totp_last_counter": 0,
+		"email_verified_at": now,
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+	user.Password = ""
+	user.TOTPSecret = ""
+	user.TOTPEnabledAt = nil
+	user.TOTPLastCounter = 0
+	user.EmailVerifiedAt = &now
+
+	for _, credential := range []interface{}{&model.RecoveryCode{}, &model.Passkey{}, &model.Identity{}} {
+		if err := tx.Where("user_id = ?", user.ID).Delete(credential).Error; err != nil {
+			return nil, err
+		}
+	}
+	for _, link := range []interface{}{&model.PasswordResetToken{}, &model.MagicLinkToken{}, &model.EmailChangeToken{}} {
+		err := tx.Model(link).Where("user_id = ? AND used_at IS NULL", user.ID).Update("used_at", now).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+	return revokeSessions(tx, "user_id = ?", user.ID)
+}
+
+// GetOAuthProviders is a handler to list the configured sign-in providers
+// @Summary List sign-in providers
+// @Description List the OAuth2 and OpenID Connect providers users can sign in with
+// @Tags oauth
+// @Accept json
+// @Produce json
+// @Success 200 {object} model.SuccessResponse{data=[]model.OAuthProviderResponse}
+// @Router /oauth/providers/ [get]
+func GetOAuthProviders(c *fiber.Ctx) error {
+	responseData := []model.OAuthProviderResponse{}
+	for _, name := range oauth.Names() {
+		responseData = append(responseData, model.OAuthProviderResponse{Name: name})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(model.SuccessResponse{
+		Status:  "success",
+		Message: "Sign-in providers found",
+		Data:    responseData,
+	})
+}
+
+// BeginOAuthLogin is a handler to start signing in with a provider
+// @Summary Begin provider sign-in
+// @Description Start signing in with an OAuth2 or OpenID Connect provider. Send the browser to authorization_url and keep state to check it against the callback. The response sets an HttpOnly oauth_flow cookie that the finish request must send back. The provider redirects back to the configured callback with code and state, which are then posted to /oauth/finish/.
+// @Tags oauth
+// @Accept json
+// @Produce json
+// @Param provider path string true "Provider name"
+// @Success 200 {object} model.SuccessResponse{data=model.OAuthBeginResponse}
+// @Failure 404 {object} model.ErrorResponse
+// @Failure 502 {object} model.ErrorResponse
+// @Router /oauth/{provider}/begin/ [post]
+func BeginOAuthLogin(c *fiber.Ctx) error {
+	return beginOAuthFlow(c, database.DB, nil)
+}
+
+// FinishOAuthLogin is a handler to log in with the code a provider redirected back with
+// @Summary Finish provider sign-in
+// @Description Exchange the code and state from the provider callback for an access and refresh token pair. On first sign-in the identity is linked to the user with the same email address, or a new user is created, provided the provider has verified the address. A user who never verified that address loses their password, second factors, passkeys, other identities and sessions first. The browser must send the oauth_flow cookie set by the begin request. When two-factor authentication is enabled, a challenge_token is returned instead, to be completed at /jwt/2fa/.
+// @Tags oauth
+// @Accept json
+// @Produce json
+// @Param input body model.OAuthFinishInput true "Code and state from the callback"
+// @Success 200 {object} model.SuccessResponse
+// @Failure 400 {object} model.ErrorResponse
+// @Failure 401 {object} model.ErrorResponse
+// @Failure 403 {object} model.ErrorResponse
+// @Failure 500 {object} model.ErrorResponse
+// @Router /oauth/finish/ [post]
+func FinishOAuthLogin(c *fiber.Ctx) error {
+	db := database.DB
+
+	providerName, identity, ok, err := finishOAuthFlow(c, db, nil)
+	if !ok {
+		return err
+	}
+
+	user, err := findOrCreateOAuthUser(db, providerName, identity)
+	if errors.Is(err, errOAuthEmailMissing) {
+		return c.Status(fiber.StatusBadRequest).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "The sign-in provider didn't share an email address",
+			Errors:  err.Error(),
+		})
+	}
+	if errors.Is(err, errOAuthEmailUnverified) {
+		return c.Status(fiber.StatusBadRequest).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "The sign-in provider hasn't verified your email address. Verify it there, or log in and link the provider from your settings",
+			Errors:  err.Error(),
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Could not login",
+			Errors:  err.Error(),
+		})
+	}
+
+	if loginDenied(user) {
+		return emailNotVerified(c)
+	}
+
+	return completeLogin(c, db, user)
+}
+
+// GetMyIdentities is a handler to list the provider identities of the current user
+// @Summary List my linked identities
+// @Description List the sign-in provider accounts linked to the current user
+// @Tags oauth
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} model.SuccessResponse{data=[]model.IdentityResponse}
+// @Failure 500 {object} model.ErrorResponse
+// @Router /users/me/identities/ [get]
+func GetMyIdentities(c *fiber.Ctx) error {
+	db := database.DB
+
+	var identities []model.Identity
+	if err := db.Where("user_id = ?", middleware.CurrentUser(c).ID).Order("created_at").Find(&identities).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Couldn't get identities",
+			Errors:  err.Error(),
+		})
+	}
+
+	responseData := []model.IdentityResponse{}
+	for _, identity := range identities {
+		responseData = append(responseData, utils.IdentityToResponse(identity))
+	}
+
+	return c.Status(fiber.StatusOK).JSON(model.SuccessResponse{
+		Status:  "success",
+		Message: "Identities found",
+		Data:    responseData,
+	})
+}
+
+// BeginIdentityLink is a handler to start linking a provider account
+// @Summary Begin linking an identity
+// @Description Start linking an OAuth2 or OpenID Connect provider account to the current user. Works like /oauth/{provider}/begin/, but the callback's code and state are posted to /users/me/identities/finish/.
+// @Tags oauth
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param provider path string true "Provider name"
+// @Success 200 {object} model.SuccessResponse{data=model.OAuthBeginResponse}
+// @Failure 404 {object} model.ErrorResponse
+// @Failure 502 {object} model.ErrorResponse
+// @Router /users/me/identities/{provider}/begin/ [post]
+func BeginIdentityLink(c *fiber.Ctx) error {
+	userID := middleware.CurrentUser(c).ID
+	return beginOAuthFlow(c, database.DB, &userID)
+}
+
+// FinishIdentityLink is a handler to link a provider account with the code it redirected back with
+// @Summary Finish linking an identity
+// @Description Link the provider account that signed in at the provider to the current user. The flow must have been started by the same user in the same browser.
+// @Tags oauth
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param input body model.OAuthFinishInput true "Code and state from the callback"
+// @Success 201 {object} model.SuccessResponse{data=model.IdentityResponse}
+// @Failure 400 {object} model.ErrorResponse
+// @Failure 401 {object} model.ErrorResponse
+// @Failure 500 {object} model.ErrorResponse
+// @Router /users/me/identities/finish/ [post]
+func FinishIdentityLink(c *fiber.Ctx) error {
+	db := database.DB
+	userID := middleware.CurrentUser(c).ID
+
+	providerName, identity, ok, err := finishOAuthFlow(c, db, &userID)
+	if !ok {
+		return err
+	}
+
+	now := time.Now()
+	linked := model.Identity{
+		UserID:     userID,
+		Provider:   providerName,
+		Subject:    identity.Subject,
+		Email:      identity.Email,
+		LastUsedAt: &now,
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var existing model.Identity
+		err := tx.Where("provider = ? AND (subject = ? OR user_id = ?)", providerName, identity.Subject, userID).First(&existing).Error
+		if err == nil && existing.UserID != userID {
+			return errIdentityTaken
+		}
+		if err == nil {
+			return errIdentityExists
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		return tx.Create(&linked).Error
+	})
+	if errors.Is(err, errIdentityTaken) {
+		return c.Status(fiber.StatusBadRequest).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "This account is already linked to another user",
+			Errors:  err.Error(),
+		})
+	}
+	if errors.Is(err, errIdentityExists) {
+		return c.Status(fiber.StatusBadRequest).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "An account at this provider is already linked",
+			Errors:  err.Error(),
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Couldn't link identity",
+			Errors:  err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(model.SuccessResponse{
+		Status:  "success",
+		Message: "Identity linked",
+		Data:    utils.IdentityToResponse(linked),
+	})
+}
+
+// UnlinkIdentity is a handler to unlink a provider account from the current user
+// @Summary Unlink an identity
+// @Description Unlink a sign-in provider account from the current user. The last identity of a user without a password or passkey can't be unlinked.
+// @Tags oauth
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Identity ID"
+// @Success 200 {object} model.SuccessResponse
+// @Failure 400 {object} model.ErrorResponse
+// @Failure 404 {object} model.ErrorResponse
+// @Failure 500 {object} model.ErrorResponse
+// @Router /users/me/identities/{id}/ [delete]
+func UnlinkIdentity(c *fiber.Ctx) error {
+	db := database.DB
+	user := middleware.CurrentUser(c)
+
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Invalid identity ID",
+			Errors:  err.Error(),
+		})
+	}
+
+	var identity model.Identity
+	if err := db.Where("id = ? AND user_id = ?", id, user.ID).First(&identity).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Identity not found",
+			Errors:  err.Error(),
+		})
+	}
+
+	if user.Password == "" {
+		var others, passkeys int64
+		db.Model(&model.Identity{}).Where("user_id = ? AND id <> ?", user.ID, identity.ID).Count(&others)
+		db.Model(&model.Passkey{}).Where("user_id = ?", user.ID).Count(&passkeys)
+		if others == 0 && passkeys == 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(model.ErrorResponse{
+				Status:  "error",
+				Message: "Set a password before unlinking your last sign-in method",
+				Errors:  "Last sign-in method",
+			})
+		}
+	}
+
+	if err := db.Delete(&identity).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Couldn't unlink identity",
+			Errors:  err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(model.SuccessResponse{
+		Status:  "success",
+		Message: "Identity unlinked",
+		Data:    nil,
+	})
+}
@@ -0,0 +1,389 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/kazimovzaman2/Go-jwt-gorm/config"
+	"github.com/kazimovzaman2/Go-jwt-gorm/model"
+	"github.com/kazimovzaman2/Go-jwt-gorm/oauth"
+	"github.com/kazimovzaman2/Go-jwt-gorm/oauth/oauthtest"
+	"github.com/kazimovzaman2/Go-jwt-gorm/utils"
+	"golang.org/x/oauth2"
+	"gorm.io/gorm"
+)
+
+// oauthTest signs in through the handlers against a mock provider.
+type oauthTest struct {
+	t      *testing.T
+	db     *gorm.DB
+	app    *fiber.App
+	server *oauthtest.Server
+}
+
+func newOAuthTest(t *testing.T) *oauthTest {
+	t.Helper()
+
+	db := setupTestDB(t)
+
+	server, err := oauthtest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(server.Close)
+
+	provider, err := oauth.NewProvider("mock", config.OAuthProviderConfig{
+		Issuer:       server.Issuer(),
+		ClientID:     server.ClientID,
+		ClientSecret: server.ClientSecret,
+		Scopes:       []string{"openid", "email", "profile"},
+	}, "http://localhost:3000/oauth/callback")
+	if err != nil {
+		t.Fatal(err)
+	}
+	oauth.Providers["mock"] = provider
+	t.Cleanup(func() { delete(oauth.Providers, "mock") })
+
+	app := fiber.New()
+	app.Post("/api/oauth/:provider/begin/", BeginOAuthLogin)
+	app.Post("/api/oauth/finish/", FinishOAuthLogin)
+
+	return &oauthTest{t: t, db: db, app: app, server: server}
+}
+
+// account returns a provider account no other test uses.
+func (o *oauthTest) account(emailVerified bool) oauthtest.Account {
+	id := testID(o.t)
+	return oauthtest.Account{
+		Subject:       id,
+		Email:         id + "@example.com",
+		EmailVerified: emailVerified,
+		GivenName:     "Ada",
+		FamilyName:    "Lovelace",
+	}
+}
+
+// begin starts a login and returns the flow's state and browser cookie,
+// along with the code the provider redirects back with for account.
+func (o *oauthTest) begin(account oauthtest.Account) (string, string, *http.Cookie) {
+	o.t.Helper()
+
+	response := request(o.t, o.app, fiber.MethodPost, "/api/oauth/mock/begin/", nil)
+	if response.status != fiber.StatusOK {
+		o.t.Fatalf("begin returned status %d", response.status)
+	}
+	var begin model.OAuthBeginResponse
+	if err := json.Unmarshal(response.Data, &begin); err != nil {
+		o.t.Fatal(err)
+	}
+
+	var cookie *http.Cookie
+	for _, c := range response.cookies {
+		if c.Name == oauthFlowCookie {
+			cookie = c
+		}
+	}
+	if cookie == nil || cookie.Value == "" || !cookie.HttpOnly {
+		o.t.Fatalf("begin didn't set an HttpOnly %s cookie", oauthFlowCookie)
+	}
+
+	code, state, err := o.server.SignIn(begin.AuthorizationURL, account)
+	if err != nil {
+		o.t.Fatal(err)
+	}
+	if state != begin.State {
+		o.t.Fatalf("provider returned state %q, want %q", state, begin.State)
+	}
+	return code, state, cookie
+}
+
+func (o *oauthTest) finish(code, state string, cookies ...*http.Cookie) testResponse {
+	o.t.Helper()
+	return request(o.t, o.app, fiber.MethodPost, "/api/oauth/finish/", model.OAuthFinishInput{Code: code, State: state}, cookies...)
+}
+
+func (o *oauthTest) login(account oauthtest.Account) testResponse {
+	o.t.Helper()
+	code, state, cookie := o.begin(account)
+	return o.finish(code, state, cookie)
+}
+
+// identityUser returns the ID of the user account is linked to, or 0.
+func (o *oauthTest) identityUser(account oauthtest.Account) uint {
+	o.t.Helper()
+
+	var identity model.Identity
+	err := o.db.Where("provider = ? AND subject = ?", "mock", account.Subject).Limit(1).Find(&identity).Error
+	if err != nil {
+		o.t.Fatal(err)
+	}
+	return identity.UserID
+}
+
+func (o *oauthTest) createUser(email string) model.User {
+	o.t.Helper()
+
+	user := model.User{Email: email, FirstName: "Ada", LastName: "Lovelace"}
+	if err := o.db.Create(&user).Error; err != nil {
+		o.t.Fatal(err)
+	}
+	return user
+}
+
+func expectLoggedIn(t *testing.T, response testResponse) {
+	t.Helper()
+
+	var tokens struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	json.Unmarshal(response.Data, &tokens)
+	if response.status != fiber.StatusOK || tokens.AccessToken == "" || tokens.RefreshToken == "" {
+		t.Fatalf("login returned status %d and %s, want tokens", response.status, response.Data)
+	}
+}
+
+func TestOAuthLoginCreatesUser(t *testing.T) {
+	o := newOAuthTest(t)
+	account := o.account(true)
+
+	expectLoggedIn(t, o.login(account))
+
+	var user model.User
+	if err := o.db.Where("email = ?", account.Email).First(&user).Error; err != nil {
+		t.Fatalf("user wasn't created: %s", err)
+	}
+	if user.EmailVerifiedAt == nil || user.Password != "" {
+		t.Fatal("created user should be verified and have no password")
+	}
+	if userID := o.identityUser(account); userID != user.ID {
+		t.Fatalf("identity is linked to user %d, want %d", userID, user.ID)
+	}
+
+	// The next login finds the same user.
+	expectLoggedIn(t, o.login(account))
+	var count int64
+	o.db.Model(&model.User{}).Where("email = ?", account.Email).Count(&count)
+	if count != 1 {
+		t.Fatalf("%d users with the email, want 1", count)
+	}
+}
+
+func TestOAuthLoginLinksExistingUser(t *testing.T) {
+	o := newOAuthTest(t)
+	account := o.account(true)
+	user := o.createUser(account.Email)
+
+	expectLoggedIn(t, o.login(account))
+
+	if userID := o.identityUser(account); userID != user.ID {
+		t.Fatalf("identity is linked to user %d, want %d", userID, user.ID)
+	}
+	o.db.First(&user, user.ID)
+	if user.EmailVerifiedAt == nil {
+		t.Fatal("linking a verified provider email didn't verify the user")
+	}
+}
+
+func TestOAuthLoginClaimsUnverifiedUser(t *testing.T) {
+	o := newOAuthTest(t)
+	o.app.Post("/api/jwt/create/", Login)
+
+	tests := []struct {
+		name          string
+		emailVerified bool
+		wantKept      bool
+	}{
+		// Anyone could have registered the address, so the provider's
+		// user gets it without whatever they set up.
+		{"unverified user", false, false},
+		{"verified user", true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			account := o.account(true)
+			user := o.createUser(account.Email)
+			hash, err := hashPassword("squatter's password")
+			if err != nil {
+				t.Fatal(err)
+			}
+			updates := map[string]interface{}{"password": hash}
+			if tt.emailVerified {
+				updates["email_verified_at"] = time.Now()
+			}
+			if err := o.db.Model(&user).Updates(updates).Error; err != nil {
+				t.Fatal(err)
+			}
+			session := model.Session{ID: testID(t), UserID: user.ID, LastUsedAt: time.Now()}
+			rows := []interface{}{
+				&session,
+				&model.Passkey{UserID: user.ID, Name: "Squatter's key", CredentialID: []byte(testID(t)), Credential: "{}"},
+				&model.Identity{UserID: user.ID, Provider: "other", Subject: testID(t)},
+				&model.MagicLinkToken{UserID: user.ID, TokenHash: testID(t), ExpiresAt: time.Now().Add(time.Hour)},
+				&model.EmailChangeToken{UserID: user.ID, NewEmail: testID(t) + "@example.com", TokenHash: testID(t), ExpiresAt: time.Now().Add(time.Hour)},
+			}
+			for _, row := range rows {
+				if err := o.db.Create(row).Error; err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			expectLoggedIn(t, o.login(account))
+			if userID := o.identityUser(account); userID != user.ID {
+				t.Fatalf("identity is linked to user %d, want %d", userID, user.ID)
+			}
+
+			response := request(t, o.app, fiber.MethodPost, "/api/jwt/create/", model.LoginInput{
+				Email:    account.Email,
+				Password: "squatter's password",
+			})
+			if kept := response.status == fiber.StatusOK; kept != tt.wantKept {
+				t.Fatalf("password login returned status %d, want the password kept: %v", response.status, tt.wantKept)
+			}
+
+			if err := o.db.First(&session, "id = ?", session.ID).Error; err != nil {
+				t.Fatal(err)
+			}
+			if kept := session.RevokedAt == nil; kept != tt.wantKept {
+				t.Fatalf("session revoked at %v, want it kept: %v", session.RevokedAt, tt.wantKept)
+			}
+			counts := []struct {
+				model interface{}
+				query string
+			}{
+				{&model.Passkey{}, "user_id = ?"},
+				{&model.Identity{}, "user_id = ? AND provider = 'other'"},
+				{&model.MagicLinkToken{}, "user_id = ? AND used_at IS NULL"},
+				{&model.EmailChangeToken{}, "user_id = ? AND used_at IS NULL"},
+			}
+			for _, count := range counts {
+				var n int64
+				if err := o.db.Model(count.model).Where(count.query, user.ID).Count(&n).Error; err != nil {
+					t.Fatal(err)
+				}
+				if kept := n == 1; kept != tt.wantKept {
+					t.Fatalf("%T rows matching %q: %d, want them kept: %v", count.model, count.query, n, tt.wantKept)
+				}
+			}
+		})
+	}
+}
+
+func TestOAuthLoginRefusesUnverifiedEmail(t *testing.T) {
+	tests := []struct {
+		name         string
+		existingUser bool
+	}{
+		{"new user", false},
+		{"existing user", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := newOAuthTest(t)
+			account := o.account(false)
+			if tt.existingUser {
+				o.createUser(account.Email)
+			}
+
+			if response := o.login(account); response.status != fiber.StatusBadRequest {
+				t.Fatalf("login returned status %d, want %d", response.status, fiber.StatusBadRequest)
+			}
+
+			if userID := o.identityUser(account); userID != 0 {
+				t.Fatalf("identity was linked to user %d", userID)
+			}
+			var count int64
+			o.db.Model(&model.User{}).Where("email = ?", account.Email).Count(&count)
+			if want := map[bool]int64{false: 0, true: 1}[tt.existingUser]; count != want {
+				t.Fatalf("%d users with the email, want %d", count, want)
+			}
+		})
+	}
+}
+
+func TestOAuthLoginRejectsReplayedState(t *testing.T) {
+	o := newOAuthTest(t)
+	account := o.account(true)
+
+	code, state, cookie := o.begin(account)
+	expectLoggedIn(t, o.finish(code, state, cookie))
+
+	if response := o.finish(code, state, cookie); response.status != fiber.StatusBadRequest {
+		t.Fatalf("replayed finish returned status %d, want %d", response.status, fiber.StatusBadRequest)
+	}
+}
+
+func TestOAuthLoginRequiresBrowserCookie(t *testing.T) {
+	o := newOAuthTest(t)
+	account := o.account(true)
+
+	code, state, cookie := o.begin(account)
+	_, _, otherCookie := o.begin(o.account(true))
+
+	// An attacker who plants their own code and state in a victim's browser
+	// doesn't have the cookie of the browser that began the flow.
+	if response := o.finish(code, state); response.status != fiber.StatusBadRequest {
+		t.Fatalf("finish without the cookie returned status %d, want %d", response.status, fiber.StatusBadRequest)
+	}
+	if response := o.finish(code, state, otherCookie); response.status != fiber.StatusBadRequest {
+		t.Fatalf("finish with another flow's cookie returned status %d, want %d", response.status, fiber.StatusBadRequest)
+	}
+
+	// Neither attempt used up the flow.
+	expectLoggedIn(t, o.finish(code, state, cookie))
+}
+
+func TestOAuthLoginChecksPKCEAndNonce(t *testing.T) {
+	tests := []struct {
+		name   string
+		column string
+	}{
+		{"PKCE verifier", "code_verifier"},
+		{"nonce", "nonce"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := newOAuthTest(t)
+			account := o.account(true)
+
+			code, state, cookie := o.begin(account)
+			// Stand in for a code or ID token issued to another flow.
+			err := o.db.Model(&model.OAuthFlow{}).
+				Where("state_hash = ?", utils.HashOpaqueToken(state)).
+				Update(tt.column, oauth2.GenerateVerifier()).Error
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if response := o.finish(code, state, cookie); response.status != fiber.StatusUnauthorized {
+				t.Fatalf("finish returned status %d, want %d", response.status, fiber.StatusUnauthorized)
+			}
+			if userID := o.identityUser(account); userID != 0 {
+				t.Fatalf("identity was linked to user %d", userID)
+			}
+		})
+	}
+}
+
+func TestOAuthFlowExpires(t *testing.T) {
+	o := newOAuthTest(t)
+	account := o.account(true)
+
+	code, state, cookie := o.begin(account)
+	err := o.db.Model(&model.OAuthFlow{}).
+		Where("state_hash = ?", utils.HashOpaqueToken(state)).
+		Update("expires_at", time.Now().Add(-time.Second)).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if response := o.finish(code, state, cookie); response.status != fiber.StatusBadRequest {
+		t.Fatalf("finish of an expired flow returned status %d, want %d", response.status, fiber.StatusBadRequest)
+	}
+}
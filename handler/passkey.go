@@ -0,0 +1,443 @@
+package handler
+
+import (
+	"bytes"
+	"errors"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/gofiber/fiber/v2"
+	"github.com/kazimovzaman2/Go-jwt-gorm/database"
+	"github.com/kazimovzaman2/Go-jwt-gorm/middleware"
+	"github.com/kazimovzaman2/Go-jwt-gorm/model"
+	"github.com/kazimovzaman2/Go-jwt-gorm/passkey"
+	"github.com/kazimovzaman2/Go-jwt-gorm/utils"
+	"github.com/kazimovzaman2/Go-jwt-gorm/validation"
+	"gorm.io/gorm"
+)
+
+// loadPasskeyUser loads userID together with its passkeys.
+func loadPasskeyUser(db *gorm.DB, userID uint) (*passkey.User, []model.Passkey, error) {
+	var user model.User
+	if err := db.First(&user, userID).Error; err != nil {
+		return nil, nil, err
+	}
+
+	var passkeys []model.Passkey
+	if err := db.Where("user_id = ?", userID).Order("id").Find(&passkeys).Error; err != nil {
+		return nil, nil, err
+	}
+
+	webauthnUser, err := passkey.NewUser(user, passkeys)
+	return webauthnUser, passkeys, err
+}
+
+// loadPasskey finds the passkey in the :id param owned by the current user.
+func loadPasskey(c *fiber.Ctx, db *gorm.DB) (model.Passkey, int, *model.ErrorResponse) {
+	var found model.Passkey
+
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return found, fiber.StatusBadRequest, &model.ErrorResponse{
+			Status:  "error",
+			Message: "Invalid passkey ID",
+			Errors:  err.Error(),
+		}
+	}
+
+	if err := db.Where("id = ? AND user_id = ?", id, middleware.CurrentUser(c).ID).First(&found).Error; err != nil {
+		return found, fiber.StatusNotFound, &model.ErrorResponse{
+			Status:  "error",
+			Message: "Passkey not found",
+			Errors:  err.Error(),
+		}
+	}
+	return found, 0, nil
+}
+
+// GetMyPasskeys is a handler to list the current user's passkeys
+// @Summary Get my passkeys
+// @Description List the passkeys registered by the current user
+// @Tags passkey
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} model.SuccessResponse{data=[]model.PasskeyResponse}
+// @Failure 500 {object} model.ErrorResponse
+// @Router /users/me/passkeys/ [get]
+func GetMyPasskeys(c *fiber.Ctx) error {
+	db := database.DB
+
+	var passkeys []model.Passkey
+	if err := db.Where("user_id = ?", middleware.CurrentUser(c).ID).Order("id").Find(&passkeys).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Couldn't load passkeys",
+			Errors:  err.Error(),
+		})
+	}
+
+	responseData := make([]model.PasskeyResponse, 0, len(passkeys))
+	for _, found := range passkeys {
+		responseData = append(responseData, utils.PasskeyToResponse(found))
+	}
+
+	return c.Status(fiber.StatusOK).JSON(model.SuccessResponse{
+		Status:  "success",
+		Message: "Passkeys found",
+		Data:    responseData,
+	})
+}
+
+// BeginPasskeyRegistration is a handler to start registering a passkey
+// @Summary Begin passkey registration
+// @Description Get the options to pass to navigator.credentials.create(). Finish within five minutes at /users/me/passkeys/register/finish/.
+// @Tags passkey
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} model.SuccessResponse{data=model.PasskeyOptionsResponse}
+// @Failure 404 {object} model.ErrorResponse
+// @Failure 500 {object} model.ErrorResponse
+// @Router /users/me/passkeys/register/begin/ [post]
+func BeginPasskeyRegistration(c *fiber.Ctx) error {
+	db := database.DB
+	userID := middleware.CurrentUser(c).ID
+
+	webauthnUser, _, err := loadPasskeyUser(db, userID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "User not found",
+			Errors:  err.Error(),
+		})
+	}
+
+	// Passkeys must be discoverable so that login works without an email,
+	// and registering the same authenticator twice is refused.
+	exclude := make([]protocol.CredentialDescriptor, 0, len(webauthnUser.Credentials))
+	for _, credential := range webauthnUser.Credentials {
+		exclude = append(exclude, credential.Descriptor())
+	}
+	options, session, err := passkey.WebAuthn.BeginRegistration(webauthnUser,
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementRequired),
+		webauthn.WithExclusions(exclude),
+	)
+	var ceremonyID string
+	if err == nil {
+		ceremonyID, err = passkey.SaveCeremony(db, model.PasskeyCeremonyRegistration, &userID, session)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Couldn't start passkey registration",
+			Errors:  err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(model.SuccessResponse{
+		Status:  "success",
+		Message: "Passkey registration started",
+		Data: model.PasskeyOptionsResponse{
+			CeremonyID: ceremonyID,
+			Options:    options,
+		},
+	})
+}
+
+// FinishPasskeyRegistration is a handler to store a new passkey
+// @Summary Finish passkey registration
+// @Description Verify the result of navigator.credentials.create() and store the passkey under the given name
+// @Tags passkey
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param input body model.RegisterPasskeyInput true "Ceremony, name and credential"
+// @Success 201 {object} model.SuccessResponse{data=model.PasskeyResponse}
+// @Failure 400 {object} model.ErrorResponse
+// @Failure 404 {object} model.ErrorResponse
+// @Failure 500 {object} model.ErrorResponse
+// @Router /users/me/passkeys/register/finish/ [post]
+func FinishPasskeyRegistration(c *fiber.Ctx) error {
+	db := database.DB
+	userID := middleware.CurrentUser(c).ID
+
+	var input model.RegisterPasskeyInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Invalid input",
+			Errors:  err.Error(),
+		})
+	}
+
+	validationErrors := validation.ValidateStruct(&input)
+	if len(validationErrors) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(validationErrors)
+	}
+
+	session, err := passkey.TakeCeremony(db, input.CeremonyID, model.PasskeyCeremonyRegistration, &userID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Passkey registration expired, start again",
+			Errors:  err.Error(),
+		})
+	}
+
+	webauthnUser, _, err := loadPasskeyUser(db, userID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "User not found",
+			Errors:  err.Error(),
+		})
+	}
+
+	credential, err := passkey.FinishRegistration(webauthnUser, session, input.Credential)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Invalid passkey",
+			Errors:  err.Error(),
+		})
+	}
+
+	encoded, err := passkey.EncodeCredential(*credential)
+	created := model.Passkey{
+		UserID:       userID,
+		Name:         input.Name,
+		CredentialID: credential.ID,
+		Credential:   encoded,
+	}
+	if err == nil {
+		err = db.Create(&created).Error
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Couldn't save passkey",
+			Errors:  err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(model.SuccessResponse{
+		Status:  "success",
+		Message: "Passkey registered",
+		Data:    utils.PasskeyToResponse(created),
+	})
+}
+
+// RenamePasskey is a handler to rename a passkey
+// @Summary Rename a passkey
+// @Description Rename one of the current user's passkeys
+// @Tags passkey
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Passkey ID"
+// @Param input body model.RenamePasskeyInput true "New name"
+// @Success 200 {object} model.SuccessResponse{data=model.PasskeyResponse}
+// @Failure 400 {object} model.ErrorResponse
+// @Failure 404 {object} model.ErrorResponse
+// @Failure 500 {object} model.ErrorResponse
+// @Router /users/me/passkeys/{id}/ [patch]
+func RenamePasskey(c *fiber.Ctx) error {
+	db := database.DB
+
+	found, status, errResp := loadPasskey(c, db)
+	if errResp != nil {
+		return c.Status(status).JSON(errResp)
+	}
+
+	var input model.RenamePasskeyInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Invalid input",
+			Errors:  err.Error(),
+		})
+	}
+
+	validationErrors := validation.ValidateStruct(&input)
+	if len(validationErrors) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(validationErrors)
+	}
+
+	if err := db.Model(&found).Update("name", input.Name).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Couldn't rename passkey",
+			Errors:  err.Error(),
+		})
+	}
+	found.Name = input.Name
+
+	return c.Status(fiber.StatusOK).JSON(model.SuccessResponse{
+		Status:  "success",
+		Message: "Passkey renamed",
+		Data:    utils.PasskeyToResponse(found),
+	})
+}
+
+// DeletePasskey is a handler to revoke a passkey
+// @Summary Delete a passkey
+// @Description Revoke one of the current user's passkeys. It can't be used to log in anymore.
+// @Tags passkey
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Passkey ID"
+// @Success 200 {object} model.SuccessResponse
+// @Failure 400 {object} model.ErrorResponse
+// @Failure 404 {object} model.ErrorResponse
+// @Failure 500 {object} model.ErrorResponse
+// @Router /users/me/passkeys/{id}/ [delete]
+func DeletePasskey(c *fiber.Ctx) error {
+	db := database.DB
+
+	found, status, errResp := loadPasskey(c, db)
+	if errResp != nil {
+		return c.Status(status).JSON(errResp)
+	}
+
+	if err := db.Delete(&found).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Couldn't delete passkey",
+			Errors:  err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(model.SuccessResponse{
+		Status:  "success",
+		Message: "Passkey deleted",
+		Data:    nil,
+	})
+}
+
+// BeginPasskeyLogin is a handler to start logging in with a passkey
+// @Summary Begin passkey login
+// @Description Get the options to pass to navigator.credentials.get(). No email is needed; the authenticator offers the user's passkeys. Finish within five minutes at /jwt/passkey/finish/.
+// @Tags jwt
+// @Accept json
+// @Produce json
+// @Success 200 {object} model.SuccessResponse{data=model.PasskeyOptionsResponse}
+// @Failure 500 {object} model.ErrorResponse
+// @Router /jwt/passkey/begin/ [post]
+func BeginPasskeyLogin(c *fiber.Ctx) error {
+	db := database.DB
+
+	options, session, err := passkey.WebAuthn.BeginDiscoverableLogin()
+	var ceremonyID string
+	if err == nil {
+		ceremonyID, err = passkey.SaveCeremony(db, model.PasskeyCeremonyLogin, nil, session)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Couldn't start passkey login",
+			Errors:  err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(model.SuccessResponse{
+		Status:  "success",
+		Message: "Passkey login started",
+		Data: model.PasskeyOptionsResponse{
+			CeremonyID: ceremonyID,
+			Options:    options,
+		},
+	})
+}
+
+// FinishPasskeyLogin is a handler to log in with a passkey
+// @Summary Finish passkey login
+// @Description Verify the result of navigator.credentials.get() and return the access and refresh tokens. When two-factor authentication is enabled, a challenge_token is returned instead, to be completed at /jwt/2fa/.
+// @Tags jwt
+// @Accept json
+// @Produce json
+// @Param input body model.PasskeyLoginInput true "Ceremony and assertion"
+// @Success 200 {object} model.SuccessResponse
+// @Failure 400 {object} model.ErrorResponse
+// @Failure 401 {object} model.ErrorResponse
+// @Failure 403 {object} model.ErrorResponse
+// @Failure 500 {object} model.ErrorResponse
+// @Router /jwt/passkey/finish/ [post]
+func FinishPasskeyLogin(c *fiber.Ctx) error {
+	db := database.DB
+
+	var input model.PasskeyLoginInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Invalid input",
+			Errors:  err.Error(),
+		})
+	}
+
+	validationErrors := validation.ValidateStruct(&input)
+	if len(validationErrors) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(validationErrors)
+	}
+
+	session, err := passkey.TakeCeremony(db, input.CeremonyID, model.PasskeyCeremonyLogin, nil)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Passkey login expired, start again",
+			Errors:  err.Error(),
+		})
+	}
+
+	var webauthnUser *passkey.User
+	var passkeys []model.Passkey
+	findUser := func(rawID, userHandle []byte) (webauthn.User, error) {
+		userID, ok := passkey.UserIDFromHandle(userHandle)
+		if !ok {
+			return nil, errors.New("unknown user handle")
+		}
+		var loadErr error
+		webauthnUser, passkeys, loadErr = loadPasskeyUser(db, userID)
+		return webauthnUser, loadErr
+	}
+
+	credential, err := passkey.FinishLogin(findUser, session, input.Credential)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Passkey not recognized",
+			Errors:  err.Error(),
+		})
+	}
+
+	// Store the new signature counter so a cloned authenticator shows up.
+	encoded, err := passkey.EncodeCredential(*credential)
+	if err == nil {
+		for _, found := range passkeys {
+			if bytes.Equal(found.CredentialID, credential.ID) {
+				err = db.Model(&found).Updates(map[string]interface{}{
+					"credential":   encoded,
+					"last_used_at": time.Now(),
+				}).Error
+				break
+			}
+		}
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Could not login",
+			Errors:  err.Error(),
+		})
+	}
+
+	if loginDenied(webauthnUser.User) {
+		return emailNotVerified(c)
+	}
+
+	// A passkey stands in for the password only; a second factor, when
+	// turned on, is still asked for.
+	return completeLogin(c, db, webauthnUser.User)
+}
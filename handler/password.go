@@ -0,0 +1,352 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/kazimovzaman2/Go-jwt-gorm/config"
+	"github.com/kazimovzaman2/Go-jwt-gorm/database"
+	"github.com/kazimovzaman2/Go-jwt-gorm/mailer"
+	"github.com/kazimovzaman2/Go-jwt-gorm/middleware"
+	"github.com/kazimovzaman2/Go-jwt-gorm/model"
+	"github.com/kazimovzaman2/Go-jwt-gorm/utils"
+	"github.com/kazimovzaman2/Go-jwt-gorm/validation"
+	"gorm.io/gorm"
+)
+
+const passwordResetTTL = time.Hour
+
+var errResetTokenInvalid = errors.New("reset token is invalid or expired")
+
+// sendMail delivers message in the background so that slow mail servers
+// don't hold up the request, and response times don't reveal whether an
+// address is registered.
+func sendMail(message mailer.Message) {
+	go func() {
+		if err := mailer.DefaultMailer.Send(message); err != nil {
+			log.Printf("Failed to send %q to %s: %s", message.Subject, message.To, err)
+		}
+	}()
+}
+
+// sendPasswordResetEmail stores a new reset token for user and emails the
+// link to them. forced is set when an admin reset the password, which the
+// user can't ignore.
+func sendPasswordResetEmail(db *gorm.DB, user model.User, forced bool) error {
+	token, tokenHash, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	err = db.Create(&model.PasswordResetToken{
+		UserID:    user.ID,
+		TokenHash: tokenHash,
+		ExpiresAt: time.Now().Add(passwordResetTTL),
+	}).Error
+	if err != nil {
+		return err
+	}
+
+	body := "Hi %s,\n\nOpen the link below to choose a new password. It expires in one hour.\n\n%s/reset-password?token=%s\n\nIf you didn't ask for this, you can ignore this email."
+	if forced {
+		body = "Hi %s,\n\nAn administrator has reset your password and signed you out everywhere. Open the link below to choose a new one. It expires in one hour; after that, request a new link from the sign-in page.\n\n%s/reset-password?token=%s"
+	}
+
+	config, _ := config.LoadConfig(".")
+	sendMail(mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body:    fmt.Sprintf(body, user.FirstName, config.AppURL, token),
+	})
+	return nil
+}
+
+// RequestPasswordReset is a handler to email a password reset link
+// @Summary Request a password reset
+// @Description Email a single-use password reset link, valid for one hour. The response is the same whether or not the address is registered. Requests are rate limited per address and per client.
+// @Tags password
+// @Accept json
+// @Produce json
+// @Param input body model.PasswordResetRequestInput true "Account email"
+// @Success 200 {object} model.SuccessResponse
+// @Failure 400 {object} model.ErrorResponse
+// @Failure 429 {object} model.ErrorResponse
+// @Failure 500 {object} model.ErrorResponse
+// @Router /password/reset/ [post]
+func RequestPasswordReset(c *fiber.Ctx) error {
+	db := database.DB
+
+	var input model.PasswordResetRequestInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Invalid input",
+			Errors:  err.Error(),
+		})
+	}
+
+	validationErrors := validation.ValidateStruct(&input)
+	if len(validationErrors) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(validationErrors)
+	}
+
+	wait, err := throttleLinkRequest(db, "password-reset", input.Email, c.IP())
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Couldn't request password reset",
+			Errors:  err.Error(),
+		})
+	}
+	if wait > 0 {
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(wait.Seconds())+1))
+		return c.Status(fiber.StatusTooManyRequests).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Too many reset links requested, try again later",
+			Errors:  "Too many requests",
+		})
+	}
+
+	// The lookup runs after the response, so its timing doesn't reveal
+	// whether the address is registered.
+	email := input.Email
+	go func() {
+		var user model.User
+		err := db.Where("email = ?", email).First(&user).Error
+		if err == nil {
+			err = sendPasswordResetEmail(db, user, false)
+		}
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("Failed to send password reset link: %s", err)
+		}
+	}()
+
+	return c.Status(fiber.StatusOK).JSON(model.SuccessResponse{
+		Status:  "success",
+		Message: "If the address is registered, a reset link has been sent",
+		Data:    nil,
+	})
+}
+
+// ConfirmPasswordReset is a handler to set a new password with a reset token
+// @Summary Confirm a password reset
+// @Description Set a new password using the token from the reset email. The token can be used once, every existing session of the user is signed out, and unused sign-in links stop working.
+// @Tags password
+// @Accept json
+// @Produce json
+// @Param input body model.PasswordResetConfirmInput true "Reset token and new password"
+// @Success 200 {object} model.SuccessResponse
+// @Failure 400 {object} model.ErrorResponse
+// @Failure 500 {object} model.ErrorResponse
+// @Router /password/reset/confirm/ [post]
+func ConfirmPasswordReset(c *fiber.Ctx) error {
+	db := database.DB
+
+	var input model.PasswordResetConfirmInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Invalid input",
+			Errors:  err.Error(),
+		})
+	}
+
+	validationErrors := validation.ValidateStruct(&input)
+	if len(validationErrors) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(validationErrors)
+	}
+
+	hash, err := hashPassword(input.Password)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Couldn't hash password",
+			Errors:  err.Error(),
+		})
+	}
+
+	var revoked []string
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var resetToken model.PasswordResetToken
+		err := tx.Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", utils.HashOpaqueToken(input.Token), time.Now()).
+			First(&resetToken).Error
+		if err != nil {
+			return errResetTokenInvalid
+		}
+
+		// Using one link burns every other outstanding link of the user.
+		result := tx.Model(&model.PasswordResetToken{}).
+			Where("user_id = ? AND used_at IS NULL", resetToken.UserID).
+			Update("used_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errResetTokenInvalid
+		}
+
+		err = tx.Model(&model.User{}).Where("id = ?", resetToken.UserID).Updates(map[string]interface{}{
+			"password":                hash,
+			"password_reset_required": false,
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		// Nor can sign-in links sent before the reset get around it.
+		err = tx.Model(&model.MagicLinkToken{}).
+			Where("user_id = ? AND used_at IS NULL", resetToken.UserID).
+			Update("used_at", time.Now()).Error
+		if err != nil {
+			return err
+		}
+		revoked, err = revokeSessions(tx, "user_id = ?", resetToken.UserID)
+		return err
+	})
+	if errors.Is(err, errResetTokenInvalid) {
+		return c.Status(fiber.StatusBadRequest).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Invalid or expired reset link",
+			Errors:  err.Error(),
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Couldn't reset password",
+			Errors:  err.Error(),
+		})
+	}
+	closeSessionSockets(revoked)
+
+	return c.Status(fiber.StatusOK).JSON(model.SuccessResponse{
+		Status:  "success",
+		Message: "Password has been reset",
+		Data:    nil,
+	})
+}
+
+// checkCurrentPassword confirms a sensitive change with the user's password.
+// Wrong guesses count as failed logins, so a stolen access token can't be
+// used to find out the password. It writes the error response itself and
+// returns ok=false on failure.
+func checkCurrentPassword(c *fiber.Ctx, db *gorm.DB, user model.User, password string) (bool, error) {
+	wait, err := loginLockedFor(db, accountThrottleKey(user.Email), ipThrottleKey(c.IP()))
+	if err != nil {
+		return false, c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Couldn't check password",
+			Errors:  err.Error(),
+		})
+	}
+	if wait > 0 {
+		return false, tooManyLoginAttempts(c, wait)
+	}
+
+	if ok, _ := checkPassword(password, user.Password); !ok {
+		if err := recordLoginFailure(db, user.Email, c.IP()); err != nil {
+			log.Printf("Failed to record login failure: %s", err)
+		}
+		return false, c.Status(fiber.StatusBadRequest).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Current password is incorrect",
+			Errors:  "Invalid password",
+		})
+	}
+	return true, nil
+}
+
+// ChangePassword is a handler to change the password of the current user
+// @Summary Change password
+// @Description Change the current user's password. The current password is required, every other session of the user is signed out, and unused reset and sign-in links stop working.
+// @Tags password
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param input body model.ChangePasswordInput true "Current and new password"
+// @Success 200 {object} model.SuccessResponse
+// @Failure 400 {object} model.ErrorResponse
+// @Failure 429 {object} model.ErrorResponse
+// @Failure 500 {object} model.ErrorResponse
+// @Router /users/me/password/ [post]
+func ChangePassword(c *fiber.Ctx) error {
+	db := database.DB
+	user := middleware.CurrentUser(c)
+
+	var input model.ChangePasswordInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Invalid input",
+			Errors:  err.Error(),
+		})
+	}
+
+	validationErrors := validation.ValidateStruct(&input)
+	if len(validationErrors) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(validationErrors)
+	}
+
+	if ok, err := checkCurrentPassword(c, db, user, input.CurrentPassword); !ok {
+		return err
+	}
+
+	hash, err := hashPassword(input.NewPassword)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Couldn't hash password",
+			Errors:  err.Error(),
+		})
+	}
+
+	var revoked []string
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Update("password", hash).Error; err != nil {
+			return err
+		}
+
+		// Reset and sign-in links sent before the change must not undo it.
+		err := tx.Model(&model.PasswordResetToken{}).
+			Where("user_id = ? AND used_at IS NULL", user.ID).
+			Update("used_at", time.Now()).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Model(&model.MagicLinkToken{}).
+			Where("user_id = ? AND used_at IS NULL", user.ID).
+			Update("used_at", time.Now()).Error
+		if err != nil {
+			return err
+		}
+		revoked, err = revokeSessions(tx, "user_id = ? AND id <> ?", user.ID, middleware.CurrentClaims(c).SessionID)
+		return err
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Couldn't change password",
+			Errors:  err.Error(),
+		})
+	}
+	closeSessionSockets(revoked)
+
+	sendMail(mailer.Message{
+		To:      user.Email,
+		Subject: "Your password was changed",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nThe password of your account was just changed and your other devices were signed out.\n\nIf you didn't do this, reset your password right away.",
+			user.FirstName,
+		),
+	})
+
+	return c.Status(fiber.StatusOK).JSON(model.SuccessResponse{
+		Status:  "success",
+		Message: "Password changed",
+		Data:    nil,
+	})
+}
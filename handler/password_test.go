@@ -0,0 +1,95 @@
+package handler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/kazimovzaman2/Go-jwt-gorm/model"
+	"github.com/kazimovzaman2/Go-jwt-gorm/utils"
+	"gorm.io/gorm"
+)
+
+// createLinkToken stores row, an emailed link token, with the hash of a new
+// token and returns that token.
+func createLinkToken(t *testing.T, db *gorm.DB, row interface{}) string {
+	t.Helper()
+
+	token, hash, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	switch row := row.(type) {
+	case *model.MagicLinkToken:
+		row.TokenHash = hash
+	case *model.PasswordResetToken:
+		row.TokenHash = hash
+	}
+	if err := db.Create(row).Error; err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestPasswordChangesBurnSignInLinks(t *testing.T) {
+	db := setupTestDB(t)
+	setupTestMailer(t)
+
+	tests := []struct {
+		name   string
+		change func(t *testing.T, app *fiber.App, user model.User) testResponse
+		want   int
+	}{
+		{"no change", nil, fiber.StatusOK},
+		{"reset", func(t *testing.T, app *fiber.App, user model.User) testResponse {
+			token := createLinkToken(t, db, &model.PasswordResetToken{UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour)})
+			return request(t, app, fiber.MethodPost, "/api/password/reset/confirm/", model.PasswordResetConfirmInput{
+				Token:    token,
+				Password: "a new password",
+			})
+		}, fiber.StatusUnauthorized},
+		{"change", func(t *testing.T, app *fiber.App, user model.User) testResponse {
+			return request(t, app, fiber.MethodPost, "/api/users/me/password/", model.ChangePasswordInput{
+				CurrentPassword: "the old password",
+				NewPassword:     "a new password",
+			})
+		}, fiber.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hash, err := hashPassword("the old password")
+			if err != nil {
+				t.Fatal(err)
+			}
+			now := time.Now()
+			user := model.User{Email: testID(t) + "@example.com", Password: hash, FirstName: "Ada", EmailVerifiedAt: &now}
+			if err := db.Create(&user).Error; err != nil {
+				t.Fatal(err)
+			}
+
+			app := fiber.New()
+			app.Post("/api/password/reset/confirm/", ConfirmPasswordReset)
+			app.Post("/api/users/me/password/", asUser(user), ChangePassword)
+			app.Post("/api/jwt/magic-link/login/", MagicLinkLogin)
+
+			nonce := testID(t)
+			token := createLinkToken(t, db, &model.MagicLinkToken{
+				UserID:    user.ID,
+				NonceHash: utils.HashOpaqueToken(nonce),
+				ExpiresAt: time.Now().Add(15 * time.Minute),
+			})
+
+			if tt.change != nil {
+				if response := tt.change(t, app, user); response.status != fiber.StatusOK {
+					t.Fatalf("%s returned status %d", tt.name, response.status)
+				}
+			}
+
+			response := request(t, app, fiber.MethodPost, "/api/jwt/magic-link/login/", model.MagicLinkLoginInput{Token: token, Nonce: nonce})
+			if response.status != tt.want {
+				t.Fatalf("sign-in link returned status %d, want %d", response.status, tt.want)
+			}
+		})
+	}
+}
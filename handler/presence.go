@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/kazimovzaman2/Go-jwt-gorm/database"
+	"github.com/kazimovzaman2/Go-jwt-gorm/middleware"
+	"github.com/kazimovzaman2/Go-jwt-gorm/model"
+	"github.com/kazimovzaman2/Go-jwt-gorm/realtime"
+)
+
+// GetPresence is a handler to get the presence of conversation members
+// @Summary Get presence of conversation members
+// @Description Get the online, away or offline status of every member of a conversation. Last seen times are omitted for members who hide them.
+// @Tags presence
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Conversation ID"
+// @Success 200 {object} model.SuccessResponse{data=[]model.PresenceResponse}
+// @Failure 400 {object} model.ErrorResponse
+// @Failure 404 {object} model.ErrorResponse
+// @Failure 500 {object} model.ErrorResponse
+// @Router /conversations/{id}/presence/ [get]
+func GetPresence(c *fiber.Ctx) error {
+	db := database.DB
+	userID := middleware.CurrentUser(c).ID
+
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Invalid conversation ID",
+			Errors:  err.Error(),
+		})
+	}
+
+	conversation, err := findConversation(db, uint(id), userID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Conversation not found",
+			Errors:  err.Error(),
+		})
+	}
+
+	userIDs := make([]uint, 0, len(conversation.Members))
+	for _, member := range conversation.Members {
+		userIDs = append(userIDs, member.UserID)
+	}
+
+	statuses, err := realtime.DefaultPresence.Statuses(userIDs)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Couldn't load presence",
+			Errors:  err.Error(),
+		})
+	}
+
+	responseData := make([]model.PresenceResponse, 0, len(conversation.Members))
+	for _, member := range conversation.Members {
+		responseData = append(responseData, realtime.PresenceToResponse(member.User, statuses[member.UserID]))
+	}
+
+	return c.Status(fiber.StatusOK).JSON(model.SuccessResponse{
+		Status:  "success",
+		Message: "Presence found",
+		Data:    responseData,
+	})
+}
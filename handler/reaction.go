@@ -0,0 +1,223 @@
+package handler
+
+import (
+	"net/url"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/kazimovzaman2/Go-jwt-gorm/database"
+	"github.com/kazimovzaman2/Go-jwt-gorm/middleware"
+	"github.com/kazimovzaman2/Go-jwt-gorm/model"
+	"github.com/kazimovzaman2/Go-jwt-gorm/realtime"
+	"github.com/kazimovzaman2/Go-jwt-gorm/validation"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// reactionSummaries aggregates the reactions of the given messages for
+// userID in a single query, keyed by message ID.
+func reactionSummaries(db *gorm.DB, userID uint, messageIDs []uint) (map[uint][]model.ReactionSummary, error) {
+	result := make(map[uint][]model.ReactionSummary, len(messageIDs))
+	if len(messageIDs) == 0 {
+		return result, nil
+	}
+
+	var rows []struct {
+		MessageID uint
+		Emoji     string
+		Count     int
+		Reacted   bool
+	}
+	err := db.Model(&model.MessageReaction{}).
+		Select("message_id, emoji, COUNT(*) AS count, BOOL_OR(user_id = ?) AS reacted, MIN(created_at) AS first_at", userID).
+		Where("message_id IN ?", messageIDs).
+		Group("message_id, emoji").
+		Order("message_id, first_at").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		result[row.MessageID] = append(result[row.MessageID], model.ReactionSummary{
+			Emoji:   row.Emoji,
+			Count:   row.Count,
+			Reacted: row.Reacted,
+		})
+	}
+	return result, nil
+}
+
+// attachReactions fills in the reactions of every message in place.
+func attachReactions(db *gorm.DB, userID uint, messages []model.MessageResponse) error {
+	messageIDs := make([]uint, 0, len(messages))
+	for _, message := range messages {
+		messageIDs = append(messageIDs, message.ID)
+	}
+
+	summaries, err := reactionSummaries(db, userID, messageIDs)
+	if err != nil {
+		return err
+	}
+
+	for i := range messages {
+		messages[i].Reactions = summaries[messages[i].ID]
+		if messages[i].Reactions == nil {
+			messages[i].Reactions = []model.ReactionSummary{}
+		}
+	}
+	return nil
+}
+
+func countReactions(db *gorm.DB, messageID uint, emoji string) int {
+	var count int64
+	db.Model(&model.MessageReaction{}).Where("message_id = ? AND emoji = ?", messageID, emoji).Count(&count)
+	return int(count)
+}
+
+// AddReaction is a handler to react to a message
+// @Summary Add a reaction
+// @Description React to a message with a single emoji, which may be a sequence such as a flag or an emoji with a skin tone. Reacting twice with the same emoji has no effect.
+// @Tags reaction
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Conversation ID"
+// @Param message_id path int true "Message ID"
+// @Param input body model.ReactionInput true "Reaction"
+// @Success 200 {object} model.SuccessResponse{data=[]model.ReactionSummary}
+// @Failure 400 {object} model.ErrorResponse
+// @Failure 404 {object} model.ErrorResponse
+// @Failure 500 {object} model.ErrorResponse
+// @Router /conversations/{id}/messages/{message_id}/reactions/ [post]
+func AddReaction(c *fiber.Ctx) error {
+	db := database.DB
+	userID := middleware.CurrentUser(c).ID
+
+	conversation, message, status, errResp := loadMessage(c, db)
+	if errResp != nil {
+		return c.Status(status).JSON(errResp)
+	}
+	if message.DeletedAt != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Deleted messages can't be reacted to",
+			Errors:  "Message deleted",
+		})
+	}
+
+	var input model.ReactionInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Invalid input",
+			Errors:  err.Error(),
+		})
+	}
+
+	validationErrors := validation.ValidateStruct(&input)
+	if len(validationErrors) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(validationErrors)
+	}
+
+	reaction := model.MessageReaction{
+		MessageID: message.ID,
+		UserID:    userID,
+		Emoji:     input.Emoji,
+	}
+	result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&reaction)
+	if result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Couldn't add reaction",
+			Errors:  result.Error.Error(),
+		})
+	}
+
+	if result.RowsAffected > 0 {
+		publishToConversation(conversation, realtime.EventReactionAdded, model.ReactionEventData{
+			MessageID: message.ID,
+			UserID:    userID,
+			Emoji:     input.Emoji,
+			Count:     countReactions(db, message.ID, input.Emoji),
+		})
+	}
+
+	return reactionsResponse(c, db, userID, message.ID, "Reaction added")
+}
+
+// RemoveReaction is a handler to remove a reaction from a message
+// @Summary Remove a reaction
+// @Description Remove your reaction with the given emoji from a message. The emoji must be URL encoded.
+// @Tags reaction
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Conversation ID"
+// @Param message_id path int true "Message ID"
+// @Param emoji path string true "Emoji"
+// @Success 200 {object} model.SuccessResponse{data=[]model.ReactionSummary}
+// @Failure 400 {object} model.ErrorResponse
+// @Failure 404 {object} model.ErrorResponse
+// @Failure 500 {object} model.ErrorResponse
+// @Router /conversations/{id}/messages/{message_id}/reactions/{emoji}/ [delete]
+func RemoveReaction(c *fiber.Ctx) error {
+	db := database.DB
+	userID := middleware.CurrentUser(c).ID
+
+	conversation, message, status, errResp := loadMessage(c, db)
+	if errResp != nil {
+		return c.Status(status).JSON(errResp)
+	}
+
+	emoji, err := url.PathUnescape(c.Params("emoji"))
+	if err != nil || !validation.IsEmoji(emoji) {
+		return c.Status(fiber.StatusBadRequest).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Invalid emoji",
+			Errors:  "Invalid emoji",
+		})
+	}
+
+	result := db.Where("message_id = ? AND user_id = ? AND emoji = ?", message.ID, userID, emoji).
+		Delete(&model.MessageReaction{})
+	if result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Couldn't remove reaction",
+			Errors:  result.Error.Error(),
+		})
+	}
+
+	if result.RowsAffected > 0 {
+		publishToConversation(conversation, realtime.EventReactionRemoved, model.ReactionEventData{
+			MessageID: message.ID,
+			UserID:    userID,
+			Emoji:     emoji,
+			Count:     countReactions(db, message.ID, emoji),
+		})
+	}
+
+	return reactionsResponse(c, db, userID, message.ID, "Reaction removed")
+}
+
+func reactionsResponse(c *fiber.Ctx, db *gorm.DB, userID uint, messageID uint, message string) error {
+	summaries, err := reactionSummaries(db, userID, []uint{messageID})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Couldn't load reactions",
+			Errors:  err.Error(),
+		})
+	}
+
+	responseData := summaries[messageID]
+	if responseData == nil {
+		responseData = []model.ReactionSummary{}
+	}
+
+	return c.Status(fiber.StatusOK).JSON(model.SuccessResponse{
+		Status:  "success",
+		Message: message,
+		Data:    responseData,
+	})
+}
@@ -0,0 +1,200 @@
+package handler
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/kazimovzaman2/Go-jwt-gorm/database"
+	"github.com/kazimovzaman2/Go-jwt-gorm/middleware"
+	"github.com/kazimovzaman2/Go-jwt-gorm/model"
+	"github.com/kazimovzaman2/Go-jwt-gorm/realtime"
+	"github.com/kazimovzaman2/Go-jwt-gorm/utils"
+	"gorm.io/gorm"
+)
+
+// unreadCounts returns, for every given conversation of userID, how many
+// top-level messages from other members arrived after the user's read marker.
+// Everything is computed in one grouped query, however many conversations
+// the sidebar shows.
+func unreadCounts(db *gorm.DB, userID uint, conversationIDs []uint) (map[uint]int, error) {
+	result := make(map[uint]int, len(conversationIDs))
+	if len(conversationIDs) == 0 {
+		return result, nil
+	}
+
+	var rows []struct {
+		ConversationID uint
+		Unread         int
+	}
+	err := db.Raw(`
+		SELECT cm.conversation_id, COUNT(m.id) AS unread
+		FROM conversation_members cm
+		JOIN messages m ON m.conversation_id = cm.conversation_id
+			AND m.id > COALESCE(cm.last_read_message_id, 0)
+			AND m.sender_id <> cm.user_id
+			AND m.parent_id IS NULL
+			AND m.deleted_at IS NULL
+		WHERE cm.user_id = ? AND cm.conversation_id IN ?
+		GROUP BY cm.conversation_id`,
+		userID, conversationIDs,
+	).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		result[row.ConversationID] = row.Unread
+	}
+	return result, nil
+}
+
+// MarkRead is a handler to advance the read marker of the current user
+// @Summary Mark a conversation as read
+// @Description Move the current user's read marker up to the given message, or to the newest message when none is given. The marker never moves backwards.
+// @Tags receipt
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Conversation ID"
+// @Param input body model.MarkReadInput false "Last read message"
+// @Success 200 {object} model.SuccessResponse{data=model.ReadReceiptResponse}
+// @Failure 400 {object} model.ErrorResponse
+// @Failure 404 {object} model.ErrorResponse
+// @Failure 500 {object} model.ErrorResponse
+// @Router /conversations/{id}/read/ [post]
+func MarkRead(c *fiber.Ctx) error {
+	db := database.DB
+	userID := middleware.CurrentUser(c).ID
+
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Invalid conversation ID",
+			Errors:  err.Error(),
+		})
+	}
+
+	conversation, err := findConversation(db, uint(id), userID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Conversation not found",
+			Errors:  err.Error(),
+		})
+	}
+
+	var input model.MarkReadInput
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&input); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(model.ErrorResponse{
+				Status:  "error",
+				Message: "Invalid input",
+				Errors:  err.Error(),
+			})
+		}
+	}
+
+	var message model.Message
+	query := db.Where("conversation_id = ?", conversation.ID)
+	if input.MessageID != nil {
+		query = query.Where("id = ?", *input.MessageID)
+	}
+	if err := query.Order("id DESC").First(&message).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Message not found",
+			Errors:  err.Error(),
+		})
+	}
+
+	now := time.Now()
+	result := db.Model(&model.ConversationMember{}).
+		Where("conversation_id = ? AND user_id = ?", conversation.ID, userID).
+		Where("last_read_message_id IS NULL OR last_read_message_id < ?", message.ID).
+		Updates(map[string]interface{}{
+			"last_read_message_id": message.ID,
+			"last_read_at":         now,
+		})
+	if result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Couldn't mark conversation as read",
+			Errors:  result.Error.Error(),
+		})
+	}
+
+	var member model.ConversationMember
+	if err := db.Where("conversation_id = ? AND user_id = ?", conversation.ID, userID).First(&member).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Couldn't mark conversation as read",
+			Errors:  err.Error(),
+		})
+	}
+
+	unread, err := unreadCounts(db, userID, []uint{conversation.ID})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Couldn't mark conversation as read",
+			Errors:  err.Error(),
+		})
+	}
+
+	responseData := model.ReadReceiptResponse{
+		UserID:            userID,
+		LastReadMessageID: *member.LastReadMessageID,
+		UnreadCount:       unread[conversation.ID],
+		ReadAt:            member.LastReadAt.Format("2006-01-02 15:04:05"),
+	}
+
+	if result.RowsAffected > 0 {
+		publishToConversation(conversation, realtime.EventReceiptUpdated, responseData)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(model.SuccessResponse{
+		Status:  "success",
+		Message: "Conversation marked as read",
+		Data:    responseData,
+	})
+}
+
+// GetSeenBy is a handler to list the members who have read a message
+// @Summary Get who has seen a message
+// @Description List the members, other than the sender, whose read marker has reached the given message
+// @Tags receipt
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Conversation ID"
+// @Param message_id path int true "Message ID"
+// @Success 200 {object} model.SuccessResponse{data=[]model.SeenByResponse}
+// @Failure 400 {object} model.ErrorResponse
+// @Failure 404 {object} model.ErrorResponse
+// @Router /conversations/{id}/messages/{message_id}/seen/ [get]
+func GetSeenBy(c *fiber.Ctx) error {
+	db := database.DB
+
+	conversation, message, status, errResp := loadMessage(c, db)
+	if errResp != nil {
+		return c.Status(status).JSON(errResp)
+	}
+
+	responseData := []model.SeenByResponse{}
+	for _, member := range conversation.Members {
+		if member.UserID == message.SenderID || member.LastReadMessageID == nil || *member.LastReadMessageID < message.ID {
+			continue
+		}
+		responseData = append(responseData, model.SeenByResponse{
+			User:   utils.UserToResponse(member.User),
+			ReadAt: member.LastReadAt.Format("2006-01-02 15:04:05"),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(model.SuccessResponse{
+		Status:  "success",
+		Message: "Seen by",
+		Data:    responseData,
+	})
+}
@@ -0,0 +1,95 @@
+package handler
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/kazimovzaman2/Go-jwt-gorm/database"
+	"github.com/kazimovzaman2/Go-jwt-gorm/middleware"
+	"github.com/kazimovzaman2/Go-jwt-gorm/model"
+	"github.com/kazimovzaman2/Go-jwt-gorm/utils"
+)
+
+// GetMySessions is a handler to list the devices the current user is logged in on
+// @Summary Get my sessions
+// @Description List the active sessions of the current user, most recently used first. The session of the calling token is marked as current.
+// @Tags session
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} model.SuccessResponse{data=[]model.SessionResponse}
+// @Failure 401 {object} model.ErrorResponse
+// @Failure 500 {object} model.ErrorResponse
+// @Router /users/me/sessions/ [get]
+func GetMySessions(c *fiber.Ctx) error {
+	db := database.DB
+	sessionID := middleware.CurrentClaims(c).SessionID
+
+	// A session whose last refresh token expired can never be used again.
+	var sessions []model.Session
+	err := db.Where("user_id = ? AND revoked_at IS NULL AND last_used_at > ?", middleware.CurrentUser(c).ID, time.Now().Add(-utils.RefreshTokenTTL)).
+		Order("last_used_at DESC").
+		Find(&sessions).Error
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Couldn't load sessions",
+			Errors:  err.Error(),
+		})
+	}
+
+	responseData := make([]model.SessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		responseData = append(responseData, utils.SessionToResponse(session, sessionID))
+	}
+
+	return c.Status(fiber.StatusOK).JSON(model.SuccessResponse{
+		Status:  "success",
+		Message: "Sessions found",
+		Data:    responseData,
+	})
+}
+
+// DeleteMySession is a handler to sign out one of the current user's devices
+// @Summary Delete a session
+// @Description Revoke one session of the current user. Its tokens stop working immediately.
+// @Tags session
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path string true "Session ID"
+// @Success 200 {object} model.SuccessResponse
+// @Failure 401 {object} model.ErrorResponse
+// @Failure 404 {object} model.ErrorResponse
+// @Failure 500 {object} model.ErrorResponse
+// @Router /users/me/sessions/{id}/ [delete]
+func DeleteMySession(c *fiber.Ctx) error {
+	db := database.DB
+
+	var session model.Session
+	err := db.Where("id = ? AND user_id = ? AND revoked_at IS NULL", c.Params("id"), middleware.CurrentUser(c).ID).
+		First(&session).Error
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Session not found",
+			Errors:  err.Error(),
+		})
+	}
+
+	revoked, err := revokeSessions(db, "id = ?", session.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Couldn't delete session",
+			Errors:  err.Error(),
+		})
+	}
+	closeSessionSockets(revoked)
+
+	return c.Status(fiber.StatusOK).JSON(model.SuccessResponse{
+		Status:  "success",
+		Message: "Session deleted",
+		Data:    nil,
+	})
+}
@@ -0,0 +1,440 @@
+package handler
+
+import (
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/kazimovzaman2/Go-jwt-gorm/database"
+	"github.com/kazimovzaman2/Go-jwt-gorm/middleware"
+	"github.com/kazimovzaman2/Go-jwt-gorm/model"
+	"github.com/kazimovzaman2/Go-jwt-gorm/utils"
+	"github.com/kazimovzaman2/Go-jwt-gorm/validation"
+	"gorm.io/gorm"
+)
+
+// verifyTOTP accepts a TOTP code of user at most once.
+func verifyTOTP(db *gorm.DB, user model.User, code string) (bool, error) {
+	counter, ok := utils.ValidateTOTP(user.TOTPSecret, code, user.TOTPLastCounter)
+	if !ok {
+		return false, nil
+	}
+
+	// Two requests with the same code race on the counter; only one wins.
+	result := db.Model(&model.User{}).
+		Where("id = ? AND totp_last_counter < ?", user.ID, counter).
+		UpdateColumn("totp_last_counter", counter)
+	return result.RowsAffected > 0, result.Error
+}
+
+// verifySecondFactor accepts either a TOTP code or an unused recovery code,
+// which is burnt.
+func verifySecondFactor(db *gorm.DB, user model.User, code string) (bool, error) {
+	ok, err := verifyTOTP(db, user, code)
+	if ok || err != nil {
+		return ok, err
+	}
+
+	result := db.Model(&model.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.ID, utils.HashRecoveryCode(code)).
+		Update("used_at", time.Now())
+	return result.RowsAffected > 0, result.Error
+}
+
+// replaceRecoveryCodes drops the user's recovery codes and returns a fresh set.
+func replaceRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	codes, hashes, err := utils.GenerateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Where("user_id = ?", userID).Delete(&model.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	recoveryCodes := make([]model.RecoveryCode, 0, len(hashes))
+	for _, hash := range hashes {
+		recoveryCodes = append(recoveryCodes, model.RecoveryCode{UserID: userID, CodeHash: hash})
+	}
+	if err := tx.Create(&recoveryCodes).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// parseTwoFactorCode loads the current user and the code from the body.
+// It writes the error response itself and returns ok=false on failure.
+func parseTwoFactorCode(c *fiber.Ctx, db *gorm.DB) (model.User, string, bool, error) {
+	user := middleware.CurrentUser(c)
+
+	var input model.TwoFactorCodeInput
+	if err := c.BodyParser(&input); err != nil {
+		return user, "", false, c.Status(fiber.StatusBadRequest).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Invalid input",
+			Errors:  err.Error(),
+		})
+	}
+
+	validationErrors := validation.ValidateStruct(&input)
+	if len(validationErrors) > 0 {
+		return user, "", false, c.Status(fiber.StatusBadRequest).JSON(validationErrors)
+	}
+	return user, input.Code, true, nil
+}
+
+// checkTwoFactorChange confirms a change to two-factor authentication with
+// the current password and a code accepted by verify. Wrong codes count as
+// failed logins, like wrong passwords. It writes the error response itself
+// and returns ok=false on failure.
+func checkTwoFactorChange(c *fiber.Ctx, db *gorm.DB, verify func(*gorm.DB, model.User, string) (bool, error)) (model.User, bool, error) {
+	user := middleware.CurrentUser(c)
+
+	var input model.TwoFactorChangeInput
+	if err := c.BodyParser(&input); err != nil {
+		return user, false, c.Status(fiber.StatusBadRequest).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Invalid input",
+			Errors:  err.Error(),
+		})
+	}
+
+	validationErrors := validation.ValidateStruct(&input)
+	if len(validationErrors) > 0 {
+		return user, false, c.Status(fiber.StatusBadRequest).JSON(validationErrors)
+	}
+
+	if user.TOTPEnabledAt == nil {
+		return user, false, c.Status(fiber.StatusBadRequest).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Two-factor authentication is not enabled",
+			Errors:  "Not enabled",
+		})
+	}
+
+	if ok, err := checkCurrentPassword(c, db, user, input.Password); !ok {
+		return user, false, err
+	}
+
+	valid, err := verify(db, user, input.Code)
+	if err != nil {
+		return user, false, c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Couldn't check code",
+			Errors:  err.Error(),
+		})
+	}
+	if !valid {
+		if err := recordLoginFailure(db, user.Email, c.IP()); err != nil {
+			log.Printf("Failed to record login failure: %s", err)
+		}
+		return user, false, invalidTwoFactorCode(c)
+	}
+	return user, true, nil
+}
+
+func invalidTwoFactorCode(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusBadRequest).JSON(model.ErrorResponse{
+		Status:  "error",
+		Message: "The code is invalid",
+		Errors:  "Invalid code",
+	})
+}
+
+// SetupTOTP is a handler to start enrolling an authenticator app
+// @Summary Set up TOTP
+// @Description Generate a new TOTP secret for the current user. Two-factor authentication is only turned on once a code is confirmed at /users/me/2fa/totp/confirm/. qr_code is a PNG data URL of the otpauth URI.
+// @Tags two-factor
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} model.SuccessResponse{data=model.TOTPSetupResponse}
+// @Failure 400 {object} model.ErrorResponse
+// @Failure 500 {object} model.ErrorResponse
+// @Router /users/me/2fa/totp/ [post]
+func SetupTOTP(c *fiber.Ctx) error {
+	db := database.DB
+
+	user := middleware.CurrentUser(c)
+
+	if user.TOTPEnabledAt != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Two-factor authentication is already enabled",
+			Errors:  "Already enabled",
+		})
+	}
+
+	secret, uri, qrCode, err := utils.GenerateTOTPKey(user.Email)
+	if err == nil {
+		err = db.Model(&user).UpdateColumns(map[string]interface{}{
+			"totp_secret":       secret,
+			"totp_last_counter": 0,
+		}).Error
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Couldn't set up two-factor authentication",
+			Errors:  err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(model.SuccessResponse{
+		Status:  "success",
+		Message: "Scan the QR code and confirm with a code",
+		Data: model.TOTPSetupResponse{
+			Secret: secret,
+			URI:    uri,
+			QRCode: qrCode,
+		},
+	})
+}
+
+// ConfirmTOTP is a handler to turn on two-factor authentication
+// @Summary Confirm TOTP
+// @Description Turn on two-factor authentication with a code from the authenticator app set up at /users/me/2fa/totp/. Returns recovery codes, which are shown only this once.
+// @Tags two-factor
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param input body model.TwoFactorCodeInput true "TOTP code"
+// @Success 200 {object} model.SuccessResponse{data=model.RecoveryCodesResponse}
+// @Failure 400 {object} model.ErrorResponse
+// @Failure 500 {object} model.ErrorResponse
+// @Router /users/me/2fa/totp/confirm/ [post]
+func ConfirmTOTP(c *fiber.Ctx) error {
+	db := database.DB
+
+	user, code, ok, err := parseTwoFactorCode(c, db)
+	if !ok {
+		return err
+	}
+
+	if user.TOTPEnabledAt != nil || user.TOTPSecret == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "There is no pending two-factor setup",
+			Errors:  "Nothing to confirm",
+		})
+	}
+
+	var codes []string
+	err = db.Transaction(func(tx *gorm.DB) error {
+		valid, err := verifyTOTP(tx, user, code)
+		if err != nil || !valid {
+			return err
+		}
+
+		if err := tx.Model(&user).UpdateColumn("totp_enabled_at", time.Now()).Error; err != nil {
+			return err
+		}
+		codes, err = replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Couldn't enable two-factor authentication",
+			Errors:  err.Error(),
+		})
+	}
+	if codes == nil {
+		return invalidTwoFactorCode(c)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(model.SuccessResponse{
+		Status:  "success",
+		Message: "Two-factor authentication enabled",
+		Data:    model.RecoveryCodesResponse{RecoveryCodes: codes},
+	})
+}
+
+// DisableTOTP is a handler to turn off two-factor authentication
+// @Summary Disable TOTP
+// @Description Turn off two-factor authentication. Requires the current password and a TOTP code or a recovery code. Wrong passwords and codes count as failed logins.
+// @Tags two-factor
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param input body model.TwoFactorChangeInput true "Current password and TOTP or recovery code"
+// @Success 200 {object} model.SuccessResponse
+// @Failure 400 {object} model.ErrorResponse
+// @Failure 429 {object} model.ErrorResponse
+// @Failure 500 {object} model.ErrorResponse
+// @Router /users/me/2fa/totp/disable/ [post]
+func DisableTOTP(c *fiber.Ctx) error {
+	db := database.DB
+
+	user, ok, err := checkTwoFactorChange(c, db, verifySecondFactor)
+	if !ok {
+		return err
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&user).UpdateColumns(map[string]interface{}{
+			"totp_secret":       "",
+			"totp_enabled_at":   nil,
+			"totp_last_counter": 0,
+		}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", user.ID).Delete(&model.RecoveryCode{}).Error
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Couldn't disable two-factor authentication",
+			Errors:  err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(model.SuccessResponse{
+		Status:  "success",
+		Message: "Two-factor authentication disabled",
+		Data:    nil,
+	})
+}
+
+// RegenerateRecoveryCodes is a handler to replace the recovery codes
+// @Summary Regenerate recovery codes
+// @Description Replace all recovery codes of the current user with new ones. Requires the current password and a TOTP code. Wrong passwords and codes count as failed logins.
+// @Tags two-factor
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param input body model.TwoFactorChangeInput true "Current password and TOTP code"
+// @Success 200 {object} model.SuccessResponse{data=model.RecoveryCodesResponse}
+// @Failure 400 {object} model.ErrorResponse
+// @Failure 429 {object} model.ErrorResponse
+// @Failure 500 {object} model.ErrorResponse
+// @Router /users/me/2fa/recovery-codes/ [post]
+func RegenerateRecoveryCodes(c *fiber.Ctx) error {
+	db := database.DB
+
+	user, ok, err := checkTwoFactorChange(c, db, verifyTOTP)
+	if !ok {
+		return err
+	}
+
+	var codes []string
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		codes, err = replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Couldn't regenerate recovery codes",
+			Errors:  err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(model.SuccessResponse{
+		Status:  "success",
+		Message: "Recovery codes regenerated",
+		Data:    model.RecoveryCodesResponse{RecoveryCodes: codes},
+	})
+}
+
+// LoginTwoFactor is a handler to finish a two-factor login
+// @Summary Login with a second factor
+// @Description Exchange the challenge_token returned by /jwt/create/ and a TOTP or recovery code for the access and refresh tokens
+// @Tags jwt
+// @Accept json
+// @Produce json
+// @Param input body model.TwoFactorLoginInput true "Challenge token and code"
+// @Success 200 {object} model.SuccessResponse
+// @Failure 400 {object} model.ErrorResponse
+// @Failure 401 {object} model.ErrorResponse
+// @Failure 403 {object} model.ErrorResponse
+// @Failure 429 {object} model.ErrorResponse
+// @Failure 500 {object} model.ErrorResponse
+// @Router /jwt/2fa/ [post]
+func LoginTwoFactor(c *fiber.Ctx) error {
+	db := database.DB
+
+	var input model.TwoFactorLoginInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Invalid input",
+			Errors:  err.Error(),
+		})
+	}
+
+	validationErrors := validation.ValidateStruct(&input)
+	if len(validationErrors) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(validationErrors)
+	}
+
+	claims, err := utils.ParseInternalToken(input.ChallengeToken, model.TokenTypeChallenge)
+	var user model.User
+	if err == nil {
+		var userID uint
+		if userID, err = claims.UserID(); err == nil {
+			err = db.First(&user, userID).Error
+		}
+	}
+	if err != nil || user.TOTPEnabledAt == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "The challenge has expired, log in again",
+			Errors:  "Invalid token",
+		})
+	}
+
+	// Codes are short, so guessing them is throttled like passwords.
+	wait, err := loginLockedFor(db, accountThrottleKey(user.Email), ipThrottleKey(c.IP()))
+	var valid bool
+	if err == nil && wait == 0 {
+		valid, err = verifySecondFactor(db, user, input.Code)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Could not login",
+			Errors:  err.Error(),
+		})
+	}
+	if wait > 0 {
+		return tooManyLoginAttempts(c, wait)
+	}
+	if !valid {
+		if err := recordLoginFailure(db, user.Email, c.IP()); err != nil {
+			log.Printf("Failed to record login failure: %s", err)
+		}
+		return c.Status(fiber.StatusUnauthorized).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "The code is invalid",
+			Errors:  "Invalid code",
+		})
+	}
+
+	if user.SuspendedAt != nil {
+		return accountSuspended(c)
+	}
+	if user.PasswordResetRequired {
+		return passwordResetRequired(c)
+	}
+
+	accessToken, refreshToken, err := startSession(c, db, user)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Could not login",
+			Errors:  err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(model.SuccessResponse{
+		Status:  "success",
+		Message: "Logged in",
+		Data: fiber.Map{
+			"access_token":  accessToken,
+			"refresh_token": refreshToken,
+		},
+	})
+}
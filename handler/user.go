@@ -1,31 +1,36 @@
 package handler
 
 import (
+	"errors"
 	"fmt"
+	"log"
 	"os"
 	"path/filepath"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/golang-jwt/jwt/v5"
+	"github.com/kazimovzaman2/Go-jwt-gorm/config"
 	"github.com/kazimovzaman2/Go-jwt-gorm/database"
+	"github.com/kazimovzaman2/Go-jwt-gorm/middleware"
 	"github.com/kazimovzaman2/Go-jwt-gorm/model"
 	"github.com/kazimovzaman2/Go-jwt-gorm/utils"
 	"github.com/kazimovzaman2/Go-jwt-gorm/validation"
-	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 )
 
 func hashPassword(password string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 14)
-	return string(bytes), err
+	config, _ := config.LoadConfig(".")
+	return utils.HashPassword(password, config)
 }
 
 // GetAllUsers is a handler to get all users
 // @Summary Get all users
-// @Description Get all users
+// @Description Get all users. Requires the users.read permission; /admin/users/ adds search and paging.
 // @Tags user
 // @Accept json
 // @Produce json
+// @Security Bearer
 // @Success 200 {object} model.SuccessResponse
+// @Failure 403 {object} model.ErrorResponse
 // @Router /users/ [get]
 func GetAllUsers(c *fiber.Ctx) error {
 	db := database.DB
@@ -157,13 +162,8 @@ func CreateUser(c *fiber.Ctx) error {
 		})
 	}
 
-	accessToken, refreshToken, err := generateTokens(*user)
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
-			Status:  "error",
-			Message: "Could not login",
-			Errors:  err.Error(),
-		})
+	if err := sendVerificationEmail(db, *user); err != nil {
+		log.Printf("Failed to send verification email to user %d: %s", user.ID, err)
 	}
 
 	// Create a new user response
@@ -174,6 +174,26 @@ func CreateUser(c *fiber.Ctx) error {
 		ProfileImage: user.ProfileImage,
 	}
 
+	cfg, _ := config.LoadConfig(".")
+	if cfg.UnverifiedEmailPolicy == config.UnverifiedDeny {
+		return c.Status(fiber.StatusCreated).JSON(model.SuccessResponse{
+			Status:  "success",
+			Message: "User created, verify your email address to log in",
+			Data: fiber.Map{
+				"user": newUser,
+			},
+		})
+	}
+
+	accessToken, refreshToken, err := startSession(c, db, *user)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "Could not login",
+			Errors:  err.Error(),
+		})
+	}
+
 	return c.Status(fiber.StatusCreated).JSON(model.SuccessResponse{
 		Status:  "success",
 		Message: "User created",
@@ -192,25 +212,12 @@ func CreateUser(c *fiber.Ctx) error {
 // @Accept json
 // @Produce json
 // @Security Bearer
-// @Success 200 {object} model.SuccessResponse
-// @Failure 404 {object} model.ErrorResponse
+// @Success 200 {object} model.SuccessResponse{data=model.MeResponse}
 // @Router /users/me/ [get]
 func GetMe(c *fiber.Ctx) error {
-	user_claim := c.Locals("user").(*jwt.Token)
-	claims := user_claim.Claims.(jwt.MapClaims)
-	email := claims["email"].(string)
-
-	db := database.DB
-	var user model.User
-	if err := db.Where("email = ?", email).First(&user).Error; err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(model.ErrorResponse{
-			Status:  "error",
-			Message: "User not found",
-			Errors:  err.Error(),
-		})
-	}
+	user := middleware.CurrentUser(c)
 
-	responseData := utils.UserToResponse(user)
+	responseData := utils.MeToResponse(user)
 
 	return c.Status(fiber.StatusOK).JSON(model.SuccessResponse{
 		Status:  "success",
@@ -221,57 +228,77 @@ func GetMe(c *fiber.Ctx) error {
 
 // UpdateMe is a handler to update the current user
 // @Summary Update the current user
-// @Description Update the current user
+// @Description Update the profile of the current user. Only the fields present in the body change. The email address and password are changed through /users/me/email/ and /users/me/password/.
 // @Tags user
 // @Accept json
 // @Produce json
 // @Security Bearer
-// @Param user body model.User true "User data"
-// @Success 200 {object} model.SuccessResponse
+// @Param input body model.UpdateMeInput true "Profile fields"
+// @Success 200 {object} model.SuccessResponse{data=model.MeResponse}
 // @Failure 400 {object} model.ErrorResponse
-// @Failure 404 {object} model.ErrorResponse
 // @Failure 500 {object} model.ErrorResponse
 // @Router /users/me/ [patch]
 func UpdateMe(c *fiber.Ctx) error {
-	user_claim := c.Locals("user").(*jwt.Token)
-	claims := user_claim.Claims.(jwt.MapClaims)
-	email := claims["email"].(string)
-
 	db := database.DB
-	var user model.User
-	if err := db.Where("email = ?", email).First(&user).Error; err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(model.ErrorResponse{
+	user := middleware.CurrentUser(c)
+
+	var input model.UpdateMeInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(model.ErrorResponse{
 			Status:  "error",
-			Message: "User not found",
+			Message: "Invalid input",
 			Errors:  err.Error(),
 		})
 	}
 
-	// Parse request body into user struct
-	if err := c.BodyParser(&user); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
-			Status:  "error",
-			Message: "Couldn't parse request body",
-			Errors:  err.Error(),
-		})
+	validationErrors := validation.ValidateStruct(&input)
+	if len(validationErrors) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(validationErrors)
+	}
+
+	if input.FirstName != nil {
+		user.FirstName = *input.FirstName
+	}
+	if input.LastName != nil {
+		user.LastName = *input.LastName
+	}
+	if input.HideLastSeen != nil {
+		user.HideLastSeen = *input.HideLastSeen
 	}
 
 	// Save profile image
-	if utils.IsBase64(user.ProfileImage) {
-		imagePath, err := utils.SaveBase64Image(user.ProfileImage)
-		if err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+	if input.ProfileImage != nil {
+		switch {
+		case *input.ProfileImage == "" || *input.ProfileImage == user.ProfileImage:
+			user.ProfileImage = *input.ProfileImage
+		case utils.IsBase64(*input.ProfileImage):
+			imagePath, err := utils.SaveBase64Image(*input.ProfileImage)
+			if err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+					Status:  "error",
+					Message: "Couldn't save profile image",
+					Errors:  err.Error(),
+				})
+			}
+
+			user.ProfileImage = fmt.Sprintf("http://localhost:8000/%s", imagePath)
+		default:
+			return c.Status(fiber.StatusBadRequest).JSON(model.ErrorResponse{
 				Status:  "error",
-				Message: "Couldn't save profile image",
-				Errors:  err.Error(),
+				Message: "Profile image must be a base64 encoded image",
+				Errors:  "Invalid profile image",
 			})
 		}
-
-		user.ProfileImage = fmt.Sprintf("http://localhost:8000/%s", imagePath)
 	}
 
 	// Update user
-	if err := db.Save(&user).Error; err != nil {
+	err := db.Model(&user).Updates(map[string]interface{}{
+		"first_name":     user.FirstName,
+		"last_name":      user.LastName,
+		"profile_image":  user.ProfileImage,
+		"hide_last_seen": user.HideLastSeen,
+	}).Error
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
 			Status:  "error",
 			Message: "Couldn't update user",
@@ -279,7 +306,7 @@ func UpdateMe(c *fiber.Ctx) error {
 		})
 	}
 
-	responseData := utils.UserToResponse(user)
+	responseData := utils.MeToResponse(user)
 
 	return c.Status(fiber.StatusOK).JSON(model.SuccessResponse{
 		Status:  "success",
@@ -290,39 +317,48 @@ func UpdateMe(c *fiber.Ctx) error {
 
 // DeleteMe is a handler to delete the current user
 // @Summary Delete the current user
-// @Description Delete the current user
+// @Description Delete the current user. The last active admin has to make someone else an admin first.
 // @Tags user
 // @Accept json
 // @Produce json
 // @Security Bearer
 // @Success 200 {object} model.SuccessResponse
-// @Failure 404 {object} model.ErrorResponse
+// @Failure 400 {object} model.ErrorResponse
 // @Failure 500 {object} model.ErrorResponse
 // @Router /users/me/ [delete]
 func DeleteMe(c *fiber.Ctx) error {
-	user_claim := c.Locals("user").(*jwt.Token)
-	claims := user_claim.Claims.(jwt.MapClaims)
-	email := claims["email"].(string)
-
 	db := database.DB
-	var user model.User
-	if err := db.Where("email = ?", email).First(&user).Error; err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(model.ErrorResponse{
+	user := middleware.CurrentUser(c)
+
+	imagePath := user.ProfileImage
+
+	var revoked []string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := checkNotLastAdmin(tx, user.ID); err != nil {
+			return err
+		}
+
+		var err error
+		if revoked, err = revokeSessions(tx, "user_id = ?", user.ID); err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(&user).Error
+	})
+	if errors.Is(err, errLastAdmin) {
+		return c.Status(fiber.StatusBadRequest).JSON(model.ErrorResponse{
 			Status:  "error",
-			Message: "User not found",
+			Message: "You're the last admin. Make someone else an admin before deleting your account",
 			Errors:  err.Error(),
 		})
 	}
-
-	imagePath := user.ProfileImage
-
-	if err := db.Unscoped().Delete(&user).Error; err != nil {
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
 			Status:  "error",
 			Message: "Couldn't delete user",
 			Errors:  err.Error(),
 		})
 	}
+	closeSessionSockets(revoked)
 
 	if imagePath != "" {
 		filename := filepath.Base(imagePath)
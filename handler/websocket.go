@@ -0,0 +1,231 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+	"github.com/kazimovzaman2/Go-jwt-gorm/database"
+	"github.com/kazimovzaman2/Go-jwt-gorm/middleware"
+	"github.com/kazimovzaman2/Go-jwt-gorm/model"
+	"github.com/kazimovzaman2/Go-jwt-gorm/realtime"
+	"github.com/kazimovzaman2/Go-jwt-gorm/utils"
+	"github.com/kazimovzaman2/Go-jwt-gorm/validation"
+	"gorm.io/gorm"
+)
+
+// WebSocketUpgrade rejects plain HTTP requests to the socket endpoint.
+func WebSocketUpgrade(c *fiber.Ctx) error {
+	if !websocket.IsWebSocketUpgrade(c) {
+		return c.Status(fiber.StatusUpgradeRequired).JSON(model.ErrorResponse{
+			Status:  "error",
+			Message: "WebSocket upgrade required",
+			Errors:  "Upgrade required",
+		})
+	}
+	return c.Next()
+}
+
+// WebSocket serves the real-time gateway. The protocol is described in
+// docs/websocket.md.
+var WebSocket = websocket.New(func(conn *websocket.Conn) {
+	user := conn.Locals(middleware.CurrentUserKey).(model.User)
+
+	claims := conn.Locals(middleware.ClaimsKey).(*model.TokenClaims)
+
+	client := realtime.NewClient(user.ID, claims.SessionID, conn)
+	client.ReadOnly, _ = conn.Locals(middleware.ReadOnlyKey).(bool)
+	realtime.DefaultHub.Register(client)
+	realtime.DefaultPresence.Connect(client)
+	defer func() {
+		realtime.DefaultHub.Unregister(client)
+		realtime.DefaultPresence.Disconnect(client)
+		for _, conversationID := range typing.StopAll(client) {
+			publishTyping(client, conversationID, false)
+		}
+	}()
+
+	client.Run(func(event realtime.Event) {
+		handleSocketEvent(client, event)
+	})
+})
+
+// typing expires indicators that were not renewed in time.
+var typing = realtime.NewTyping(func(client *realtime.Client, conversationID uint) {
+	publishTyping(client, conversationID, false)
+})
+
+func handleSocketEvent(client *realtime.Client, event realtime.Event) {
+	if event.Version != realtime.ProtocolVersion {
+		replySocketError(client, event, "Unsupported protocol version")
+		return
+	}
+
+	switch event.Type {
+	case realtime.EventPing:
+		reply, _ := realtime.NewEvent(realtime.EventPong, 0, nil)
+		reply.Ref = event.Ref
+		client.SendEvent(reply)
+	case realtime.EventMessageSend:
+		handleSocketMessageSend(client, event)
+	case realtime.EventTypingStart, realtime.EventTypingStop:
+		handleSocketTyping(client, event)
+	case realtime.EventPresenceSet:
+		handleSocketPresenceSet(client, event)
+	default:
+		replySocketError(client, event, "Unknown event type")
+	}
+}
+
+func handleSocketMessageSend(client *realtime.Client, event realtime.Event) {
+	db := database.DB
+
+	if client.ReadOnly {
+		replySocketError(client, event, "Verify your email address to do this")
+		return
+	}
+
+	// Revocations published while a process was reconnecting to the broker
+	// are lost, so writes check the session again.
+	if !sessionActive(db, client.SessionID) {
+		client.Revoke()
+		return
+	}
+
+	conversation, err := findConversation(db, event.ConversationID, client.UserID)
+	if err != nil {
+		replySocketError(client, event, "Conversation not found")
+		return
+	}
+
+	var input model.SendMessageInput
+	if err := json.Unmarshal(event.Data, &input); err != nil {
+		replySocketError(client, event, "Invalid input")
+		return
+	}
+	if validationErrors := validation.ValidateStruct(&input); len(validationErrors) > 0 {
+		replySocketError(client, event, validationErrors[0].Message)
+		return
+	}
+
+	message, err := sendMessage(db, conversation.ID, client.UserID, input)
+	if errors.Is(err, errParentNotFound) || errors.Is(err, errQuoteNotFound) {
+		replySocketError(client, event, err.Error())
+		return
+	}
+	if err != nil {
+		replySocketError(client, event, "Couldn't send message")
+		return
+	}
+
+	response := utils.MessageToResponse(message)
+	ack, _ := realtime.NewEvent(realtime.EventAck, conversation.ID, response)
+	ack.Ref = event.Ref
+	client.SendEvent(ack)
+
+	publishNewMessage(db, conversation, response)
+	if typing.Stop(client, conversation.ID) {
+		publishTyping(client, conversation.ID, false)
+	}
+}
+
+func handleSocketTyping(client *realtime.Client, event realtime.Event) {
+	if _, err := findConversation(database.DB, event.ConversationID, client.UserID); err != nil {
+		replySocketError(client, event, "Conversation not found")
+		return
+	}
+
+	// Only transitions are broadcast; renewals just push the expiry back.
+	if event.Type == realtime.EventTypingStart {
+		if typing.Start(client, event.ConversationID) {
+			publishTyping(client, event.ConversationID, true)
+		}
+	} else if typing.Stop(client, event.ConversationID) {
+		publishTyping(client, event.ConversationID, false)
+	}
+}
+
+func handleSocketPresenceSet(client *realtime.Client, event realtime.Event) {
+	var input model.SetPresenceInput
+	if err := json.Unmarshal(event.Data, &input); err != nil {
+		replySocketError(client, event, "Invalid input")
+		return
+	}
+	if validationErrors := validation.ValidateStruct(&input); len(validationErrors) > 0 {
+		replySocketError(client, event, validationErrors[0].Message)
+		return
+	}
+
+	realtime.DefaultPresence.SetStatus(client, input.Status)
+}
+
+// publishTyping tells the other members of a conversation that client
+// started or stopped typing in it.
+func publishTyping(client *realtime.Client, conversationID uint, isTyping bool) {
+	var userIDs []uint
+	err := database.DB.Model(&model.ConversationMember{}).
+		Where("conversation_id = ? AND user_id <> ?", conversationID, client.UserID).
+		Pluck("user_id", &userIDs).Error
+	if err != nil {
+		log.Printf("Failed to publish %s event: %s", realtime.EventTypingUpdated, err)
+		return
+	}
+
+	event, err := realtime.NewEvent(realtime.EventTypingUpdated, conversationID, model.TypingEventData{
+		UserID: client.UserID,
+		Typing: isTyping,
+	})
+	if err == nil {
+		err = realtime.DefaultHub.Publish(userIDs, event)
+	}
+	if err != nil {
+		log.Printf("Failed to publish %s event: %s", realtime.EventTypingUpdated, err)
+	}
+}
+
+// sessionActive reports whether the session is still signed in and its
+// user not suspended.
+func sessionActive(db *gorm.DB, sessionID string) bool {
+	var count int64
+	err := db.Model(&model.Session{}).
+		Joins("JOIN users ON users.id = sessions.user_id").
+		Where("sessions.id = ? AND sessions.revoked_at IS NULL AND users.suspended_at IS NULL", sessionID).
+		Count(&count).Error
+	return err == nil && count > 0
+}
+
+// closeSessionSockets disconnects the sockets opened with revoked sessions,
+// in every process. Call it after the revocation is committed.
+func closeSessionSockets(sessionIDs []string) {
+	if len(sessionIDs) == 0 {
+		return
+	}
+	if err := realtime.DefaultHub.RevokeSessions(sessionIDs); err != nil {
+		log.Printf("Failed to close sockets of revoked sessions: %s", err)
+	}
+}
+
+func replySocketError(client *realtime.Client, event realtime.Event, message string) {
+	reply, _ := realtime.NewEvent(realtime.EventError, event.ConversationID, realtime.ErrorData{Message: message})
+	reply.Ref = event.Ref
+	client.SendEvent(reply)
+}
+
+// publishToConversation pushes an event to every member of conversation.
+// Delivery is best effort: a failure is logged and never fails the request.
+func publishToConversation(conversation model.Conversation, eventType string, data interface{}) {
+	userIDs := make([]uint, 0, len(conversation.Members))
+	for _, member := range conversation.Members {
+		userIDs = append(userIDs, member.UserID)
+	}
+
+	event, err := realtime.NewEvent(eventType, conversation.ID, data)
+	if err == nil {
+		err = realtime.DefaultHub.Publish(userIDs, event)
+	}
+	if err != nil {
+		log.Printf("Failed to publish %s event: %s", eventType, err)
+	}
+}
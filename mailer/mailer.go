@@ -0,0 +1,43 @@
+package mailer
+
+import (
+	"fmt"
+
+	"github.com/kazimovzaman2/Go-jwt-gorm/config"
+)
+
+const (
+	MailerSMTP = "smtp"
+	MailerFile = "file"
+	MailerLog  = "log"
+)
+
+// Message is a plain text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers emails. Implementations must be safe for concurrent use.
+type Mailer interface {
+	Send(message Message) error
+}
+
+// DefaultMailer is set by Setup. It logs messages until then.
+var DefaultMailer Mailer = NewLogMailer()
+
+// Setup selects DefaultMailer from MAILER: "smtp", "file" or "log" (default).
+func Setup(config *config.Config) error {
+	switch config.Mailer {
+	case "", MailerLog:
+		DefaultMailer = NewLogMailer()
+	case MailerFile:
+		DefaultMailer = NewFileMailer(config.MailDir)
+	case MailerSMTP:
+		DefaultMailer = NewSMTPMailer(config.SMTPHost, config.SMTPPort, config.SMTPUsername, config.SMTPPassword, config.MailFrom)
+	default:
+		return fmt.Errorf("unknown mailer %q", config.Mailer)
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"log"
+	"strings"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
@@ -9,7 +10,12 @@ import (
 	"github.com/kazimovzaman2/Go-jwt-gorm/config"
 	"github.com/kazimovzaman2/Go-jwt-gorm/database"
 	_ "github.com/kazimovzaman2/Go-jwt-gorm/docs"
+	"github.com/kazimovzaman2/Go-jwt-gorm/mailer"
+	"github.com/kazimovzaman2/Go-jwt-gorm/oauth"
+	"github.com/kazimovzaman2/Go-jwt-gorm/passkey"
+	"github.com/kazimovzaman2/Go-jwt-gorm/realtime"
 	"github.com/kazimovzaman2/Go-jwt-gorm/router"
+	"github.com/kazimovzaman2/Go-jwt-gorm/signing"
 )
 
 func init() {
@@ -19,6 +25,26 @@ func init() {
 	}
 
 	database.ConnectDB(&config)
+
+	if err := signing.Setup(&config); err != nil {
+		log.Fatalln("Failed to load signing keys! \n", err.Error())
+	}
+
+	if err := realtime.Setup(&config); err != nil {
+		log.Fatalln("Failed to set up realtime broker! \n", err.Error())
+	}
+
+	if err := mailer.Setup(&config); err != nil {
+		log.Fatalln("Failed to set up mailer! \n", err.Error())
+	}
+
+	if err := passkey.Setup(&config); err != nil {
+		log.Fatalln("Failed to set up passkeys! \n", err.Error())
+	}
+
+	if err := oauth.Setup(&config); err != nil {
+		log.Fatalln("Failed to set up OAuth providers! \n", err.Error())
+	}
 }
 
 // @title App API
@@ -42,11 +68,19 @@ func main() {
 		AppName:       "App",
 	})
 
+	// Browsers only send cookies, like the one binding a provider sign-in
+	// to its browser, to an explicitly allowed origin.
+	config, _ := config.LoadConfig(".")
+	allowOrigins := strings.TrimSuffix(config.AppURL, "/")
+	if allowOrigins == "" {
+		allowOrigins = "*"
+	}
+
 	app.Use(logger.New())
 	app.Use(cors.New(cors.Config{
-		AllowOrigins:     "*",
-		AllowHeaders:     "Origin, Content-Type, Accept",
-		AllowMethods:     "GET, POST, PUT, DELETE",
+		AllowOrigins:     allowOrigins,
+		AllowHeaders:     "Origin, Content-Type, Accept, Authorization",
+		AllowMethods:     "GET, POST, PUT, PATCH, DELETE",
 		AllowCredentials: true,
 	}))
 
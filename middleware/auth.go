@@ -1,15 +1,115 @@
 package middleware
 
 import (
+	"errors"
+
 	jwtware "github.com/gofiber/contrib/jwt"
 	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/kazimovzaman2/Go-jwt-gorm/config"
+	"github.com/kazimovzaman2/Go-jwt-gorm/database"
 	"github.com/kazimovzaman2/Go-jwt-gorm/model"
 )
 
-func NewAuthMiddleware(secret string) fiber.Handler {
+var (
+	errSessionRevoked = errors.New("session has been revoked")
+	errNotAccessToken = errors.New("not an access token")
+)
+
+// readOnlyAllowed lists the write endpoints an unverified user can still
+// call under the read_only policy.
+var readOnlyAllowed = map[string]bool{
+	"/api/jwt/logout/":                   true,
+	"/api/jwt/logout-all/":               true,
+	"/api/users/me/verify-email/resend/": true,
+	"/api/users/me/password/":            true,
+	"/api/users/me/email/":               true,
+}
+
+// NewAuthMiddleware verifies access tokens against keys, which picks the
+// key named by the token's kid header.
+func NewAuthMiddleware(keys jwt.Keyfunc, unverifiedPolicy string) fiber.Handler {
 	return jwtware.New(jwtware.Config{
-		SigningKey:   jwtware.SigningKey{Key: []byte(secret)},
-		ErrorHandler: jwtError,
+		KeyFunc:        keys,
+		Claims:         &model.TokenClaims{},
+		ErrorHandler:   jwtError,
+		SuccessHandler: checkSession(unverifiedPolicy),
+	})
+}
+
+// NewWebSocketAuthMiddleware accepts the access token either as a Bearer
+// Authorization header or as a "token" query parameter, because browsers
+// cannot set headers on a WebSocket handshake.
+//
+// Under the read_only policy the socket is still accepted; ReadOnlyKey
+// tells the gateway to refuse writes.
+func NewWebSocketAuthMiddleware(keys jwt.Keyfunc, unverifiedPolicy string) fiber.Handler {
+	return jwtware.New(jwtware.Config{
+		KeyFunc:        keys,
+		Claims:         &model.TokenClaims{},
+		ErrorHandler:   jwtError,
+		SuccessHandler: checkSession(unverifiedPolicy),
+		TokenLookup:    "header:Authorization,query:token",
+		AuthScheme:     "Bearer",
+	})
+}
+
+// checkSession rejects access tokens whose session was signed out, even
+// though the token itself has not expired yet, and applies the policy for
+// users who haven't verified their email address.
+func checkSession(unverifiedPolicy string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		token := c.Locals("user").(*jwt.Token)
+		claims := token.Claims.(*model.TokenClaims)
+		if claims.Type != model.TokenTypeAccess {
+			return jwtError(c, errNotAccessToken)
+		}
+		userID, err := claims.UserID()
+		if err != nil {
+			return jwtError(c, err)
+		}
+
+		var session model.Session
+		err = database.DB.Preload("User").
+			Where("id = ? AND user_id = ? AND revoked_at IS NULL", claims.SessionID, userID).
+			First(&session).Error
+		if err != nil {
+			return jwtError(c, errSessionRevoked)
+		}
+		if session.User.SuspendedAt != nil {
+			return accountSuspended(c)
+		}
+		c.Locals(ClaimsKey, claims)
+		c.Locals(CurrentUserKey, session.User)
+
+		if session.User.EmailVerifiedAt == nil {
+			switch unverifiedPolicy {
+			case config.UnverifiedDeny:
+				return emailNotVerified(c)
+			case config.UnverifiedReadOnly:
+				c.Locals(ReadOnlyKey, true)
+				if c.Method() != fiber.MethodGet && c.Method() != fiber.MethodHead && !readOnlyAllowed[c.Path()] {
+					return emailNotVerified(c)
+				}
+			}
+		}
+		return c.Next()
+	}
+}
+
+func emailNotVerified(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusForbidden).JSON(model.ErrorResponse{
+		Status:  "error",
+		Message: "Verify your email address to do this",
+		Errors:  "Email not verified",
+	})
+}
+
+func accountSuspended(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusForbidden).JSON(model.ErrorResponse{
+		Status:  "error",
+		Message: "Your account has been suspended",
+		Errors:  "Account suspended",
 	})
 }
 
@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/kazimovzaman2/Go-jwt-gorm/model"
+)
+
+// Locals set by NewAuthMiddleware and NewWebSocketAuthMiddleware. They are
+// copied onto WebSocket connections as well.
+const (
+	ClaimsKey      = "claims"
+	CurrentUserKey = "current_user"
+	ReadOnlyKey    = "read_only"
+)
+
+// CurrentUser returns the authenticated user, loaded fresh from the
+// database for this request.
+func CurrentUser(c *fiber.Ctx) model.User {
+	return c.Locals(CurrentUserKey).(model.User)
+}
+
+// CurrentClaims returns the claims of the access token of this request.
+func CurrentClaims(c *fiber.Ctx) *model.TokenClaims {
+	return c.Locals(ClaimsKey).(*model.TokenClaims)
+}
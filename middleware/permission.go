@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/kazimovzaman2/Go-jwt-gorm/database"
+	"github.com/kazimovzaman2/Go-jwt-gorm/model"
+	"gorm.io/gorm"
+)
+
+// RequirePermission lets a request through only if the current user holds
+// every given permission through one of their roles. It goes after
+// NewAuthMiddleware:
+//
+//	admin.Get("/users/", protected, middleware.RequirePermission(model.PermissionUsersRead), handler.AdminListUsers)
+func RequirePermission(permissions ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ok, err := HasPermissions(database.DB, CurrentUser(c).ID, permissions...)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(model.ErrorResponse{
+				Status:  "error",
+				Message: "Couldn't check permissions",
+				Errors:  err.Error(),
+			})
+		}
+		if !ok {
+			return c.Status(fiber.StatusForbidden).JSON(model.ErrorResponse{
+				Status:  "error",
+				Message: "You don't have permission to do this",
+				Errors:  "Forbidden",
+			})
+		}
+		return c.Next()
+	}
+}
+
+// HasPermissions reports whether userID holds all of permissions.
+func HasPermissions(db *gorm.DB, userID uint, permissions ...string) (bool, error) {
+	wanted := make(map[string]bool, len(permissions))
+	for _, permission := range permissions {
+		wanted[permission] = true
+	}
+	if len(wanted) == 0 {
+		return true, nil
+	}
+
+	var held int
+	err := db.Raw(`
+		SELECT COUNT(DISTINCT p.name)
+		FROM user_roles ur
+		JOIN role_permissions rp ON rp.role_id = ur.role_id
+		JOIN permissions p ON p.id = rp.permission_id
+		WHERE ur.user_id = ? AND p.name IN ?`,
+		userID, permissions,
+	).Scan(&held).Error
+	return held == len(wanted), err
+}
+
+// UserPermissions returns the names of the permissions userID holds.
+func UserPermissions(db *gorm.DB, userID uint) (map[string]bool, error) {
+	var names []string
+	err := db.Raw(`
+		SELECT DISTINCT p.name
+		FROM user_roles ur
+		JOIN role_permissions rp ON rp.role_id = ur.role_id
+		JOIN permissions p ON p.id = rp.permission_id
+		WHERE ur.user_id = ?`,
+		userID,
+	).Scan(&names).Error
+
+	permissions := make(map[string]bool, len(names))
+	for _, name := range names {
+		permissions[name] = true
+	}
+	return permissions, err
+}
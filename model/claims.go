@@ -0,0 +1,28 @@
+package model
+
+import (
+	"strconv"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	TokenTypeAccess    = "access"
+	TokenTypeRefresh   = "refresh"
+	TokenTypeChallenge = "2fa_challenge"
+)
+
+// TokenClaims are the claims of every token we issue. Subject is the user
+// ID, which never changes, unlike the email address. Type keeps access,
+// refresh and challenge tokens from being used in place of each other.
+type TokenClaims struct {
+	jwt.RegisteredClaims
+	Type      string `json:"typ"`
+	SessionID string `json:"sid,omitempty"`
+}
+
+// UserID parses the subject.
+func (c *TokenClaims) UserID() (uint, error) {
+	id, err := strconv.ParseUint(c.Subject, 10, 0)
+	return uint(id), err
+}
@@ -0,0 +1,98 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	ConversationTypeDirect = "direct"
+	ConversationTypeGroup  = "group"
+)
+
+// Member roles only matter in group conversations. Owners can do everything
+// admins can, plus promote and demote admins.
+const (
+	MemberRoleOwner  = "owner"
+	MemberRoleAdmin  = "admin"
+	MemberRoleMember = "member"
+)
+
+type Conversation struct {
+	gorm.Model
+	Type        string `gorm:"size:16;not null;default:group;" json:"type"`
+	Name        string `gorm:"size:255;" json:"name"`
+	Avatar      string `json:"avatar"`
+	CreatedByID uint   `gorm:"not null;" json:"created_by_id"`
+	// DirectKey is "<lower user ID>:<higher user ID>" for direct conversations
+	// and NULL for groups. Its unique index keeps one thread per pair.
+	DirectKey *string              `gorm:"size:64;uniqueIndex;" json:"-"`
+	Members   []ConversationMember `json:"members"`
+}
+
+// ConversationMember is hard-deleted on removal so the unique
+// (conversation_id, user_id) pair can be re-added later.
+type ConversationMember struct {
+	ID             uint   `gorm:"primaryKey"`
+	ConversationID uint   `gorm:"not null;uniqueIndex:idx_conversation_members_conversation_user;"`
+	UserID         uint   `gorm:"not null;uniqueIndex:idx_conversation_members_conversation_user;index;"`
+	User           User   `gorm:"constraint:OnDelete:CASCADE;"`
+	Role           string `gorm:"size:16;not null;default:member;"`
+	// LastReadMessageID only ever moves forward.
+	LastReadMessageID *uint
+	LastReadAt        *time.Time
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+}
+
+type ConversationResponse struct {
+	ID          uint             `json:"id"`
+	Type        string           `json:"type"`
+	Name        string           `json:"name"`
+	Avatar      string           `json:"avatar"`
+	CreatedByID uint             `json:"created_by_id"`
+	Members     []MemberResponse `json:"members"`
+	LastMessage *MessageResponse `json:"last_message"`
+	UnreadCount int              `json:"unread_count"`
+	CreatedAt   string           `json:"created_at"`
+	UpdatedAt   string           `json:"updated_at"`
+}
+
+type MemberResponse struct {
+	User              UserResponse `json:"user"`
+	Role              string       `json:"role"`
+	LastReadMessageID *uint        `json:"last_read_message_id"`
+	JoinedAt          string       `json:"joined_at"`
+}
+
+type CreateConversationInput struct {
+	Name      string `json:"name" validate:"max=255"`
+	MemberIDs []uint `json:"member_ids" validate:"required,min=1"`
+}
+
+type UpdateConversationInput struct {
+	Name   *string `json:"name" validate:"omitempty,max=255"`
+	Avatar *string `json:"avatar"`
+}
+
+type AddMembersInput struct {
+	UserIDs []uint `json:"user_ids" validate:"required,min=1"`
+}
+
+type MarkReadInput struct {
+	// MessageID defaults to the newest message of the conversation
+	MessageID *uint `json:"message_id"`
+}
+
+type ReadReceiptResponse struct {
+	UserID            uint   `json:"user_id"`
+	LastReadMessageID uint   `json:"last_read_message_id"`
+	UnreadCount       int    `json:"unread_count"`
+	ReadAt            string `json:"read_at"`
+}
+
+type SeenByResponse struct {
+	User   UserResponse `json:"user"`
+	ReadAt string       `json:"read_at"`
+}
@@ -0,0 +1,20 @@
+package model
+
+import "time"
+
+// EmailChangeToken is a single-use link sent to NewEmail. The address only
+// replaces the user's email once the link is opened, proving it is theirs.
+type EmailChangeToken struct {
+	ID        uint      `gorm:"primaryKey;"`
+	UserID    uint      `gorm:"not null;index;"`
+	User      User      `gorm:"constraint:OnDelete:CASCADE;"`
+	NewEmail  string    `gorm:"size:255;not null;"`
+	TokenHash string    `gorm:"size:64;not null;uniqueIndex;"`
+	ExpiresAt time.Time `gorm:"not null;"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+type ConfirmEmailChangeInput struct {
+	Token string `json:"token" validate:"required"`
+}
@@ -0,0 +1,21 @@
+package model
+
+import "time"
+
+// EmailVerificationToken is a single-use link proving the user owns Email.
+// Email is kept so that a link sent before an address change can't verify
+// the new address.
+type EmailVerificationToken struct {
+	ID        uint      `gorm:"primaryKey;"`
+	UserID    uint      `gorm:"not null;index;"`
+	User      User      `gorm:"constraint:OnDelete:CASCADE;"`
+	Email     string    `gorm:"size:255;not null;"`
+	TokenHash string    `gorm:"size:64;not null;uniqueIndex;"`
+	ExpiresAt time.Time `gorm:"not null;"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+type VerifyEmailInput struct {
+	Token string `json:"token" validate:"required"`
+}
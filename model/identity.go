@@ -0,0 +1,58 @@
+package model
+
+import "time"
+
+// Identity links a user to an account at an external sign-in provider.
+// Subject is the provider's stable ID for that account; the email address
+// is only kept for display, since it can change on the provider's side.
+type Identity struct {
+	ID         uint   `gorm:"primaryKey;"`
+	UserID     uint   `gorm:"not null;uniqueIndex:idx_identities_user_provider;"`
+	User       User   `gorm:"constraint:OnDelete:CASCADE;"`
+	Provider   string `gorm:"size:64;not null;uniqueIndex:idx_identities_subject;uniqueIndex:idx_identities_user_provider;"`
+	Subject    string `gorm:"size:255;not null;uniqueIndex:idx_identities_subject;"`
+	Email      string `gorm:"size:255;"`
+	LastUsedAt *time.Time
+	CreatedAt  time.Time
+}
+
+// OAuthFlow keeps the state, PKCE verifier and nonce of a provider sign-in
+// between its begin and finish requests, which may hit different processes.
+// UserID is set when a signed-in user links a new identity.
+// BrowserNonceHash binds the flow to the browser that began it, which holds
+// the nonce in a cookie, so a state can't be finished in someone else's.
+type OAuthFlow struct {
+	ID               uint      `gorm:"primaryKey;"`
+	StateHash        string    `gorm:"size:64;not null;uniqueIndex;"`
+	BrowserNonceHash string    `gorm:"size:64;not null;default:'';"`
+	UserID           *uint     `gorm:"index;"`
+	Provider         string    `gorm:"size:64;not null;"`
+	CodeVerifier     string    `gorm:"size:128;not null;"`
+	Nonce            string    `gorm:"size:64;not null;"`
+	ExpiresAt        time.Time `gorm:"not null;index;"`
+	CreatedAt        time.Time
+}
+
+type OAuthProviderResponse struct {
+	Name string `json:"name"`
+}
+
+type OAuthBeginResponse struct {
+	// AuthorizationURL is where to send the browser. The provider redirects
+	// back to the configured callback with code and state.
+	AuthorizationURL string `json:"authorization_url"`
+	State            string `json:"state"`
+}
+
+type OAuthFinishInput struct {
+	State string `json:"state" validate:"required"`
+	Code  string `json:"code" validate:"required"`
+}
+
+type IdentityResponse struct {
+	ID         uint    `json:"id"`
+	Provider   string  `json:"provider"`
+	Email      string  `json:"email"`
+	LastUsedAt *string `json:"last_used_at"`
+	CreatedAt  string  `json:"created_at"`
+}
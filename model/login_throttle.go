@@ -0,0 +1,12 @@
+package model
+
+import "time"
+
+// LoginThrottle counts recent failed logins for one key, either an account
+// ("email:<address>") or a client ("ip:<address>").
+type LoginThrottle struct {
+	Key         string `gorm:"primaryKey;size:320;"`
+	Failures    int    `gorm:"not null;default:0;"`
+	LockedUntil *time.Time
+	UpdatedAt   time.Time `gorm:"not null;"`
+}
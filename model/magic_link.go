@@ -0,0 +1,31 @@
+package model
+
+import "time"
+
+// MagicLinkToken is a single-use sign-in link. NonceHash ties it to the
+// browser that asked for it: the link only works together with the nonce
+// that browser got back, so a link opened anywhere else is useless.
+type MagicLinkToken struct {
+	ID        uint      `gorm:"primaryKey;"`
+	UserID    uint      `gorm:"not null;index;"`
+	User      User      `gorm:"constraint:OnDelete:CASCADE;"`
+	TokenHash string    `gorm:"size:64;not null;uniqueIndex;"`
+	NonceHash string    `gorm:"size:64;not null;"`
+	ExpiresAt time.Time `gorm:"not null;"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+type MagicLinkRequestInput struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type MagicLinkResponse struct {
+	// Nonce must be kept by the client and sent along with the token
+	Nonce string `json:"nonce"`
+}
+
+type MagicLinkLoginInput struct {
+	Token string `json:"token" validate:"required"`
+	Nonce string `json:"nonce" validate:"required"`
+}
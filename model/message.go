@@ -0,0 +1,92 @@
+package model
+
+import "time"
+
+// Message has an explicit ID so history can be paged by (conversation_id, id).
+type Message struct {
+	ID             uint         `gorm:"primaryKey;index:idx_messages_conversation_id_id,priority:2;"`
+	ConversationID uint         `gorm:"not null;index:idx_messages_conversation_id_id,priority:1;"`
+	Conversation   Conversation `gorm:"constraint:OnDelete:CASCADE;"`
+	SenderID       uint         `gorm:"not null;index;"`
+	Sender         User         `gorm:"constraint:OnDelete:CASCADE;"`
+	Body           string       `gorm:"type:text;not null;"`
+	// ParentID points at the root of the thread this message replies to.
+	// Threads are one level deep: replies to a reply join the same root.
+	ParentID    *uint `gorm:"index;"`
+	ReplyCount  int   `gorm:"not null;default:0;"`
+	LastReplyAt *time.Time
+	// QuotedID is an inline quote-reply, independent of threads.
+	QuotedID *uint
+	Quoted   *Message `gorm:"foreignKey:QuotedID;constraint:OnDelete:SET NULL;"`
+	EditedAt *time.Time
+	// DeletedAt is a plain timestamp rather than gorm.DeletedAt on purpose:
+	// deleted messages stay in the timeline as placeholders.
+	DeletedAt *time.Time
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// MessageRevision keeps the body a message had before each edit or delete.
+type MessageRevision struct {
+	ID        uint    `gorm:"primaryKey"`
+	MessageID uint    `gorm:"not null;index;"`
+	Message   Message `gorm:"constraint:OnDelete:CASCADE;"`
+	EditorID  uint    `gorm:"not null;"`
+	Body      string  `gorm:"type:text;not null;"`
+	CreatedAt time.Time
+}
+
+type MessageResponse struct {
+	ID             uint           `json:"id"`
+	ConversationID uint           `json:"conversation_id"`
+	SenderID       uint           `json:"sender_id"`
+	Body           string         `json:"body"`
+	Deleted        bool           `json:"deleted"`
+	ParentID       *uint          `json:"parent_id"`
+	ReplyCount     int            `json:"reply_count"`
+	LastReplyAt    *string        `json:"last_reply_at"`
+	Quote          *QuoteResponse `json:"quote"`
+	// Reactions are only filled in by REST listings; realtime events omit
+	// them and announce changes as reaction.added and reaction.removed.
+	Reactions []ReactionSummary `json:"reactions,omitempty"`
+	EditedAt  *string           `json:"edited_at"`
+	CreatedAt string            `json:"created_at"`
+	UpdatedAt string            `json:"updated_at"`
+}
+
+type QuoteResponse struct {
+	ID       uint   `json:"id"`
+	SenderID uint   `json:"sender_id"`
+	Snippet  string `json:"snippet"`
+	Deleted  bool   `json:"deleted"`
+}
+
+type ThreadResponse struct {
+	Root         MessageResponse   `json:"root"`
+	Replies      []MessageResponse `json:"replies"`
+	Participants []UserResponse    `json:"participants"`
+	NextCursor   uint              `json:"next_cursor"`
+}
+
+type MessageRevisionResponse struct {
+	ID        uint   `json:"id"`
+	MessageID uint   `json:"message_id"`
+	EditorID  uint   `json:"editor_id"`
+	Body      string `json:"body"`
+	CreatedAt string `json:"created_at"`
+}
+
+type SendMessageInput struct {
+	Body     string `json:"body" validate:"required,max=4000"`
+	ParentID *uint  `json:"parent_id"`
+	QuotedID *uint  `json:"quoted_id"`
+}
+
+type EditMessageInput struct {
+	Body string `json:"body" validate:"required,max=4000"`
+}
+
+type MessagePageResponse struct {
+	Messages   []MessageResponse `json:"messages"`
+	NextCursor uint              `json:"next_cursor"`
+}
@@ -0,0 +1,66 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	PasskeyCeremonyRegistration = "registration"
+	PasskeyCeremonyLogin        = "login"
+)
+
+// Passkey is a WebAuthn credential registered by a user. Credential holds
+// the JSON-encoded webauthn.Credential, including its public key and
+// signature counter.
+type Passkey struct {
+	ID           uint   `gorm:"primaryKey;"`
+	UserID       uint   `gorm:"not null;index;"`
+	User         User   `gorm:"constraint:OnDelete:CASCADE;"`
+	Name         string `gorm:"size:100;not null;"`
+	CredentialID []byte `gorm:"not null;uniqueIndex;"`
+	Credential   string `gorm:"type:text;not null;"`
+	LastUsedAt   *time.Time
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+// PasskeyCeremony keeps the challenge of a registration or login between
+// its begin and finish requests, which may hit different processes.
+type PasskeyCeremony struct {
+	ID          string    `gorm:"primaryKey;size:36;"`
+	UserID      *uint     `gorm:"index;"`
+	Kind        string    `gorm:"size:16;not null;"`
+	SessionData string    `gorm:"type:text;not null;"`
+	ExpiresAt   time.Time `gorm:"not null;index;"`
+	CreatedAt   time.Time
+}
+
+type PasskeyResponse struct {
+	ID         uint    `json:"id"`
+	Name       string  `json:"name"`
+	CreatedAt  string  `json:"created_at"`
+	LastUsedAt *string `json:"last_used_at"`
+}
+
+// PasskeyOptionsResponse carries the options to pass to
+// navigator.credentials.create() or .get(), and the ceremony to finish.
+type PasskeyOptionsResponse struct {
+	CeremonyID string      `json:"ceremony_id"`
+	Options    interface{} `json:"options"`
+}
+
+type RegisterPasskeyInput struct {
+	CeremonyID string          `json:"ceremony_id" validate:"required"`
+	Name       string          `json:"name" validate:"required,max=100"`
+	Credential json.RawMessage `json:"credential" validate:"required" swaggertype:"object"`
+}
+
+type RenamePasskeyInput struct {
+	Name string `json:"name" validate:"required,max=100"`
+}
+
+type PasskeyLoginInput struct {
+	CeremonyID string          `json:"ceremony_id" validate:"required"`
+	Credential json.RawMessage `json:"credential" validate:"required" swaggertype:"object"`
+}
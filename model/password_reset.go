@@ -0,0 +1,24 @@
+package model
+
+import "time"
+
+// PasswordResetToken is a single-use reset link. Only the hash of the token
+// is stored, so a leaked table can't be used to take over accounts.
+type PasswordResetToken struct {
+	ID        uint      `gorm:"primaryKey;"`
+	UserID    uint      `gorm:"not null;index;"`
+	User      User      `gorm:"constraint:OnDelete:CASCADE;"`
+	TokenHash string    `gorm:"size:64;not null;uniqueIndex;"`
+	ExpiresAt time.Time `gorm:"not null;"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+type PasswordResetRequestInput struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type PasswordResetConfirmInput struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required,gte=8"`
+}
@@ -0,0 +1,35 @@
+package model
+
+import "time"
+
+const (
+	PresenceOnline  = "online"
+	PresenceAway    = "away"
+	PresenceOffline = "offline"
+)
+
+// PresenceConnection is one open socket. A user is online while any of
+// their connections is online, away while all of them are away, and offline
+// when none is left or none has been refreshed recently.
+type PresenceConnection struct {
+	ID     string    `gorm:"primaryKey;size:36;"`
+	UserID uint      `gorm:"not null;index;"`
+	User   User      `gorm:"constraint:OnDelete:CASCADE;"`
+	Status string    `gorm:"size:16;not null;"`
+	SeenAt time.Time `gorm:"not null;index;"`
+}
+
+type PresenceResponse struct {
+	UserID     uint    `json:"user_id"`
+	Status     string  `json:"status"`
+	LastSeenAt *string `json:"last_seen_at"`
+}
+
+type SetPresenceInput struct {
+	Status string `json:"status" validate:"required,oneof=online away"`
+}
+
+type TypingEventData struct {
+	UserID uint `json:"user_id"`
+	Typing bool `json:"typing"`
+}
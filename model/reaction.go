@@ -0,0 +1,32 @@
+package model
+
+import "time"
+
+// MessageReaction is one user's emoji on a message. The unique index lets a
+// user use each emoji only once per message.
+type MessageReaction struct {
+	ID        uint    `gorm:"primaryKey"`
+	MessageID uint    `gorm:"not null;uniqueIndex:idx_message_reactions_message_user_emoji;"`
+	Message   Message `gorm:"constraint:OnDelete:CASCADE;"`
+	UserID    uint    `gorm:"not null;uniqueIndex:idx_message_reactions_message_user_emoji;"`
+	User      User    `gorm:"constraint:OnDelete:CASCADE;"`
+	Emoji     string  `gorm:"size:64;not null;uniqueIndex:idx_message_reactions_message_user_emoji;"`
+	CreatedAt time.Time
+}
+
+type ReactionSummary struct {
+	Emoji   string `json:"emoji"`
+	Count   int    `json:"count"`
+	Reacted bool   `json:"reacted"`
+}
+
+type ReactionEventData struct {
+	MessageID uint   `json:"message_id"`
+	UserID    uint   `json:"user_id"`
+	Emoji     string `json:"emoji"`
+	Count     int    `json:"count"`
+}
+
+type ReactionInput struct {
+	Emoji string `json:"emoji" validate:"required,max=64,emoji"`
+}
@@ -0,0 +1,11 @@
+package model
+
+import "time"
+
+// RealtimeEvent holds a delivery too large for a Postgres NOTIFY payload
+// until every process has picked it up.
+type RealtimeEvent struct {
+	ID        uint      `gorm:"primaryKey"`
+	Payload   string    `gorm:"type:text;not null;"`
+	CreatedAt time.Time `gorm:"index;"`
+}
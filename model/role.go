@@ -0,0 +1,61 @@
+package model
+
+import "time"
+
+// Permissions checked by middleware.RequirePermission.
+const (
+	PermissionUsersRead          = "users.read"
+	PermissionUsersSuspend       = "users.suspend"
+	PermissionUsersDelete        = "users.delete"
+	PermissionUsersResetPassword = "users.reset_password"
+	PermissionRolesAssign        = "roles.assign"
+)
+
+// RoleAdmin holds every permission. It is created at startup.
+const RoleAdmin = "admin"
+
+// AllPermissions lists every permission with its description.
+var AllPermissions = map[string]string{
+	PermissionUsersRead:          "List and search all users",
+	PermissionUsersSuspend:       "Suspend and unsuspend users",
+	PermissionUsersDelete:        "Delete users",
+	PermissionUsersResetPassword: "Force users to reset their password",
+	PermissionRolesAssign:        "Assign roles to users",
+}
+
+type Permission struct {
+	ID          uint   `gorm:"primaryKey;"`
+	Name        string `gorm:"size:64;not null;uniqueIndex;"`
+	Description string `gorm:"size:255;not null;"`
+}
+
+// Role groups permissions. Users get permissions only through roles.
+type Role struct {
+	ID          uint         `gorm:"primaryKey;"`
+	Name        string       `gorm:"size:64;not null;uniqueIndex;"`
+	Description string       `gorm:"size:255;not null;"`
+	Permissions []Permission `gorm:"many2many:role_permissions;constraint:OnDelete:CASCADE;"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+type RoleResponse struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+type AdminUserResponse struct {
+	MeResponse
+	Roles       []string `json:"roles"`
+	SuspendedAt *string  `json:"suspended_at"`
+}
+
+type AdminUserPageResponse struct {
+	Users      []AdminUserResponse `json:"users"`
+	NextCursor uint                `json:"next_cursor"`
+}
+
+type AssignRolesInput struct {
+	Roles []string `json:"roles" validate:"required,dive,required"`
+}
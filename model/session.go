@@ -0,0 +1,37 @@
+package model
+
+import "time"
+
+// Session is one login. Every refresh token issued for it belongs to the
+// same family, so revoking the session revokes all of them at once.
+type Session struct {
+	ID         string    `gorm:"primaryKey;size:36;"`
+	UserID     uint      `gorm:"not null;index;"`
+	User       User      `gorm:"constraint:OnDelete:CASCADE;"`
+	UserAgent  string    `gorm:"size:512;"`
+	IP         string    `gorm:"size:64;"`
+	LastUsedAt time.Time `gorm:"not null;default:CURRENT_TIMESTAMP;"`
+	RevokedAt  *time.Time
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// RefreshToken is a single-use refresh token, identified by the jti claim
+// of the JWT handed to the client. UsedAt is set when it is rotated.
+type RefreshToken struct {
+	ID        string    `gorm:"primaryKey;size:36;"`
+	SessionID string    `gorm:"size:36;not null;index;"`
+	Session   Session   `gorm:"constraint:OnDelete:CASCADE;"`
+	ExpiresAt time.Time `gorm:"not null;"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+type SessionResponse struct {
+	ID         string `json:"id"`
+	UserAgent  string `json:"user_agent"`
+	IP         string `json:"ip"`
+	Current    bool   `json:"current"`
+	CreatedAt  string `json:"created_at"`
+	LastUsedAt string `json:"last_used_at"`
+}
@@ -0,0 +1,40 @@
+package model
+
+import "time"
+
+// RecoveryCode is a one-time code that can stand in for a TOTP code, e.g.
+// when the authenticator device is lost. Only its hash is stored.
+type RecoveryCode struct {
+	ID        uint   `gorm:"primaryKey;"`
+	UserID    uint   `gorm:"not null;index;"`
+	User      User   `gorm:"constraint:OnDelete:CASCADE;"`
+	CodeHash  string `gorm:"size:64;not null;"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+type TOTPSetupResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+	QRCode string `json:"qr_code"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type TwoFactorCodeInput struct {
+	Code string `json:"code" validate:"required,max=32"`
+}
+
+// TwoFactorChangeInput confirms turning off two-factor authentication or
+// replacing the recovery codes.
+type TwoFactorChangeInput struct {
+	Password string `json:"password" validate:"required"`
+	Code     string `json:"code" validate:"required,max=32"`
+}
+
+type TwoFactorLoginInput struct {
+	ChallengeToken string `json:"challenge_token" validate:"required"`
+	Code           string `json:"code" validate:"required,max=32"`
+}
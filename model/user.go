@@ -1,24 +1,49 @@
 package model
 
-import "gorm.io/gorm"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
 
 type User struct {
 	gorm.Model
-	Email        string `gorm:"uniqueIndex;not null;size:255;" validate:"required,email" json:"email" form:"email"`
-	Password     string `gorm:"not null;" validate:"required,gte=8" json:"password" form:"password"`
-	FirstName    string `gorm:"size:255;not null;" validate:"required" json:"first_name" form:"first_name"`
-	LastName     string `gorm:"size:255;not null;" validate:"required" json:"last_name" form:"last_name"`
-	ProfileImage string `json:"profile_image" form:"profile_image"`
+	Email           string     `gorm:"uniqueIndex;not null;size:255;" validate:"required,email" json:"email" form:"email"`
+	Password        string     `gorm:"not null;" validate:"required,gte=8" json:"password" form:"password"`
+	FirstName       string     `gorm:"size:255;not null;" validate:"required" json:"first_name" form:"first_name"`
+	LastName        string     `gorm:"size:255;not null;" validate:"required" json:"last_name" form:"last_name"`
+	ProfileImage    string     `json:"profile_image" form:"profile_image"`
+	LastSeenAt      *time.Time `json:"-" form:"-"`
+	EmailVerifiedAt *time.Time `json:"-" form:"-"`
+	TOTPSecret      string     `json:"-" form:"-"`
+	TOTPEnabledAt   *time.Time `json:"-" form:"-"`
+	TOTPLastCounter int64      `gorm:"not null;default:0;" json:"-" form:"-"`
+	HideLastSeen    bool       `gorm:"not null;default:false;" json:"hide_last_seen" form:"hide_last_seen"`
+	SuspendedAt     *time.Time `json:"-" form:"-"`
+	Roles           []Role     `gorm:"many2many:user_roles;constraint:OnDelete:CASCADE;" json:"-" form:"-"`
+	// PasswordResetRequired is set when an admin forces a reset and keeps
+	// every login method shut until the user sets a new password.
+	PasswordResetRequired bool `gorm:"not null;default:false;" json:"-" form:"-"`
 }
 
 type UserResponse struct {
-	ID           uint   `json:"id"`
-	Email        string `json:"email"`
-	FirstName    string `json:"first_name"`
-	LastName     string `json:"last_name"`
-	ProfileImage string `json:"profile_image"`
-	CreatedAt    string `json:"created_at"`
-	UpdatedAt    string `json:"updated_at"`
+	ID           uint    `json:"id"`
+	Email        string  `json:"email"`
+	FirstName    string  `json:"first_name"`
+	LastName     string  `json:"last_name"`
+	ProfileImage string  `json:"profile_image"`
+	LastSeenAt   *string `json:"last_seen_at"`
+	HideLastSeen bool    `json:"hide_last_seen"`
+	CreatedAt    string  `json:"created_at"`
+	UpdatedAt    string  `json:"updated_at"`
+}
+
+// MeResponse adds the account security state, which only the user
+// themselves and admins may see.
+type MeResponse struct {
+	UserResponse
+	EmailVerifiedAt  *string `json:"email_verified_at"`
+	TwoFactorEnabled bool    `json:"two_factor_enabled"`
 }
 
 type LoginInput struct {
@@ -29,3 +54,22 @@ type LoginInput struct {
 type RefreshTokenInput struct {
 	RefreshToken string `json:"refresh_token"`
 }
+
+// UpdateMeInput lists the profile fields a user may change directly. The
+// email address and password have their own endpoints.
+type UpdateMeInput struct {
+	FirstName    *string `json:"first_name" validate:"omitempty,min=1,max=255"`
+	LastName     *string `json:"last_name" validate:"omitempty,min=1,max=255"`
+	ProfileImage *string `json:"profile_image"`
+	HideLastSeen *bool   `json:"hide_last_seen"`
+}
+
+type ChangePasswordInput struct {
+	CurrentPassword string `json:"current_password" validate:"required"`
+	NewPassword     string `json:"new_password" validate:"required,gte=8"`
+}
+
+type ChangeEmailInput struct {
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required"`
+}
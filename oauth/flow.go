@@ -0,0 +1,93 @@
+package oauth
+
+import (
+	"errors"
+	"time"
+
+	"github.com/kazimovzaman2/Go-jwt-gorm/model"
+	"github.com/kazimovzaman2/Go-jwt-gorm/utils"
+	"golang.org/x/oauth2"
+	"gorm.io/gorm"
+)
+
+// FlowTTL is how long the user has to sign in at the provider.
+const FlowTTL = 10 * time.Minute
+
+var ErrFlowNotFound = errors.New("sign-in flow not found or expired")
+
+// BeginFlow stores a new flow for provider and returns the URL to send the
+// browser to, the state the provider will hand back and the browser nonce
+// the browser must present to finish. userID is set when a signed-in user
+// links an identity, and nil for logins.
+func BeginFlow(db *gorm.DB, provider *Provider, userID *uint) (string, string, string, error) {
+	state, stateHash, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return "", "", "", err
+	}
+	browserNonce, browserNonceHash, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return "", "", "", err
+	}
+	nonce, _, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return "", "", "", err
+	}
+	codeVerifier := oauth2.GenerateVerifier()
+
+	authURL, err := provider.AuthCodeURL(state, codeVerifier, nonce)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	flow := model.OAuthFlow{
+		StateHash:        stateHash,
+		BrowserNonceHash: browserNonceHash,
+		UserID:           userID,
+		Provider:         provider.Name,
+		CodeVerifier:     codeVerifier,
+		Nonce:            nonce,
+		ExpiresAt:        time.Now().Add(FlowTTL),
+	}
+	if err := db.Create(&flow).Error; err != nil {
+		return "", "", "", err
+	}
+
+	// Drop flows that were started and never finished.
+	db.Where("expires_at < ?", time.Now()).Delete(&model.OAuthFlow{})
+
+	return authURL, state, browserNonce, nil
+}
+
+// TakeFlow loads and deletes the flow of state, so each state can be used
+// only once. browserNonce must be the one BeginFlow returned, so a state
+// leaked or planted by an attacker can't be finished in another browser.
+// userID must match the user who began it, or be nil for logins.
+func TakeFlow(db *gorm.DB, state string, browserNonce string, userID *uint) (model.OAuthFlow, error) {
+	var flow model.OAuthFlow
+	if browserNonce == "" {
+		return flow, ErrFlowNotFound
+	}
+
+	// A wrong nonce leaves the flow alone, so it can still be finished in
+	// the browser that began it.
+	query := db.Where("state_hash = ? AND browser_nonce_hash = ? AND expires_at > ?",
+		utils.HashOpaqueToken(state), utils.HashOpaqueToken(browserNonce), time.Now())
+	if userID != nil {
+		query = query.Where("user_id = ?", *userID)
+	} else {
+		query = query.Where("user_id IS NULL")
+	}
+
+	if err := query.First(&flow).Error; err != nil {
+		return flow, ErrFlowNotFound
+	}
+
+	result := db.Delete(&model.OAuthFlow{}, flow.ID)
+	if result.Error != nil {
+		return flow, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return flow, ErrFlowNotFound
+	}
+	return flow, nil
+}
@@ -0,0 +1,169 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/kazimovzaman2/Go-jwt-gorm/config"
+	"golang.org/x/oauth2"
+)
+
+// requestTimeout bounds every call to a provider, including discovery.
+const requestTimeout = 15 * time.Second
+
+var ErrNonceMismatch = errors.New("id token nonce does not match")
+
+// Identity is what a provider tells us about the account that signed in.
+type Identity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	FirstName     string
+	LastName      string
+}
+
+// Provider signs users in through one OAuth2 or OpenID Connect provider.
+// Discovery happens on first use and is retried until it succeeds, so a
+// provider that is down at startup doesn't take the others with it.
+type Provider struct {
+	Name string
+
+	config      config.OAuthProviderConfig
+	redirectURL string
+	httpClient  *http.Client
+
+	mu       sync.Mutex
+	oauth2   *oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+func NewProvider(name string, providerConfig config.OAuthProviderConfig, redirectURL string) (*Provider, error) {
+	if providerConfig.ClientID == "" {
+		return nil, fmt.Errorf("oauth provider %q: client ID is missing", name)
+	}
+	if providerConfig.Issuer == "" && (providerConfig.AuthURL == "" || providerConfig.TokenURL == "" || providerConfig.UserInfoURL == "") {
+		return nil, fmt.Errorf("oauth provider %q: either an issuer or auth, token and userinfo URLs are required", name)
+	}
+
+	return &Provider{
+		Name:        name,
+		config:      providerConfig,
+		redirectURL: redirectURL,
+		httpClient:  &http.Client{Timeout: requestTimeout},
+	}, nil
+}
+
+// context returns a context whose HTTP calls go through the provider's client.
+func (p *Provider) context() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	return oidc.ClientContext(ctx, p.httpClient), cancel
+}
+
+func (p *Provider) load() (*oauth2.Config, *oidc.IDTokenVerifier, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.oauth2 != nil {
+		return p.oauth2, p.verifier, nil
+	}
+
+	endpoint := oauth2.Endpoint{
+		AuthURL:  p.config.AuthURL,
+		TokenURL: p.config.TokenURL,
+	}
+	var verifier *oidc.IDTokenVerifier
+	if p.config.Issuer != "" {
+		// The discovered key set keeps using this client, but not the
+		// timeout, to refresh keys later on.
+		ctx, cancel := p.context()
+		defer cancel()
+
+		provider, err := oidc.NewProvider(ctx, p.config.Issuer)
+		if err != nil {
+			return nil, nil, err
+		}
+		endpoint = provider.Endpoint()
+		verifier = provider.Verifier(&oidc.Config{ClientID: p.config.ClientID})
+	}
+
+	p.oauth2 = &oauth2.Config{
+		ClientID:     p.config.ClientID,
+		ClientSecret: p.config.ClientSecret,
+		Endpoint:     endpoint,
+		RedirectURL:  p.redirectURL,
+		Scopes:       p.config.Scopes,
+	}
+	p.verifier = verifier
+	return p.oauth2, p.verifier, nil
+}
+
+// AuthCodeURL returns the provider URL that starts a sign-in. codeVerifier
+// is the PKCE verifier; nonce is checked against the ID token.
+func (p *Provider) AuthCodeURL(state, codeVerifier, nonce string) (string, error) {
+	oauth2Config, verifier, err := p.load()
+	if err != nil {
+		return "", err
+	}
+
+	options := []oauth2.AuthCodeOption{oauth2.S256ChallengeOption(codeVerifier)}
+	if verifier != nil {
+		options = append(options, oidc.Nonce(nonce))
+	}
+	return oauth2Config.AuthCodeURL(state, options...), nil
+}
+
+// Exchange redeems the code the provider redirected back with and returns
+// the identity that signed in.
+func (p *Provider) Exchange(code, codeVerifier, nonce string) (Identity, error) {
+	oauth2Config, verifier, err := p.load()
+	if err != nil {
+		return Identity{}, err
+	}
+
+	ctx, cancel := p.context()
+	defer cancel()
+
+	token, err := oauth2Config.Exchange(ctx, code, oauth2.VerifierOption(codeVerifier))
+	if err != nil {
+		return Identity{}, err
+	}
+
+	if verifier == nil {
+		return fetchGitHubIdentity(ctx, oauth2Config.Client(ctx, token), p.config.UserInfoURL)
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return Identity{}, errors.New("token response has no id_token")
+	}
+	idToken, err := verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return Identity{}, err
+	}
+	if idToken.Nonce != nonce {
+		return Identity{}, ErrNonceMismatch
+	}
+
+	var claims struct {
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+		GivenName     string `json:"given_name"`
+		FamilyName    string `json:"family_name"`
+	}
+	if err := idToken.Claims(&claims); err != nil {
+		return Identity{}, err
+	}
+
+	return Identity{
+		Subject:       idToken.Subject,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified,
+		FirstName:     claims.GivenName,
+		LastName:      claims.FamilyName,
+	}, nil
+}
@@ -0,0 +1,128 @@
+package oauth
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/kazimovzaman2/Go-jwt-gorm/config"
+	"github.com/kazimovzaman2/Go-jwt-gorm/oauth/oauthtest"
+	"golang.org/x/oauth2"
+)
+
+const testRedirectURL = "http://localhost:3000/oauth/callback"
+
+var testAccount = oauthtest.Account{
+	Subject:       "1234",
+	Email:         "ada@example.com",
+	EmailVerified: true,
+	GivenName:     "Ada",
+	FamilyName:    "Lovelace",
+}
+
+func newTestProvider(t *testing.T) (*Provider, *oauthtest.Server) {
+	t.Helper()
+
+	server, err := oauthtest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(server.Close)
+
+	provider, err := NewProvider("mock", config.OAuthProviderConfig{
+		Issuer:       server.Issuer(),
+		ClientID:     server.ClientID,
+		ClientSecret: server.ClientSecret,
+		Scopes:       []string{"openid", "email", "profile"},
+	}, testRedirectURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return provider, server
+}
+
+// signIn starts a sign-in with codeVerifier and nonce and returns the code
+// the provider redirects back with.
+func signIn(t *testing.T, provider *Provider, server *oauthtest.Server, codeVerifier, nonce string, account oauthtest.Account) string {
+	t.Helper()
+
+	authURL, err := provider.AuthCodeURL("state", codeVerifier, nonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, state, err := server.SignIn(authURL, account)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state != "state" {
+		t.Fatalf("provider returned state %q, want %q", state, "state")
+	}
+	return code
+}
+
+func TestExchange(t *testing.T) {
+	tests := []struct {
+		name          string
+		emailVerified bool
+	}{
+		{"verified email", true},
+		{"unverified email", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider, server := newTestProvider(t)
+			account := testAccount
+			account.EmailVerified = tt.emailVerified
+
+			codeVerifier := oauth2.GenerateVerifier()
+			code := signIn(t, provider, server, codeVerifier, "nonce", account)
+
+			identity, err := provider.Exchange(code, codeVerifier, "nonce")
+			if err != nil {
+				t.Fatalf("Exchange failed: %s", err)
+			}
+			want := Identity{
+				Subject:       account.Subject,
+				Email:         account.Email,
+				EmailVerified: tt.emailVerified,
+				FirstName:     account.GivenName,
+				LastName:      account.FamilyName,
+			}
+			if identity != want {
+				t.Fatalf("Exchange returned %+v, want %+v", identity, want)
+			}
+		})
+	}
+}
+
+func TestExchangeRejectsWrongCodeVerifier(t *testing.T) {
+	provider, server := newTestProvider(t)
+
+	code := signIn(t, provider, server, oauth2.GenerateVerifier(), "nonce", testAccount)
+	if _, err := provider.Exchange(code, oauth2.GenerateVerifier(), "nonce"); err == nil {
+		t.Fatal("Exchange with another PKCE verifier succeeded")
+	}
+}
+
+func TestExchangeRejectsNonceMismatch(t *testing.T) {
+	provider, server := newTestProvider(t)
+
+	codeVerifier := oauth2.GenerateVerifier()
+	code := signIn(t, provider, server, codeVerifier, "nonce", testAccount)
+	if _, err := provider.Exchange(code, codeVerifier, "other nonce"); !errors.Is(err, ErrNonceMismatch) {
+		t.Fatalf("Exchange with another nonce returned %v, want %v", err, ErrNonceMismatch)
+	}
+}
+
+func TestExchangeRejectsReusedCode(t *testing.T) {
+	provider, server := newTestProvider(t)
+
+	codeVerifier := oauth2.GenerateVerifier()
+	code := signIn(t, provider, server, codeVerifier, "nonce", testAccount)
+	if _, err := provider.Exchange(code, codeVerifier, "nonce"); err != nil {
+		t.Fatalf("Exchange failed: %s", err)
+	}
+	if _, err := provider.Exchange(code, codeVerifier, "nonce"); err == nil {
+		t.Fatal("Exchange of a used code succeeded")
+	}
+}
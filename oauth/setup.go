@@ -0,0 +1,69 @@
+package oauth
+
+import (
+	"sort"
+
+	"github.com/kazimovzaman2/Go-jwt-gorm/config"
+)
+
+// presets fill in what is known about well-known providers, so that only
+// their client credentials need to be configured.
+var presets = map[string]config.OAuthProviderConfig{
+	"google": {
+		Issuer: "https://accounts.google.com",
+		Scopes: []string{"openid", "email", "profile"},
+	},
+	"github": {
+		AuthURL:     "https://github.com/login/oauth/authorize",
+		TokenURL:    "https://github.com/login/oauth/access_token",
+		UserInfoURL: "https://api.github.com/user",
+		Scopes:      []string{"read:user", "user:email"},
+	},
+}
+
+// Providers is the registry of configured providers by name, set by Setup.
+// Tests can register a provider pointing at a local mock OIDC server.
+var Providers = map[string]*Provider{}
+
+// Setup builds Providers from config.OAuthProviders.
+func Setup(config *config.Config) error {
+	providers := make(map[string]*Provider, len(config.OAuthProviders))
+	for name, providerConfig := range config.OAuthProviders {
+		providerConfig = withPreset(name, providerConfig)
+
+		provider, err := NewProvider(name, providerConfig, config.OAuthRedirectURL)
+		if err != nil {
+			return err
+		}
+		providers[name] = provider
+	}
+	Providers = providers
+	return nil
+}
+
+func withPreset(name string, providerConfig config.OAuthProviderConfig) config.OAuthProviderConfig {
+	preset := presets[name]
+	if providerConfig.Issuer == "" && providerConfig.AuthURL == "" {
+		providerConfig.Issuer = preset.Issuer
+		providerConfig.AuthURL = preset.AuthURL
+		providerConfig.TokenURL = preset.TokenURL
+		providerConfig.UserInfoURL = preset.UserInfoURL
+	}
+	if len(providerConfig.Scopes) == 0 {
+		providerConfig.Scopes = preset.Scopes
+	}
+	if len(providerConfig.Scopes) == 0 && providerConfig.Issuer != "" {
+		providerConfig.Scopes = []string{"openid", "email", "profile"}
+	}
+	return providerConfig
+}
+
+// Names returns the configured provider names in order.
+func Names() []string {
+	names := make([]string, 0, len(Providers))
+	for name := range Providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,72 @@
+package passkey
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+	"github.com/kazimovzaman2/Go-jwt-gorm/model"
+	"gorm.io/gorm"
+)
+
+// CeremonyTTL is how long the user has to answer the authenticator prompt.
+const CeremonyTTL = 5 * time.Minute
+
+var ErrCeremonyNotFound = errors.New("passkey ceremony not found or expired")
+
+// SaveCeremony stores session until the matching finish request and
+// returns its ID.
+func SaveCeremony(db *gorm.DB, kind string, userID *uint, session *webauthn.SessionData) (string, error) {
+	encoded, err := json.Marshal(session)
+	if err != nil {
+		return "", err
+	}
+
+	ceremony := model.PasskeyCeremony{
+		ID:          uuid.NewString(),
+		UserID:      userID,
+		Kind:        kind,
+		SessionData: string(encoded),
+		ExpiresAt:   time.Now().Add(CeremonyTTL),
+	}
+	if err := db.Create(&ceremony).Error; err != nil {
+		return "", err
+	}
+
+	// Drop ceremonies that were started and never finished.
+	db.Where("expires_at < ?", time.Now()).Delete(&model.PasskeyCeremony{})
+
+	return ceremony.ID, nil
+}
+
+// TakeCeremony loads and deletes a ceremony, so each challenge can be
+// answered only once. userID must match the user who began it, or be nil
+// for logins.
+func TakeCeremony(db *gorm.DB, id string, kind string, userID *uint) (webauthn.SessionData, error) {
+	var session webauthn.SessionData
+
+	query := db.Where("id = ? AND kind = ? AND expires_at > ?", id, kind, time.Now())
+	if userID != nil {
+		query = query.Where("user_id = ?", *userID)
+	} else {
+		query = query.Where("user_id IS NULL")
+	}
+
+	var ceremony model.PasskeyCeremony
+	if err := query.First(&ceremony).Error; err != nil {
+		return session, ErrCeremonyNotFound
+	}
+
+	result := db.Delete(&model.PasskeyCeremony{}, "id = ?", ceremony.ID)
+	if result.Error != nil {
+		return session, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return session, ErrCeremonyNotFound
+	}
+
+	err := json.Unmarshal([]byte(ceremony.SessionData), &session)
+	return session, err
+}
@@ -0,0 +1,107 @@
+package passkey
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"strings"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/kazimovzaman2/Go-jwt-gorm/config"
+	"github.com/kazimovzaman2/Go-jwt-gorm/model"
+)
+
+// WebAuthn is the relying party, set by Setup. Tests can replace it with one
+// whose origin matches their software authenticator.
+var WebAuthn *webauthn.WebAuthn
+
+// Setup configures WebAuthn from WEBAUTHN_RP_ID and WEBAUTHN_RP_ORIGINS,
+// falling back to localhost and APP_URL.
+func Setup(config *config.Config) error {
+	rpID := config.WebAuthnRPID
+	if rpID == "" {
+		rpID = "localhost"
+	}
+
+	var origins []string
+	for _, origin := range strings.Split(config.WebAuthnRPOrigins, ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+	if len(origins) == 0 && config.AppURL != "" {
+		origins = []string{config.AppURL}
+	}
+
+	var err error
+	WebAuthn, err = webauthn.New(&webauthn.Config{
+		RPID:          rpID,
+		RPDisplayName: "App",
+		RPOrigins:     origins,
+	})
+	return err
+}
+
+// User adapts a model.User and its passkeys to webauthn.User.
+type User struct {
+	model.User
+	Credentials []webauthn.Credential
+}
+
+// NewUser decodes the stored credentials of passkeys.
+func NewUser(user model.User, passkeys []model.Passkey) (*User, error) {
+	credentials := make([]webauthn.Credential, 0, len(passkeys))
+	for _, passkey := range passkeys {
+		credential, err := DecodeCredential(passkey)
+		if err != nil {
+			return nil, err
+		}
+		credentials = append(credentials, credential)
+	}
+	return &User{User: user, Credentials: credentials}, nil
+}
+
+func (u *User) WebAuthnID() []byte {
+	return UserHandle(u.ID)
+}
+
+func (u *User) WebAuthnName() string {
+	return u.Email
+}
+
+func (u *User) WebAuthnDisplayName() string {
+	return strings.TrimSpace(u.FirstName + " " + u.LastName)
+}
+
+func (u *User) WebAuthnCredentials() []webauthn.Credential {
+	return u.Credentials
+}
+
+func (u *User) WebAuthnIcon() string {
+	return ""
+}
+
+// UserHandle is the opaque WebAuthn user handle of userID.
+func UserHandle(userID uint) []byte {
+	handle := make([]byte, 8)
+	binary.BigEndian.PutUint64(handle, uint64(userID))
+	return handle
+}
+
+// UserIDFromHandle reverses UserHandle.
+func UserIDFromHandle(handle []byte) (uint, bool) {
+	if len(handle) != 8 {
+		return 0, false
+	}
+	return uint(binary.BigEndian.Uint64(handle)), true
+}
+
+func EncodeCredential(credential webauthn.Credential) (string, error) {
+	encoded, err := json.Marshal(credential)
+	return string(encoded), err
+}
+
+func DecodeCredential(passkey model.Passkey) (webauthn.Credential, error) {
+	var credential webauthn.Credential
+	err := json.Unmarshal([]byte(passkey.Credential), &credential)
+	return credential, err
+}
@@ -0,0 +1,320 @@
+package passkey
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/kazimovzaman2/Go-jwt-gorm/model"
+)
+
+const (
+	testRPID   = "localhost"
+	testOrigin = "http://localhost:3000"
+)
+
+// authenticator is a software passkey: one P-256 key bound to an RP ID,
+// with a signature counter that normally goes up on every assertion.
+type authenticator struct {
+	rpID         string
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	userHandle   []byte
+	counter      uint32
+}
+
+func newAuthenticator(t *testing.T, rpID string) *authenticator {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	credentialID := make([]byte, 16)
+	if _, err := rand.Read(credentialID); err != nil {
+		t.Fatal(err)
+	}
+	return &authenticator{rpID: rpID, key: key, credentialID: credentialID}
+}
+
+func encode(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func (a *authenticator) clientData(t *testing.T, ceremony string, challenge string) []byte {
+	t.Helper()
+
+	clientData, err := json.Marshal(map[string]string{
+		"type":      ceremony,
+		"challenge": challenge,
+		"origin":    testOrigin,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return clientData
+}
+
+// authData builds authenticator data with the user present and verified.
+func (a *authenticator) authData(flags byte, attested []byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(a.rpID))
+	data := append(rpIDHash[:], flags|0x01|0x04)
+	data = binary.BigEndian.AppendUint32(data, a.counter)
+	return append(data, attested...)
+}
+
+// create answers navigator.credentials.create() with a "none" attestation.
+func (a *authenticator) create(t *testing.T, options *protocol.CredentialCreation) []byte {
+	t.Helper()
+
+	a.userHandle = options.Response.User.ID.(protocol.URLEncodedBase64)
+
+	publicKey, err := webauthncbor.Marshal(map[int]interface{}{
+		1:  2,  // kty: EC2
+		3:  -7, // alg: ES256
+		-1: 1,  // crv: P-256
+		-2: a.key.X.FillBytes(make([]byte, 32)),
+		-3: a.key.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attested := make([]byte, 16) // AAGUID
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(a.credentialID)))
+	attested = append(attested, a.credentialID...)
+	attested = append(attested, publicKey...)
+
+	attestationObject, err := webauthncbor.Marshal(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": a.authData(0x40, attested),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"id":    encode(a.credentialID),
+		"rawId": encode(a.credentialID),
+		"type":  "public-key",
+		"response": map[string]string{
+			"clientDataJSON":    encode(a.clientData(t, "webauthn.create", options.Response.Challenge.String())),
+			"attestationObject": encode(attestationObject),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+// get answers navigator.credentials.get(). tamper, if set, can corrupt the
+// signature before it is sent.
+func (a *authenticator) get(t *testing.T, options *protocol.CredentialAssertion, tamper func(signature []byte)) []byte {
+	t.Helper()
+
+	a.counter++
+	authData := a.authData(0, nil)
+	clientData := a.clientData(t, "webauthn.get", options.Response.Challenge.String())
+
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tamper != nil {
+		tamper(signature)
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"id":    encode(a.credentialID),
+		"rawId": encode(a.credentialID),
+		"type":  "public-key",
+		"response": map[string]string{
+			"clientDataJSON":    encode(clientData),
+			"authenticatorData": encode(authData),
+			"signature":         encode(signature),
+			"userHandle":        encode(a.userHandle),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+func setupWebAuthn(t *testing.T) {
+	t.Helper()
+
+	previous := WebAuthn
+	t.Cleanup(func() { WebAuthn = previous })
+
+	var err error
+	WebAuthn, err = webauthn.New(&webauthn.Config{
+		RPID:          testRPID,
+		RPDisplayName: "App",
+		RPOrigins:     []string{testOrigin},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// register runs a registration ceremony for a new user and returns it with
+// the stored credential.
+func register(t *testing.T, authn *authenticator) (*User, error) {
+	t.Helper()
+
+	user := &User{User: model.User{Email: "ada@example.com", FirstName: "Ada"}}
+	user.ID = 42
+	options, session, err := WebAuthn.BeginRegistration(user,
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementRequired),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	credential, err := FinishRegistration(user, *session, authn.create(t, options))
+	if err != nil {
+		return nil, err
+	}
+
+	// Go through the stored form, as the handlers do.
+	encoded, err := EncodeCredential(*credential)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, err := DecodeCredential(model.Passkey{Credential: encoded})
+	if err != nil {
+		t.Fatal(err)
+	}
+	user.Credentials = []webauthn.Credential{stored}
+	return user, nil
+}
+
+func login(t *testing.T, user *User, authn *authenticator, tamper func(signature []byte)) (*webauthn.Credential, error) {
+	t.Helper()
+
+	options, session, err := WebAuthn.BeginDiscoverableLogin()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	findUser := func(rawID, userHandle []byte) (webauthn.User, error) {
+		userID, ok := UserIDFromHandle(userHandle)
+		if !ok || userID != user.ID {
+			return nil, errors.New("unknown user handle")
+		}
+		return user, nil
+	}
+	return FinishLogin(findUser, *session, authn.get(t, options, tamper))
+}
+
+func TestRegisterAndLogin(t *testing.T) {
+	setupWebAuthn(t)
+	authn := newAuthenticator(t, testRPID)
+
+	user, err := register(t, authn)
+	if err != nil {
+		t.Fatalf("registration failed: %s", err)
+	}
+
+	for i := 1; i <= 2; i++ {
+		credential, err := login(t, user, authn, nil)
+		if err != nil {
+			t.Fatalf("login %d failed: %s", i, err)
+		}
+		if credential.Authenticator.SignCount != authn.counter {
+			t.Fatalf("login %d: sign count is %d, want %d", i, credential.Authenticator.SignCount, authn.counter)
+		}
+		user.Credentials = []webauthn.Credential{*credential}
+	}
+}
+
+func TestLoginRejectsBadSignature(t *testing.T) {
+	setupWebAuthn(t)
+	authn := newAuthenticator(t, testRPID)
+
+	user, err := register(t, authn)
+	if err != nil {
+		t.Fatalf("registration failed: %s", err)
+	}
+
+	_, err = login(t, user, authn, func(signature []byte) {
+		signature[len(signature)-1] ^= 0xff
+	})
+	if err == nil {
+		t.Fatal("login with a bad signature succeeded")
+	}
+}
+
+func TestLoginRejectsSignCountRollback(t *testing.T) {
+	setupWebAuthn(t)
+	authn := newAuthenticator(t, testRPID)
+
+	user, err := register(t, authn)
+	if err != nil {
+		t.Fatalf("registration failed: %s", err)
+	}
+
+	credential, err := login(t, user, authn, nil)
+	if err != nil {
+		t.Fatalf("login failed: %s", err)
+	}
+	user.Credentials = []webauthn.Credential{*credential}
+
+	// A clone replays from an older counter.
+	authn.counter = 0
+	if _, err := login(t, user, authn, nil); !errors.Is(err, ErrClonedAuthenticator) {
+		t.Fatalf("login after a rollback returned %v, want %v", err, ErrClonedAuthenticator)
+	}
+}
+
+func TestRejectsWrongRPID(t *testing.T) {
+	setupWebAuthn(t)
+
+	if _, err := register(t, newAuthenticator(t, "evil.example")); err == nil {
+		t.Fatal("registration for another RP ID succeeded")
+	}
+
+	authn := newAuthenticator(t, testRPID)
+	user, err := register(t, authn)
+	if err != nil {
+		t.Fatalf("registration failed: %s", err)
+	}
+	authn.rpID = "evil.example"
+	if _, err := login(t, user, authn, nil); err == nil {
+		t.Fatal("login for another RP ID succeeded")
+	}
+}
+
+func TestUserHandle(t *testing.T) {
+	tests := []struct {
+		handle []byte
+		userID uint
+		ok     bool
+	}{
+		{UserHandle(1), 1, true},
+		{UserHandle(1 << 40), 1 << 40, true},
+		{[]byte{1, 2, 3}, 0, false},
+		{nil, 0, false},
+	}
+
+	for _, tt := range tests {
+		userID, ok := UserIDFromHandle(tt.handle)
+		if userID != tt.userID || ok != tt.ok {
+			t.Errorf("UserIDFromHandle(%x) = %d, %v, want %d, %v", tt.handle, userID, ok, tt.userID, tt.ok)
+		}
+	}
+}
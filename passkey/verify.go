@@ -0,0 +1,41 @@
+package passkey
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+var ErrClonedAuthenticator = errors.New("authenticator signature counter went backwards")
+
+// FinishRegistration verifies the result of navigator.credentials.create()
+// against the registration ceremony started for user.
+func FinishRegistration(user *User, session webauthn.SessionData, body []byte) (*webauthn.Credential, error) {
+	parsed, err := protocol.ParseCredentialCreationResponseBody(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	return WebAuthn.CreateCredential(user, session, parsed)
+}
+
+// FinishLogin verifies the result of navigator.credentials.get() against a
+// discoverable login ceremony; findUser resolves the user handle. An
+// authenticator whose signature counter didn't go up has been cloned, so
+// the login is refused.
+func FinishLogin(findUser webauthn.DiscoverableUserHandler, session webauthn.SessionData, body []byte) (*webauthn.Credential, error) {
+	parsed, err := protocol.ParseCredentialRequestResponseBody(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	credential, err := WebAuthn.ValidateDiscoverableLogin(findUser, session, parsed)
+	if err != nil {
+		return nil, err
+	}
+	if credential.Authenticator.CloneWarning {
+		return nil, ErrClonedAuthenticator
+	}
+	return credential, nil
+}
@@ -0,0 +1,44 @@
+package realtime
+
+import "sync"
+
+// Broker carries encoded deliveries between processes. Every payload passed
+// to Publish must reach the handler of every subscribed process, including
+// the publishing one.
+type Broker interface {
+	Publish(payload []byte) error
+	Subscribe(handler func(payload []byte))
+	Close() error
+}
+
+// MemoryBroker delivers within the current process only. It is enough when
+// Fiber runs without Prefork.
+type MemoryBroker struct {
+	mu       sync.RWMutex
+	handlers []func(payload []byte)
+}
+
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{}
+}
+
+func (b *MemoryBroker) Publish(payload []byte) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for _, handler := range b.handlers {
+		handler(payload)
+	}
+	return nil
+}
+
+func (b *MemoryBroker) Subscribe(handler func(payload []byte)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.handlers = append(b.handlers, handler)
+}
+
+func (b *MemoryBroker) Close() error {
+	return nil
+}
@@ -0,0 +1,172 @@
+package realtime
+
+import (
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/contrib/websocket"
+	"github.com/google/uuid"
+)
+
+const (
+	writeWait      = 10 * time.Second
+	pongWait       = 60 * time.Second
+	pingPeriod     = (pongWait * 9) / 10
+	maxMessageSize = 64 * 1024
+	sendBufferSize = 64
+
+	// CloseSessionRevoked is the close code sent when the session the socket
+	// was opened with is signed out. Clients should not reconnect with the
+	// same token.
+	CloseSessionRevoked = 4001
+)
+
+// Client is a single socket of an authenticated user.
+type Client struct {
+	// ID identifies the socket across processes, e.g. in presence rows.
+	ID     string
+	UserID uint
+	// SessionID is the login session of the access token the socket was
+	// opened with.
+	SessionID string
+
+	// ReadOnly is set for unverified users under the read_only policy.
+	ReadOnly bool
+
+	// lastActive is the UnixNano time of the last frame sent by the client.
+	// Control frames such as pongs do not count.
+	lastActive atomic.Int64
+
+	conn      *websocket.Conn
+	send      chan []byte
+	closed    chan struct{}
+	closeOnce sync.Once
+	revoked   atomic.Bool
+}
+
+func NewClient(userID uint, sessionID string, conn *websocket.Conn) *Client {
+	client := &Client{
+		ID:        uuid.NewString(),
+		UserID:    userID,
+		SessionID: sessionID,
+		conn:      conn,
+		send:      make(chan []byte, sendBufferSize),
+		closed:    make(chan struct{}),
+	}
+	client.lastActive.Store(time.Now().UnixNano())
+	return client
+}
+
+// IdleFor returns how long ago the client last sent a frame.
+func (c *Client) IdleFor() time.Duration {
+	return time.Since(time.Unix(0, c.lastActive.Load()))
+}
+
+// Send queues payload without blocking. A client that cannot keep up is
+// disconnected instead of slowing down delivery to everyone else.
+func (c *Client) Send(payload []byte) bool {
+	select {
+	case <-c.closed:
+		return false
+	case c.send <- payload:
+		return true
+	default:
+		c.Close()
+		return false
+	}
+}
+
+// SendEvent encodes and queues a single event for this client only.
+func (c *Client) SendEvent(event Event) bool {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return false
+	}
+	return c.Send(payload)
+}
+
+func (c *Client) Close() {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+	})
+}
+
+// Revoke closes the socket with CloseSessionRevoked.
+func (c *Client) Revoke() {
+	c.revoked.Store(true)
+	c.Close()
+}
+
+// Run pumps frames until the connection fails or Close is called. Every
+// decoded frame is passed to handle. Run only returns once the writer has
+// stopped, so the connection can be released safely afterwards.
+func (c *Client) Run(handle func(Event)) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.writePump()
+	}()
+
+	c.readPump(handle)
+	c.Close()
+	<-done
+}
+
+func (c *Client) readPump(handle func(Event)) {
+	c.conn.SetReadLimit(maxMessageSize)
+	c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		_, payload, err := c.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		c.conn.SetReadDeadline(time.Now().Add(pongWait))
+		c.lastActive.Store(time.Now().UnixNano())
+
+		var event Event
+		if err := json.Unmarshal(payload, &event); err != nil {
+			reply, _ := NewEvent(EventError, 0, ErrorData{Message: "Invalid event"})
+			c.SendEvent(reply)
+			continue
+		}
+		handle(event)
+	}
+}
+
+func (c *Client) writePump() {
+	ticker := time.NewTicker(pingPeriod)
+	defer ticker.Stop()
+	// Closing the connection also unblocks readPump when the writer gives up first.
+	defer c.conn.Close()
+
+	for {
+		select {
+		case <-c.closed:
+			closeMessage := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+			if c.revoked.Load() {
+				closeMessage = websocket.FormatCloseMessage(CloseSessionRevoked, "session revoked")
+			}
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			c.conn.WriteMessage(websocket.CloseMessage, closeMessage)
+			return
+		case payload := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.TextMessage, payload); err != nil {
+				c.Close()
+				return
+			}
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				c.Close()
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package realtime
+
+import "encoding/json"
+
+// ProtocolVersion is sent as "v" on every event. Bump it on any breaking
+// change to the envelope or to an event payload; see docs/websocket.md.
+const ProtocolVersion = 1
+
+// Server to client events.
+const (
+	EventMessageCreated = "message.created"
+	EventMessageUpdated = "message.updated"
+	EventMessageDeleted = "message.deleted"
+	EventThreadUpdated  = "thread.updated"
+
+	EventReactionAdded   = "reaction.added"
+	EventReactionRemoved = "reaction.removed"
+
+	EventReceiptUpdated = "receipt.updated"
+
+	EventTypingUpdated   = "typing.updated"
+	EventPresenceUpdated = "presence.updated"
+
+	EventConversationUpdated = "conversation.updated"
+	EventMemberAdded         = "member.added"
+	EventMemberRemoved       = "member.removed"
+	EventMemberUpdated       = "member.updated"
+
+	EventAck   = "ack"
+	EventError = "error"
+	EventPong  = "pong"
+)
+
+// Client to server events.
+const (
+	EventMessageSend = "message.send"
+	EventTypingStart = "typing.start"
+	EventTypingStop  = "typing.stop"
+	EventPresenceSet = "presence.set"
+	EventPing        = "ping"
+)
+
+// Event is the envelope of every frame sent over the socket in either
+// direction. Ref is chosen by the client and echoed back on the matching
+// ack or error so requests can be correlated.
+type Event struct {
+	Version        int             `json:"v"`
+	Type           string          `json:"type"`
+	Ref            string          `json:"ref,omitempty"`
+	ConversationID uint            `json:"conversation_id,omitempty"`
+	Data           json.RawMessage `json:"data,omitempty"`
+}
+
+type ErrorData struct {
+	Message string `json:"message"`
+}
+
+func NewEvent(eventType string, conversationID uint, data interface{}) (Event, error) {
+	event := Event{
+		Version:        ProtocolVersion,
+		Type:           eventType,
+		ConversationID: conversationID,
+	}
+	if data != nil {
+		raw, err := json.Marshal(data)
+		if err != nil {
+			return event, err
+		}
+		event.Data = raw
+	}
+	return event, nil
+}
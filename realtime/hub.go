@@ -0,0 +1,159 @@
+package realtime
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+)
+
+// Hub keeps track of the sockets connected to this process, grouped by user.
+// Published events go through the broker so that every process delivers
+// them to its own sockets.
+type Hub struct {
+	mu      sync.RWMutex
+	clients map[uint]map[*Client]struct{}
+	broker  Broker
+}
+
+// delivery is the payload exchanged over the broker. It either carries an
+// event for UserIDs or, with RevokedSessions, asks every process to close
+// the sockets opened with those sessions.
+type delivery struct {
+	UserIDs         []uint          `json:"user_ids,omitempty"`
+	Event           json.RawMessage `json:"event,omitempty"`
+	RevokedSessions []string        `json:"revoked_sessions,omitempty"`
+}
+
+var DefaultHub = NewHub()
+
+// NewHub returns a hub backed by an in-process MemoryBroker.
+func NewHub() *Hub {
+	h := &Hub{
+		clients: make(map[uint]map[*Client]struct{}),
+	}
+	h.SetBroker(NewMemoryBroker())
+	return h
+}
+
+// SetBroker replaces the broker used to fan events out. It should be called
+// once at startup, before any client connects.
+func (h *Hub) SetBroker(broker Broker) {
+	broker.Subscribe(h.receive)
+
+	h.mu.Lock()
+	previous := h.broker
+	h.broker = broker
+	h.mu.Unlock()
+
+	if previous != nil {
+		previous.Close()
+	}
+}
+
+func (h *Hub) Register(client *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.clients[client.UserID] == nil {
+		h.clients[client.UserID] = make(map[*Client]struct{})
+	}
+	h.clients[client.UserID][client] = struct{}{}
+}
+
+func (h *Hub) Unregister(client *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if clients, ok := h.clients[client.UserID]; ok {
+		delete(clients, client)
+		if len(clients) == 0 {
+			delete(h.clients, client.UserID)
+		}
+	}
+}
+
+// Clients returns a snapshot of the sockets connected to this process.
+func (h *Hub) Clients() []*Client {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	var clients []*Client
+	for _, userClients := range h.clients {
+		for client := range userClients {
+			clients = append(clients, client)
+		}
+	}
+	return clients
+}
+
+// Publish sends event to every socket held by the given users, in any process.
+func (h *Hub) Publish(userIDs []uint, event Event) error {
+	encoded, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(delivery{UserIDs: userIDs, Event: encoded})
+	if err != nil {
+		return err
+	}
+
+	return h.publish(payload)
+}
+
+// RevokeSessions closes the sockets opened with any of sessionIDs, in any
+// process.
+func (h *Hub) RevokeSessions(sessionIDs []string) error {
+	payload, err := json.Marshal(delivery{RevokedSessions: sessionIDs})
+	if err != nil {
+		return err
+	}
+	return h.publish(payload)
+}
+
+func (h *Hub) publish(payload []byte) error {
+	h.mu.RLock()
+	broker := h.broker
+	h.mu.RUnlock()
+
+	return broker.Publish(payload)
+}
+
+// Deliver writes an already encoded event to the local sockets of userIDs.
+func (h *Hub) Deliver(userIDs []uint, payload []byte) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for _, userID := range userIDs {
+		for client := range h.clients[userID] {
+			client.Send(payload)
+		}
+	}
+}
+
+// revokeLocal closes the local sockets opened with any of sessionIDs.
+func (h *Hub) revokeLocal(sessionIDs []string) {
+	revoked := make(map[string]bool, len(sessionIDs))
+	for _, sessionID := range sessionIDs {
+		revoked[sessionID] = true
+	}
+
+	for _, client := range h.Clients() {
+		if revoked[client.SessionID] {
+			client.Revoke()
+		}
+	}
+}
+
+func (h *Hub) receive(payload []byte) {
+	var d delivery
+	if err := json.Unmarshal(payload, &d); err != nil {
+		log.Printf("Failed to decode realtime delivery: %s", err)
+		return
+	}
+	if len(d.RevokedSessions) > 0 {
+		h.revokeLocal(d.RevokedSessions)
+		return
+	}
+	h.Deliver(d.UserIDs, d.Event)
+}
@@ -0,0 +1,150 @@
+package realtime
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/kazimovzaman2/Go-jwt-gorm/model"
+	"gorm.io/gorm"
+)
+
+const (
+	// NotifyChannel is the Postgres channel every process LISTENs on.
+	NotifyChannel = "realtime_events"
+
+	// Postgres rejects NOTIFY payloads of 8000 bytes or more. Larger
+	// deliveries are stored in realtime_events and only their ID is sent.
+	maxNotifyPayload = 7900
+	spilledPrefix    = "@"
+	spilledRetention = 5 * time.Minute
+
+	maxReconnectDelay = 30 * time.Second
+)
+
+// PostgresBroker fans deliveries out to every process through Postgres
+// LISTEN/NOTIFY, so sockets held by sibling Prefork children receive them too.
+type PostgresBroker struct {
+	dsn    string
+	db     *gorm.DB
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu       sync.RWMutex
+	handlers []func(payload []byte)
+}
+
+// NewPostgresBroker starts listening on a dedicated connection opened from
+// dsn. Notifications are sent through db.
+func NewPostgresBroker(dsn string, db *gorm.DB) *PostgresBroker {
+	ctx, cancel := context.WithCancel(context.Background())
+	b := &PostgresBroker{
+		dsn:    dsn,
+		db:     db,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go b.listen(ctx)
+	return b
+}
+
+func (b *PostgresBroker) Publish(payload []byte) error {
+	message := string(payload)
+
+	if len(payload) >= maxNotifyPayload {
+		event := model.RealtimeEvent{Payload: message}
+		if err := b.db.Create(&event).Error; err != nil {
+			return err
+		}
+		b.db.Where("created_at < ?", time.Now().Add(-spilledRetention)).Delete(&model.RealtimeEvent{})
+		message = spilledPrefix + strconv.FormatUint(uint64(event.ID), 10)
+	}
+
+	return b.db.Exec("SELECT pg_notify(?, ?)", NotifyChannel, message).Error
+}
+
+func (b *PostgresBroker) Subscribe(handler func(payload []byte)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.handlers = append(b.handlers, handler)
+}
+
+func (b *PostgresBroker) Close() error {
+	b.cancel()
+	<-b.done
+	return nil
+}
+
+// listen keeps a LISTEN connection open, reconnecting with backoff. Events
+// published while the connection is down are lost; clients recover by
+// re-fetching history when they reconnect.
+func (b *PostgresBroker) listen(ctx context.Context) {
+	defer close(b.done)
+
+	delay := time.Second
+	for ctx.Err() == nil {
+		err := b.listenOnce(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("Realtime listener disconnected: %s. Reconnecting in %s", err, delay)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		if delay *= 2; delay > maxReconnectDelay {
+			delay = maxReconnectDelay
+		}
+	}
+}
+
+func (b *PostgresBroker) listenOnce(ctx context.Context) error {
+	conn, err := pgx.Connect(ctx, b.dsn)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{NotifyChannel}.Sanitize()); err != nil {
+		return err
+	}
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		b.dispatch(notification.Payload)
+	}
+}
+
+func (b *PostgresBroker) dispatch(message string) {
+	if strings.HasPrefix(message, spilledPrefix) {
+		id, err := strconv.ParseUint(strings.TrimPrefix(message, spilledPrefix), 10, 64)
+		if err != nil {
+			log.Printf("Invalid realtime notification %q", message)
+			return
+		}
+
+		var event model.RealtimeEvent
+		if err := b.db.First(&event, id).Error; err != nil {
+			log.Printf("Failed to load realtime event %s: %s", message, err)
+			return
+		}
+		message = event.Payload
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for _, handler := range b.handlers {
+		handler([]byte(message))
+	}
+}
@@ -0,0 +1,286 @@
+package realtime
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/kazimovzaman2/Go-jwt-gorm/model"
+	"gorm.io/gorm"
+)
+
+const (
+	// PresenceHeartbeat is how often every process refreshes the connections
+	// it holds. Connections not refreshed within PresenceTTL belong to a
+	// process that died and are swept.
+	PresenceHeartbeat = 30 * time.Second
+	PresenceTTL       = 3 * PresenceHeartbeat
+
+	// AwayAfter marks a socket away once the client has sent nothing for
+	// that long, unless it set its status explicitly.
+	AwayAfter = 5 * time.Minute
+)
+
+// Presence keeps the presence_connections table in sync with the sockets of
+// this process and announces aggregate status changes to everyone who shares
+// a conversation with the user.
+type Presence struct {
+	db  *gorm.DB
+	hub *Hub
+
+	mu       sync.Mutex
+	explicit map[*Client]string
+}
+
+// DefaultPresence is set by Setup.
+var DefaultPresence *Presence
+
+func NewPresence(db *gorm.DB, hub *Hub) *Presence {
+	return &Presence{
+		db:       db,
+		hub:      hub,
+		explicit: make(map[*Client]string),
+	}
+}
+
+// PresenceToResponse returns the presence of user as other users may see it.
+func PresenceToResponse(user model.User, status string) model.PresenceResponse {
+	response := model.PresenceResponse{
+		UserID: user.ID,
+		Status: status,
+	}
+	if user.LastSeenAt != nil && !user.HideLastSeen {
+		lastSeenAt := user.LastSeenAt.Format("2006-01-02 15:04:05")
+		response.LastSeenAt = &lastSeenAt
+	}
+	return response
+}
+
+// onChange publishes presence.updated to the user and everyone sharing a
+// conversation with them.
+func (p *Presence) onChange(userID uint, status string) {
+	var user model.User
+	if err := p.db.First(&user, userID).Error; err != nil {
+		return
+	}
+
+	var contactIDs []uint
+	err := p.db.Raw(`
+		SELECT DISTINCT other.user_id
+		FROM conversation_members mine
+		JOIN conversation_members other ON other.conversation_id = mine.conversation_id
+		WHERE mine.user_id = ?`,
+		userID,
+	).Scan(&contactIDs).Error
+	if err != nil {
+		log.Printf("Failed to load contacts of user %d: %s", userID, err)
+		return
+	}
+	if len(contactIDs) == 0 {
+		contactIDs = []uint{userID}
+	}
+
+	event, err := NewEvent(EventPresenceUpdated, 0, PresenceToResponse(user, status))
+	if err == nil {
+		err = p.hub.Publish(contactIDs, event)
+	}
+	if err != nil {
+		log.Printf("Failed to publish %s event: %s", EventPresenceUpdated, err)
+	}
+}
+
+// Statuses returns the aggregate status of every given user. Users without
+// a live connection are offline.
+func (p *Presence) Statuses(userIDs []uint) (map[uint]string, error) {
+	result := make(map[uint]string, len(userIDs))
+	for _, userID := range userIDs {
+		result[userID] = model.PresenceOffline
+	}
+	if len(userIDs) == 0 {
+		return result, nil
+	}
+
+	var rows []struct {
+		UserID uint
+		Online bool
+	}
+	err := p.db.Model(&model.PresenceConnection{}).
+		Select("user_id, BOOL_OR(status = ?) AS online", model.PresenceOnline).
+		Where("user_id IN ? AND seen_at > ?", userIDs, time.Now().Add(-PresenceTTL)).
+		Group("user_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		if row.Online {
+			result[row.UserID] = model.PresenceOnline
+		} else {
+			result[row.UserID] = model.PresenceAway
+		}
+	}
+	return result, nil
+}
+
+func (p *Presence) status(userID uint) string {
+	statuses, err := p.Statuses([]uint{userID})
+	if err != nil {
+		log.Printf("Failed to load presence of user %d: %s", userID, err)
+		return model.PresenceOffline
+	}
+	return statuses[userID]
+}
+
+// change runs update and calls onChange if the user's aggregate status moved.
+func (p *Presence) change(userID uint, update func() error) {
+	before := p.status(userID)
+	if err := update(); err != nil {
+		log.Printf("Failed to update presence of user %d: %s", userID, err)
+		return
+	}
+	if after := p.status(userID); after != before {
+		p.onChange(userID, after)
+	}
+}
+
+func (p *Presence) Connect(client *Client) {
+	p.change(client.UserID, func() error {
+		return p.db.Create(&model.PresenceConnection{
+			ID:     client.ID,
+			UserID: client.UserID,
+			Status: model.PresenceOnline,
+			SeenAt: time.Now(),
+		}).Error
+	})
+}
+
+func (p *Presence) Disconnect(client *Client) {
+	p.mu.Lock()
+	delete(p.explicit, client)
+	p.mu.Unlock()
+
+	p.change(client.UserID, func() error {
+		return p.db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Delete(&model.PresenceConnection{ID: client.ID}).Error; err != nil {
+				return err
+			}
+			return touchLastSeen(tx, []uint{client.UserID})
+		})
+	})
+}
+
+// SetStatus is called when the client picks a status itself. An explicit
+// "online" still turns into "away" after AwayAfter of silence; an explicit
+// "away" sticks until the client changes it.
+func (p *Presence) SetStatus(client *Client, status string) {
+	p.mu.Lock()
+	if status == model.PresenceAway {
+		p.explicit[client] = status
+	} else {
+		delete(p.explicit, client)
+	}
+	p.mu.Unlock()
+
+	p.setConnectionStatus(client, status)
+}
+
+func (p *Presence) setConnectionStatus(client *Client, status string) {
+	p.change(client.UserID, func() error {
+		return p.db.Model(&model.PresenceConnection{ID: client.ID}).
+			Updates(map[string]interface{}{"status": status, "seen_at": time.Now()}).Error
+	})
+}
+
+// Run refreshes local connections, applies idle timeouts and sweeps
+// connections left behind by dead processes until ctx is done.
+func (p *Presence) Run(ctx context.Context) {
+	ticker := time.NewTicker(PresenceHeartbeat)
+	defer ticker.Stop()
+
+	idle := make(map[*Client]bool)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			idle = p.heartbeat(idle)
+			p.sweep()
+		}
+	}
+}
+
+func (p *Presence) heartbeat(wasIdle map[*Client]bool) map[*Client]bool {
+	clients := p.hub.Clients()
+	if len(clients) == 0 {
+		return map[*Client]bool{}
+	}
+
+	ids := make([]string, 0, len(clients))
+	userIDs := make([]uint, 0, len(clients))
+	for _, client := range clients {
+		ids = append(ids, client.ID)
+		userIDs = append(userIDs, client.UserID)
+	}
+
+	err := p.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.PresenceConnection{}).Where("id IN ?", ids).Update("seen_at", time.Now()).Error; err != nil {
+			return err
+		}
+		return touchLastSeen(tx, userIDs)
+	})
+	if err != nil {
+		log.Printf("Failed to refresh presence: %s", err)
+	}
+
+	p.mu.Lock()
+	explicit := make(map[*Client]string, len(p.explicit))
+	for client, status := range p.explicit {
+		explicit[client] = status
+	}
+	p.mu.Unlock()
+
+	idle := make(map[*Client]bool, len(clients))
+	for _, client := range clients {
+		if _, ok := explicit[client]; ok {
+			continue
+		}
+		idle[client] = client.IdleFor() > AwayAfter
+		if idle[client] != wasIdle[client] {
+			status := model.PresenceOnline
+			if idle[client] {
+				status = model.PresenceAway
+			}
+			p.setConnectionStatus(client, status)
+		}
+	}
+	return idle
+}
+
+func (p *Presence) sweep() {
+	var swept []model.PresenceConnection
+	err := p.db.Raw(
+		"DELETE FROM presence_connections WHERE seen_at < ? RETURNING user_id",
+		time.Now().Add(-PresenceTTL),
+	).Scan(&swept).Error
+	if err != nil {
+		log.Printf("Failed to sweep presence: %s", err)
+		return
+	}
+
+	seen := make(map[uint]bool)
+	for _, connection := range swept {
+		if seen[connection.UserID] {
+			continue
+		}
+		seen[connection.UserID] = true
+		if status := p.status(connection.UserID); status == model.PresenceOffline {
+			p.onChange(connection.UserID, status)
+		}
+	}
+}
+
+func touchLastSeen(tx *gorm.DB, userIDs []uint) error {
+	return tx.Model(&model.User{}).Where("id IN ?", userIDs).UpdateColumn("last_seen_at", time.Now()).Error
+}
@@ -0,0 +1,41 @@
+package realtime
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/kazimovzaman2/Go-jwt-gorm/config"
+	"github.com/kazimovzaman2/Go-jwt-gorm/database"
+)
+
+const (
+	BrokerPostgres = "postgres"
+	BrokerMemory   = "memory"
+)
+
+// Setup connects DefaultHub to the broker selected by REALTIME_BROKER and
+// starts presence tracking. Postgres is the default because with Prefork
+// every child process holds its own sockets. Must be called after
+// database.ConnectDB.
+func Setup(config *config.Config) error {
+	switch config.RealtimeBroker {
+	case "", BrokerPostgres:
+		DefaultHub.SetBroker(NewPostgresBroker(database.DSN(config), database.DB))
+	case BrokerMemory:
+		DefaultHub.SetBroker(NewMemoryBroker())
+	default:
+		return fmt.Errorf("unknown realtime broker %q", config.RealtimeBroker)
+	}
+	DefaultPresence = NewPresence(database.DB, DefaultHub)
+	go DefaultPresence.Run(context.Background())
+
+	fmt.Printf("✅ Realtime broker: %s.\n", brokerName(config.RealtimeBroker))
+	return nil
+}
+
+func brokerName(name string) string {
+	if name == "" {
+		return BrokerPostgres
+	}
+	return name
+}
@@ -0,0 +1,92 @@
+package realtime
+
+import (
+	"sync"
+	"time"
+)
+
+// TypingTimeout is how long a typing indicator lasts without being renewed.
+// Clients should resend typing.start while the user keeps typing.
+const TypingTimeout = 6 * time.Second
+
+type typingKey struct {
+	client         *Client
+	conversationID uint
+}
+
+// Typing tracks which sockets are typing in which conversation and stops
+// them automatically when they go quiet.
+type Typing struct {
+	mu     sync.Mutex
+	timers map[typingKey]*time.Timer
+	onStop func(client *Client, conversationID uint)
+}
+
+// NewTyping returns a tracker that calls onStop whenever an indicator expires.
+func NewTyping(onStop func(client *Client, conversationID uint)) *Typing {
+	return &Typing{
+		timers: make(map[typingKey]*time.Timer),
+		onStop: onStop,
+	}
+}
+
+// Start starts or renews the indicator and reports whether it is new.
+func (t *Typing) Start(client *Client, conversationID uint) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// Renewing replaces the timer, so an expiry already in flight for the
+	// old one sees it is stale and does nothing.
+	key := typingKey{client: client, conversationID: conversationID}
+	previous, renewed := t.timers[key]
+	if renewed {
+		previous.Stop()
+	}
+
+	var timer *time.Timer
+	timer = time.AfterFunc(TypingTimeout, func() {
+		t.mu.Lock()
+		current := t.timers[key]
+		if current == timer {
+			delete(t.timers, key)
+		}
+		t.mu.Unlock()
+
+		if current == timer {
+			t.onStop(client, conversationID)
+		}
+	})
+	t.timers[key] = timer
+	return !renewed
+}
+
+// Stop clears the indicator and reports whether it was active.
+func (t *Typing) Stop(client *Client, conversationID uint) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := typingKey{client: client, conversationID: conversationID}
+	timer, ok := t.timers[key]
+	if ok {
+		timer.Stop()
+		delete(t.timers, key)
+	}
+	return ok
+}
+
+// StopAll clears every indicator of client, e.g. when it disconnects, and
+// returns the conversations it was typing in.
+func (t *Typing) StopAll(client *Client) []uint {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var conversationIDs []uint
+	for key, timer := range t.timers {
+		if key.client == client {
+			timer.Stop()
+			delete(t.timers, key)
+			conversationIDs = append(conversationIDs, key.conversationID)
+		}
+	}
+	return conversationIDs
+}
@@ -6,28 +6,102 @@ import (
 	"github.com/kazimovzaman2/Go-jwt-gorm/config"
 	"github.com/kazimovzaman2/Go-jwt-gorm/handler"
 	"github.com/kazimovzaman2/Go-jwt-gorm/middleware"
+	"github.com/kazimovzaman2/Go-jwt-gorm/model"
+	"github.com/kazimovzaman2/Go-jwt-gorm/signing"
 )
 
 func SetupRoutes(app *fiber.App) {
 	config, _ := config.LoadConfig(".")
-	protected := middleware.NewAuthMiddleware(config.JwtAccessSecret)
+	protected := middleware.NewAuthMiddleware(signing.DefaultKeySet.Keyfunc, config.UnverifiedEmailPolicy)
+	wsProtected := middleware.NewWebSocketAuthMiddleware(signing.DefaultKeySet.Keyfunc, config.UnverifiedEmailPolicy)
 
 	app.Get("/swagger/*", swagger.New(swagger.Config{
 		PreauthorizeApiKey: "Bearer",
 	}))
 
+	app.Get("/.well-known/jwks.json", handler.GetJWKS)
+	app.Get("/ws", wsProtected, handler.WebSocketUpgrade, handler.WebSocket)
+
 	api := app.Group("/api")
 	api.Get("/hello/", handler.Hello)
 
 	auth := api.Group("/jwt")
 	auth.Post("/create/", handler.Login)
+	auth.Post("/2fa/", handler.LoginTwoFactor)
+	auth.Post("/magic-link/", handler.RequestMagicLink)
+	auth.Post("/magic-link/login/", handler.MagicLinkLogin)
+	auth.Post("/passkey/begin/", handler.BeginPasskeyLogin)
+	auth.Post("/passkey/finish/", handler.FinishPasskeyLogin)
 	auth.Post("/refresh/", handler.RefreshToken)
+	auth.Post("/logout/", protected, handler.Logout)
+	auth.Post("/logout-all/", protected, handler.LogoutAll)
+
+	oauth := api.Group("/oauth")
+	oauth.Get("/providers/", handler.GetOAuthProviders)
+	oauth.Post("/finish/", handler.FinishOAuthLogin)
+	oauth.Post("/:provider/begin/", handler.BeginOAuthLogin)
+
+	password := api.Group("/password")
+	password.Post("/reset/", handler.RequestPasswordReset)
+	password.Post("/reset/confirm/", handler.ConfirmPasswordReset)
+
+	admin := api.Group("/admin", protected)
+	admin.Get("/users/", middleware.RequirePermission(model.PermissionUsersRead), handler.AdminListUsers)
+	admin.Delete("/users/:id/", middleware.RequirePermission(model.PermissionUsersDelete), handler.AdminDeleteUser)
+	admin.Post("/users/:id/suspend/", middleware.RequirePermission(model.PermissionUsersSuspend), handler.SuspendUser)
+	admin.Post("/users/:id/unsuspend/", middleware.RequirePermission(model.PermissionUsersSuspend), handler.UnsuspendUser)
+	admin.Post("/users/:id/reset-password/", middleware.RequirePermission(model.PermissionUsersResetPassword), handler.ForcePasswordReset)
+	admin.Put("/users/:id/roles/", middleware.RequirePermission(model.PermissionRolesAssign), handler.AssignRoles)
+	admin.Get("/roles/", middleware.RequirePermission(model.PermissionRolesAssign), handler.GetRoles)
 
 	users := api.Group("/users")
-	users.Get("/", handler.GetAllUsers)
+	users.Get("/", protected, middleware.RequirePermission(model.PermissionUsersRead), handler.GetAllUsers)
 	users.Post("/", handler.CreateUser)
 	users.Get("/me/", protected, handler.GetMe)
 	users.Delete("/me/", protected, handler.DeleteMe)
 	users.Patch("/me/", protected, handler.UpdateMe)
+	users.Post("/me/password/", protected, handler.ChangePassword)
+	users.Post("/me/email/", protected, handler.ChangeEmail)
+	users.Post("/email-change/confirm/", handler.ConfirmEmailChange)
+	users.Post("/verify-email/", handler.VerifyEmail)
+	users.Post("/me/verify-email/resend/", protected, handler.ResendVerificationEmail)
+	users.Post("/me/2fa/totp/", protected, handler.SetupTOTP)
+	users.Post("/me/2fa/totp/confirm/", protected, handler.ConfirmTOTP)
+	users.Post("/me/2fa/totp/disable/", protected, handler.DisableTOTP)
+	users.Post("/me/2fa/recovery-codes/", protected, handler.RegenerateRecoveryCodes)
+	users.Get("/me/passkeys/", protected, handler.GetMyPasskeys)
+	users.Post("/me/passkeys/register/begin/", protected, handler.BeginPasskeyRegistration)
+	users.Post("/me/passkeys/register/finish/", protected, handler.FinishPasskeyRegistration)
+	users.Patch("/me/passkeys/:id/", protected, handler.RenamePasskey)
+	users.Delete("/me/passkeys/:id/", protected, handler.DeletePasskey)
+	users.Get("/me/identities/", protected, handler.GetMyIdentities)
+	users.Post("/me/identities/finish/", protected, handler.FinishIdentityLink)
+	users.Post("/me/identities/:provider/begin/", protected, handler.BeginIdentityLink)
+	users.Delete("/me/identities/:id/", protected, handler.UnlinkIdentity)
+	users.Get("/me/sessions/", protected, handler.GetMySessions)
+	users.Delete("/me/sessions/:id/", protected, handler.DeleteMySession)
 	users.Get("/:id/", handler.GetUser)
+	users.Post("/:id/dm/", protected, handler.GetOrCreateDirectConversation)
+
+	conversations := api.Group("/conversations", protected)
+	conversations.Get("/", handler.GetMyConversations)
+	conversations.Post("/", handler.CreateConversation)
+	conversations.Get("/:id/", handler.GetConversation)
+	conversations.Patch("/:id/", handler.UpdateConversation)
+	conversations.Post("/:id/leave/", handler.LeaveConversation)
+	conversations.Post("/:id/read/", handler.MarkRead)
+	conversations.Get("/:id/presence/", handler.GetPresence)
+	conversations.Post("/:id/members/", handler.AddMembers)
+	conversations.Delete("/:id/members/:user_id/", handler.RemoveMember)
+	conversations.Post("/:id/members/:user_id/promote/", handler.PromoteMember)
+	conversations.Post("/:id/members/:user_id/demote/", handler.DemoteMember)
+	conversations.Get("/:id/messages/", handler.GetMessages)
+	conversations.Post("/:id/messages/", handler.CreateMessage)
+	conversations.Patch("/:id/messages/:message_id/", handler.EditMessage)
+	conversations.Delete("/:id/messages/:message_id/", handler.DeleteMessage)
+	conversations.Get("/:id/messages/:message_id/revisions/", handler.GetMessageRevisions)
+	conversations.Get("/:id/messages/:message_id/thread/", handler.GetThread)
+	conversations.Get("/:id/messages/:message_id/seen/", handler.GetSeenBy)
+	conversations.Post("/:id/messages/:message_id/reactions/", handler.AddReaction)
+	conversations.Delete("/:id/messages/:message_id/reactions/:emoji/", handler.RemoveReaction)
 }
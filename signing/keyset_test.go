@@ -0,0 +1,188 @@
+package signing
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type testKeys struct {
+	rsa     *rsa.PrivateKey
+	ed25519 ed25519.PrivateKey
+	set     *KeySet
+}
+
+// newTestKeys returns a set signing with an RSA key, next to an Ed25519 key
+// retired to its public half.
+func newTestKeys(t *testing.T) testKeys {
+	t.Helper()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	set, err := NewKeySet([]*Key{
+		{ID: "rsa", Algorithm: AlgorithmRS256, Private: rsaKey, Public: rsaKey.Public()},
+		{ID: "retired", Algorithm: AlgorithmEdDSA, Public: edKey.Public()},
+	}, "rsa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testKeys{rsa: rsaKey, ed25519: edKey, set: set}
+}
+
+func claims() jwt.RegisteredClaims {
+	return jwt.RegisteredClaims{Subject: "1", ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute))}
+}
+
+// sign signs a token with method and key, naming kid in its header.
+func sign(t *testing.T, method jwt.SigningMethod, kid string, key interface{}) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(method, claims())
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func must(b []byte, err error) []byte {
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func TestKeyfunc(t *testing.T) {
+	keys := newTestKeys(t)
+
+	otherRSA, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaPublicPEM := pem.EncodeToMemory(&pem.Block{
+		Type:  "PUBLIC KEY",
+		Bytes: must(x509.MarshalPKIXPublicKey(keys.rsa.Public())),
+	})
+	active, err := keys.set.Sign(claims())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr error
+	}{
+		{"active key", active, nil},
+		{"retired key", sign(t, jwt.SigningMethodEdDSA, "retired", keys.ed25519), nil},
+		{"unknown kid", sign(t, jwt.SigningMethodRS256, "other", otherRSA), ErrUnknownKey},
+		{"missing kid", sign(t, jwt.SigningMethodRS256, "", keys.rsa), ErrUnknownKey},
+		// The public key is no secret, so it must not work as an HMAC key.
+		{"HMAC with the public key", sign(t, jwt.SigningMethodHS256, "rsa", rsaPublicPEM), ErrAlgorithmMismatch},
+		{"RSA token for the Ed25519 key", sign(t, jwt.SigningMethodRS256, "retired", otherRSA), ErrAlgorithmMismatch},
+		{"Ed25519 token for the RSA key", sign(t, jwt.SigningMethodEdDSA, "rsa", keys.ed25519), ErrAlgorithmMismatch},
+		{"forged signature", sign(t, jwt.SigningMethodRS256, "rsa", otherRSA), jwt.ErrTokenSignatureInvalid},
+		{"alg none", sign(t, jwt.SigningMethodNone, "rsa", jwt.UnsafeAllowNoneSignatureType), ErrAlgorithmMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := jwt.Parse(tt.token, keys.set.Keyfunc)
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("Parse failed: %s", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Parse returned %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func writeKey(t *testing.T, dir, kid string, block *pem.Block) {
+	t.Helper()
+
+	if err := os.WriteFile(filepath.Join(dir, kid+".pem"), pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadKeySet(t *testing.T) {
+	keys := newTestKeys(t)
+	dir := t.TempDir()
+
+	writeKey(t, dir, "2024", &pem.Block{Type: "PRIVATE KEY", Bytes: must(x509.MarshalPKCS8PrivateKey(keys.ed25519))})
+	writeKey(t, dir, "2025", &pem.Block{Type: "PRIVATE KEY", Bytes: must(x509.MarshalPKCS8PrivateKey(keys.rsa))})
+	writeKey(t, dir, "2026", &pem.Block{Type: "PUBLIC KEY", Bytes: must(x509.MarshalPKIXPublicKey(keys.rsa.Public()))})
+
+	// Without an active kid, the last private key signs.
+	set, err := LoadKeySet(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if set.active.ID != "2025" || set.active.Algorithm != AlgorithmRS256 {
+		t.Fatalf("active key is %q (%s), want %q (%s)", set.active.ID, set.active.Algorithm, "2025", AlgorithmRS256)
+	}
+
+	set, err = LoadKeySet(dir, "2024")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := set.Sign(claims())
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := jwt.Parse(token, set.Keyfunc)
+	if err != nil {
+		t.Fatalf("Parse failed: %s", err)
+	}
+	if parsed.Method != jwt.SigningMethodEdDSA || parsed.Header["kid"] != "2024" {
+		t.Fatalf("token signed with %s by %v, want %s by %q", parsed.Method.Alg(), parsed.Header["kid"], AlgorithmEdDSA, "2024")
+	}
+
+	// A retired key can't sign.
+	if _, err := LoadKeySet(dir, "2026"); err == nil {
+		t.Fatal("LoadKeySet with a public key as the active one succeeded")
+	}
+}
+
+func TestGenerateKey(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "keys")
+	if err := generateKey(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 1 || filepath.Ext(paths[0]) != ".pem" {
+		t.Fatalf("key directory holds %v, want one key and no temporary files", paths)
+	}
+
+	set, err := LoadKeySet(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if set.active.Algorithm != AlgorithmEdDSA {
+		t.Fatalf("generated key is %s, want %s", set.active.Algorithm, AlgorithmEdDSA)
+	}
+}
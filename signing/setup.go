@@ -0,0 +1,92 @@
+package signing
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/kazimovzaman2/Go-jwt-gorm/config"
+)
+
+const defaultKeysDir = "./keys"
+
+// DefaultKeySet signs access tokens. It is set by Setup.
+var DefaultKeySet *KeySet
+
+// Setup loads DefaultKeySet from JWT_KEYS_DIR. When the directory holds no
+// keys yet, an Ed25519 key is generated there so that development works out
+// of the box. Every Prefork child runs Setup again, so only the parent
+// generates the key; it does so before spawning them, and the children
+// load it from disk.
+func Setup(config *config.Config) error {
+	dir := config.JwtKeysDir
+	if dir == "" {
+		dir = defaultKeysDir
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		if fiber.IsChild() {
+			return fmt.Errorf("no signing keys found in %s", dir)
+		}
+		if err := generateKey(dir); err != nil {
+			return err
+		}
+	}
+
+	DefaultKeySet, err = LoadKeySet(dir, config.JwtActiveKID)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("✅ Signing access tokens with key %q.\n", DefaultKeySet.active.ID)
+	return nil
+}
+
+func generateKey(dir string) error {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+
+	// The key is written under a temporary name and then linked into place,
+	// so no other process ever reads a half-written file. Linking fails if
+	// the name is taken, in which case the existing key is kept.
+	file, err := os.CreateTemp(dir, ".key-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	err = pem.Encode(file, &pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(dir, time.Now().UTC().Format("20060102-150405")+".pem")
+	if err := os.Link(file.Name(), path); err != nil && !errors.Is(err, os.ErrExist) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,22 @@
+package utils
+
+import "github.com/kazimovzaman2/Go-jwt-gorm/model"
+
+// AdminUserToResponse expects the roles of user to be preloaded.
+func AdminUserToResponse(user model.User) model.AdminUserResponse {
+	response := model.AdminUserResponse{
+		MeResponse: MeToResponse(user),
+		Roles:      make([]string, 0, len(user.Roles)),
+	}
+
+	for _, role := range user.Roles {
+		response.Roles = append(response.Roles, role.Name)
+	}
+
+	if user.SuspendedAt != nil {
+		suspendedAt := user.SuspendedAt.Format("2006-01-02 15:04:05")
+		response.SuspendedAt = &suspendedAt
+	}
+
+	return response
+}
@@ -0,0 +1,37 @@
+package utils
+
+import "github.com/kazimovzaman2/Go-jwt-gorm/model"
+
+func ConversationToResponse(conversation model.Conversation, lastMessage *model.Message) model.ConversationResponse {
+	members := make([]model.MemberResponse, 0, len(conversation.Members))
+	for _, member := range conversation.Members {
+		members = append(members, MemberToResponse(member))
+	}
+
+	var last *model.MessageResponse
+	if lastMessage != nil {
+		response := MessageToResponse(*lastMessage)
+		last = &response
+	}
+
+	return model.ConversationResponse{
+		ID:          conversation.ID,
+		Type:        conversation.Type,
+		Name:        conversation.Name,
+		Avatar:      conversation.Avatar,
+		CreatedByID: conversation.CreatedByID,
+		Members:     members,
+		LastMessage: last,
+		CreatedAt:   conversation.CreatedAt.Format("2006-01-02 15:04:05"),
+		UpdatedAt:   conversation.UpdatedAt.Format("2006-01-02 15:04:05"),
+	}
+}
+
+func MemberToResponse(member model.ConversationMember) model.MemberResponse {
+	return model.MemberResponse{
+		User:              UserToResponse(member.User),
+		Role:              member.Role,
+		LastReadMessageID: member.LastReadMessageID,
+		JoinedAt:          member.CreatedAt.Format("2006-01-02 15:04:05"),
+	}
+}
@@ -0,0 +1,19 @@
+package utils
+
+import "github.com/kazimovzaman2/Go-jwt-gorm/model"
+
+func IdentityToResponse(identity model.Identity) model.IdentityResponse {
+	response := model.IdentityResponse{
+		ID:        identity.ID,
+		Provider:  identity.Provider,
+		Email:     identity.Email,
+		CreatedAt: identity.CreatedAt.Format("2006-01-02 15:04:05"),
+	}
+
+	if identity.LastUsedAt != nil {
+		lastUsedAt := identity.LastUsedAt.Format("2006-01-02 15:04:05")
+		response.LastUsedAt = &lastUsedAt
+	}
+
+	return response
+}
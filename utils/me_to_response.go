@@ -0,0 +1,17 @@
+package utils
+
+import "github.com/kazimovzaman2/Go-jwt-gorm/model"
+
+func MeToResponse(user model.User) model.MeResponse {
+	response := model.MeResponse{
+		UserResponse:     UserToResponse(user),
+		TwoFactorEnabled: user.TOTPEnabledAt != nil,
+	}
+
+	if user.EmailVerifiedAt != nil {
+		emailVerifiedAt := user.EmailVerifiedAt.Format("2006-01-02 15:04:05")
+		response.EmailVerifiedAt = &emailVerifiedAt
+	}
+
+	return response
+}
@@ -0,0 +1,63 @@
+package utils
+
+import "github.com/kazimovzaman2/Go-jwt-gorm/model"
+
+const quoteSnippetLength = 100
+
+// Snippet shortens body to at most n characters, adding an ellipsis when cut.
+func Snippet(body string, n int) string {
+	runes := []rune(body)
+	if len(runes) <= n {
+		return body
+	}
+	return string(runes[:n]) + "…"
+}
+
+func MessageToResponse(message model.Message) model.MessageResponse {
+	response := model.MessageResponse{
+		ID:             message.ID,
+		ConversationID: message.ConversationID,
+		SenderID:       message.SenderID,
+		Body:           message.Body,
+		Deleted:        message.DeletedAt != nil,
+		ParentID:       message.ParentID,
+		ReplyCount:     message.ReplyCount,
+		CreatedAt:      message.CreatedAt.Format("2006-01-02 15:04:05"),
+		UpdatedAt:      message.UpdatedAt.Format("2006-01-02 15:04:05"),
+	}
+
+	if message.EditedAt != nil {
+		editedAt := message.EditedAt.Format("2006-01-02 15:04:05")
+		response.EditedAt = &editedAt
+	}
+	if message.LastReplyAt != nil {
+		lastReplyAt := message.LastReplyAt.Format("2006-01-02 15:04:05")
+		response.LastReplyAt = &lastReplyAt
+	}
+	if message.Quoted != nil {
+		quote := model.QuoteResponse{
+			ID:       message.Quoted.ID,
+			SenderID: message.Quoted.SenderID,
+			Deleted:  message.Quoted.DeletedAt != nil,
+		}
+		if !quote.Deleted {
+			quote.Snippet = Snippet(message.Quoted.Body, quoteSnippetLength)
+		}
+		response.Quote = &quote
+	}
+	if response.Deleted {
+		response.Body = ""
+	}
+
+	return response
+}
+
+func MessageRevisionToResponse(revision model.MessageRevision) model.MessageRevisionResponse {
+	return model.MessageRevisionResponse{
+		ID:        revision.ID,
+		MessageID: revision.MessageID,
+		EditorID:  revision.EditorID,
+		Body:      revision.Body,
+		CreatedAt: revision.CreatedAt.Format("2006-01-02 15:04:05"),
+	}
+}
@@ -0,0 +1,18 @@
+package utils
+
+import "github.com/kazimovzaman2/Go-jwt-gorm/model"
+
+func PasskeyToResponse(passkey model.Passkey) model.PasskeyResponse {
+	response := model.PasskeyResponse{
+		ID:        passkey.ID,
+		Name:      passkey.Name,
+		CreatedAt: passkey.CreatedAt.Format("2006-01-02 15:04:05"),
+	}
+
+	if passkey.LastUsedAt != nil {
+		lastUsedAt := passkey.LastUsedAt.Format("2006-01-02 15:04:05")
+		response.LastUsedAt = &lastUsedAt
+	}
+
+	return response
+}
@@ -0,0 +1,85 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/kazimovzaman2/Go-jwt-gorm/config"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+)
+
+// HashPassword hashes password with the algorithm and parameters in cfg.
+// Argon2id hashes use the PHC string format, e.g.
+// "$argon2id$v=19$m=19456,t=2,p=1$<salt>$<hash>".
+func HashPassword(password string, cfg config.Config) (string, error) {
+	switch cfg.PasswordHashAlgorithm {
+	case config.PasswordHashArgon2id:
+		salt := make([]byte, argon2SaltLength)
+		if _, err := rand.Read(salt); err != nil {
+			return "", err
+		}
+		key := argon2.IDKey([]byte(password), salt, cfg.Argon2Iterations, cfg.Argon2Memory, cfg.Argon2Parallelism, argon2KeyLength)
+		return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+			argon2.Version, cfg.Argon2Memory, cfg.Argon2Iterations, cfg.Argon2Parallelism,
+			base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key),
+		), nil
+	case config.PasswordHashBcrypt:
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), cfg.BcryptCost)
+		return string(hash), err
+	default:
+		return "", fmt.Errorf("unknown password hash algorithm %q", cfg.PasswordHashAlgorithm)
+	}
+}
+
+// VerifyPassword checks password against a bcrypt or Argon2id hash. When it
+// matches, needsRehash reports whether the hash was made with another
+// algorithm or parameters than cfg asks for now.
+func VerifyPassword(password string, hash string, cfg config.Config) (ok bool, needsRehash bool) {
+	if strings.HasPrefix(hash, "$argon2id$") {
+		var version int
+		var memory, iterations uint32
+		var parallelism uint8
+		parts := strings.Split(hash, "$")
+		if len(parts) != 6 {
+			return false, false
+		}
+		if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+			return false, false
+		}
+		if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &iterations, &parallelism); err != nil {
+			return false, false
+		}
+		salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+		if err != nil {
+			return false, false
+		}
+		expected, err := base64.RawStdEncoding.DecodeString(parts[5])
+		if err != nil {
+			return false, false
+		}
+
+		key := argon2.IDKey([]byte(password), salt, iterations, memory, parallelism, uint32(len(expected)))
+		if subtle.ConstantTimeCompare(key, expected) != 1 {
+			return false, false
+		}
+		return true, cfg.PasswordHashAlgorithm != config.PasswordHashArgon2id ||
+			memory != cfg.Argon2Memory ||
+			iterations != cfg.Argon2Iterations ||
+			parallelism != cfg.Argon2Parallelism
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil {
+		return false, false
+	}
+	cost, err := bcrypt.Cost([]byte(hash))
+	return true, err != nil || cfg.PasswordHashAlgorithm != config.PasswordHashBcrypt || cost != cfg.BcryptCost
+}
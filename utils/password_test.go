@@ -0,0 +1,98 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/kazimovzaman2/Go-jwt-gorm/config"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// referenceArgon2id is "password" hashed by the Argon2 reference
+// implementation with the salt "somesalt".
+const referenceArgon2id = "$argon2id$v=19$m=65536,t=2,p=1$c29tZXNhbHQ$CTFhFdXPJO1aFaMaO6Mm5c8y7cJHAph8ArZWb2GRPPc"
+
+// Cheap parameters, so the tests run fast.
+var (
+	argon2Config = config.Config{
+		PasswordHashAlgorithm: config.PasswordHashArgon2id,
+		Argon2Memory:          1024,
+		Argon2Iterations:      1,
+		Argon2Parallelism:     1,
+		BcryptCost:            bcrypt.MinCost,
+	}
+	bcryptConfig = config.Config{
+		PasswordHashAlgorithm: config.PasswordHashBcrypt,
+		Argon2Memory:          1024,
+		Argon2Iterations:      1,
+		Argon2Parallelism:     1,
+		BcryptCost:            bcrypt.MinCost,
+	}
+)
+
+func hash(t *testing.T, password string, cfg config.Config) string {
+	t.Helper()
+
+	hash, err := HashPassword(password, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hash
+}
+
+func TestVerifyPassword(t *testing.T) {
+	strongerArgon2 := argon2Config
+	strongerArgon2.Argon2Memory = 2048
+	strongerBcrypt := bcryptConfig
+	strongerBcrypt.BcryptCost = bcrypt.MinCost + 1
+
+	argon2Hash := hash(t, "correct horse", argon2Config)
+	bcryptHash := hash(t, "correct horse", bcryptConfig)
+
+	tests := []struct {
+		name            string
+		password        string
+		hash            string
+		cfg             config.Config
+		wantOK          bool
+		wantNeedsRehash bool
+	}{
+		{"argon2id", "correct horse", argon2Hash, argon2Config, true, false},
+		{"argon2id wrong password", "wrong horse", argon2Hash, argon2Config, false, false},
+		{"argon2id other parameters", "correct horse", argon2Hash, strongerArgon2, true, true},
+		{"argon2id when bcrypt is configured", "correct horse", argon2Hash, bcryptConfig, true, true},
+		{"argon2id reference hash", "password", referenceArgon2id, argon2Config, true, true},
+		{"bcrypt", "correct horse", bcryptHash, bcryptConfig, true, false},
+		{"bcrypt wrong password", "wrong horse", bcryptHash, bcryptConfig, false, false},
+		{"bcrypt other cost", "correct horse", bcryptHash, strongerBcrypt, true, true},
+		{"bcrypt when argon2id is configured", "correct horse", bcryptHash, argon2Config, true, true},
+		{"argon2id unknown version", "password", "$argon2id$v=16$m=65536,t=2,p=1$c29tZXNhbHQ$CTFhFdXPJO1aFaMaO6Mm5c8y7cJHAph8ArZWb2GRPPc", argon2Config, false, false},
+		{"argon2id missing part", "password", "$argon2id$v=19$m=65536,t=2,p=1$CTFhFdXPJO1aFaMaO6Mm5c8y7cJHAph8ArZWb2GRPPc", argon2Config, false, false},
+		{"argon2id bad parameters", "password", "$argon2id$v=19$m=lots$c29tZXNhbHQ$CTFhFdXPJO1aFaMaO6Mm5c8y7cJHAph8ArZWb2GRPPc", argon2Config, false, false},
+		{"argon2id bad salt", "password", "$argon2id$v=19$m=65536,t=2,p=1$!!$CTFhFdXPJO1aFaMaO6Mm5c8y7cJHAph8ArZWb2GRPPc", argon2Config, false, false},
+		{"argon2i", "password", "$argon2i$v=19$m=65536,t=2,p=1$c29tZXNhbHQ$CTFhFdXPJO1aFaMaO6Mm5c8y7cJHAph8ArZWb2GRPPc", argon2Config, false, false},
+		{"empty hash", "", "", argon2Config, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, needsRehash := VerifyPassword(tt.password, tt.hash, tt.cfg)
+			if ok != tt.wantOK || needsRehash != tt.wantNeedsRehash {
+				t.Fatalf("VerifyPassword() = %v, %v, want %v, %v", ok, needsRehash, tt.wantOK, tt.wantNeedsRehash)
+			}
+		})
+	}
+}
+
+func TestHashPasswordSaltsEveryHash(t *testing.T) {
+	for _, cfg := range []config.Config{argon2Config, bcryptConfig} {
+		if hash(t, "correct horse", cfg) == hash(t, "correct horse", cfg) {
+			t.Fatalf("%s hashes of the same password are equal", cfg.PasswordHashAlgorithm)
+		}
+	}
+}
+
+func TestHashPasswordRejectsUnknownAlgorithm(t *testing.T) {
+	if _, err := HashPassword("correct horse", config.Config{PasswordHashAlgorithm: "md5"}); err == nil {
+		t.Fatal("HashPassword with an unknown algorithm succeeded")
+	}
+}
@@ -0,0 +1,17 @@
+package utils
+
+import "github.com/kazimovzaman2/Go-jwt-gorm/model"
+
+func RoleToResponse(role model.Role) model.RoleResponse {
+	response := model.RoleResponse{
+		Name:        role.Name,
+		Description: role.Description,
+		Permissions: make([]string, 0, len(role.Permissions)),
+	}
+
+	for _, permission := range role.Permissions {
+		response.Permissions = append(response.Permissions, permission.Name)
+	}
+
+	return response
+}
@@ -0,0 +1,14 @@
+package utils
+
+import "github.com/kazimovzaman2/Go-jwt-gorm/model"
+
+func SessionToResponse(session model.Session, currentSessionID string) model.SessionResponse {
+	return model.SessionResponse{
+		ID:         session.ID,
+		UserAgent:  session.UserAgent,
+		IP:         session.IP,
+		Current:    session.ID == currentSessionID,
+		CreatedAt:  session.CreatedAt.Format("2006-01-02 15:04:05"),
+		LastUsedAt: session.LastUsedAt.Format("2006-01-02 15:04:05"),
+	}
+}
@@ -1,41 +1,82 @@
 package utils
 
 import (
+	"errors"
+	"strconv"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 	"github.com/kazimovzaman2/Go-jwt-gorm/config"
 	"github.com/kazimovzaman2/Go-jwt-gorm/model"
+	"github.com/kazimovzaman2/Go-jwt-gorm/signing"
 )
 
-func GenerateAccessToken(user model.User) (string, error) {
-	config, _ := config.LoadConfig(".")
-	token := jwt.New(jwt.SigningMethodHS256)
+const (
+	AccessTokenTTL  = 15 * time.Minute
+	RefreshTokenTTL = 72 * time.Hour
+
+	// ChallengeTokenTTL is how long a user has to enter their second
+	// factor after the password was accepted.
+	ChallengeTokenTTL = 5 * time.Minute
+)
 
-	claims := token.Claims.(jwt.MapClaims)
-	claims["email"] = user.Email
-	claims["id"] = user.ID
-	claims["exp"] = time.Now().Add(time.Minute * 15).Unix()
+var ErrWrongTokenType = errors.New("wrong token type")
 
-	accessToken, err := token.SignedString([]byte(config.JwtAccessSecret))
-	if err != nil {
-		return "", err
+func newClaims(userID uint, tokenType string, id string, expiresAt time.Time) *model.TokenClaims {
+	return &model.TokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   strconv.FormatUint(uint64(userID), 10),
+			ID:        id,
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+		Type: tokenType,
 	}
-	return accessToken, nil
 }
 
-func GenerateRefreshToken(user model.User) (string, error) {
-	config, _ := config.LoadConfig(".")
-	token := jwt.New(jwt.SigningMethodHS256)
+func GenerateAccessToken(user model.User, sessionID string) (string, error) {
+	claims := newClaims(user.ID, model.TokenTypeAccess, uuid.NewString(), time.Now().Add(AccessTokenTTL))
+	claims.SessionID = sessionID
+	return signing.DefaultKeySet.Sign(claims)
+}
+
+// GenerateRefreshToken signs refreshToken, which must already be stored.
+func GenerateRefreshToken(user model.User, refreshToken model.RefreshToken) (string, error) {
+	claims := newClaims(user.ID, model.TokenTypeRefresh, refreshToken.ID, refreshToken.ExpiresAt)
+	claims.SessionID = refreshToken.SessionID
+	return signInternal(claims)
+}
 
-	claims := token.Claims.(jwt.MapClaims)
-	claims["email"] = user.Email
-	claims["id"] = user.ID
-	claims["exp"] = time.Now().Add(time.Hour * 72).Unix()
+// GenerateChallengeToken proves that user passed the password step of a
+// two-factor login. It has no session, so it is never accepted as an
+// access token.
+func GenerateChallengeToken(user model.User) (string, error) {
+	claims := newClaims(user.ID, model.TokenTypeChallenge, uuid.NewString(), time.Now().Add(ChallengeTokenTTL))
+	return signInternal(claims)
+}
 
-	accessToken, err := token.SignedString([]byte(config.JwtRefreshSecret))
+// ParseInternalToken verifies a refresh or challenge token and checks that
+// it has the expected type.
+func ParseInternalToken(tokenString string, tokenType string) (*model.TokenClaims, error) {
+	config, _ := config.LoadConfig(".")
+	claims := &model.TokenClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(config.JwtRefreshSecret), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	if claims.Type != tokenType {
+		return nil, ErrWrongTokenType
 	}
-	return accessToken, nil
+	return claims, nil
+}
+
+// signInternal signs tokens that only this service reads back, with the
+// refresh secret rather than the published access token keys.
+func signInternal(claims *model.TokenClaims) (string, error) {
+	config, _ := config.LoadConfig(".")
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(config.JwtRefreshSecret))
 }
@@ -0,0 +1,131 @@
+package utils
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/kazimovzaman2/Go-jwt-gorm/model"
+	"github.com/kazimovzaman2/Go-jwt-gorm/signing"
+)
+
+const testRefreshSecret = "test-refresh-secret"
+
+// setupTokens runs the test in a directory whose .env sets the refresh
+// secret, which is where config.LoadConfig looks, and signs access tokens
+// with a fresh key.
+func setupTokens(t *testing.T) {
+	t.Helper()
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, ".env"), []byte("JWT_REFRESH_SECRET="+testRefreshSecret+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keySet, err := signing.NewKeySet([]*signing.Key{{
+		ID:        "test",
+		Algorithm: signing.AlgorithmEdDSA,
+		Private:   private,
+		Public:    public,
+	}}, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := signing.DefaultKeySet
+	signing.DefaultKeySet = keySet
+	t.Cleanup(func() { signing.DefaultKeySet = previous })
+}
+
+// signWith signs claims like signInternal, but with any method and key.
+func signWith(t *testing.T, method jwt.SigningMethod, key interface{}, claims *model.TokenClaims) string {
+	t.Helper()
+
+	signed, err := jwt.NewWithClaims(method, claims).SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestParseInternalToken(t *testing.T) {
+	setupTokens(t)
+
+	user := model.User{}
+	user.ID = 7
+	refreshToken, err := GenerateRefreshToken(user, model.RefreshToken{
+		ID:        "refresh-id",
+		SessionID: "session-id",
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	challengeToken, err := GenerateChallengeToken(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accessToken, err := GenerateAccessToken(user, "session-id")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	secret := []byte(testRefreshSecret)
+	expired := newClaims(user.ID, model.TokenTypeRefresh, "refresh-id", time.Now().Add(-time.Minute))
+	typedAccess := newClaims(user.ID, model.TokenTypeAccess, "access-id", time.Now().Add(time.Minute))
+	untyped := newClaims(user.ID, "", "refresh-id", time.Now().Add(time.Minute))
+	refresh := newClaims(user.ID, model.TokenTypeRefresh, "refresh-id", time.Now().Add(time.Minute))
+
+	tests := []struct {
+		name      string
+		token     string
+		tokenType string
+		wantErr   error
+	}{
+		{"refresh token", refreshToken, model.TokenTypeRefresh, nil},
+		{"challenge token", challengeToken, model.TokenTypeChallenge, nil},
+		{"refresh token as a challenge", refreshToken, model.TokenTypeChallenge, ErrWrongTokenType},
+		{"challenge token as a refresh token", challengeToken, model.TokenTypeRefresh, ErrWrongTokenType},
+		{"access token as a refresh token", accessToken, model.TokenTypeRefresh, jwt.ErrTokenSignatureInvalid},
+		{"access typed token with the refresh secret", signWith(t, jwt.SigningMethodHS256, secret, typedAccess), model.TokenTypeRefresh, ErrWrongTokenType},
+		{"token without a type", signWith(t, jwt.SigningMethodHS256, secret, untyped), model.TokenTypeRefresh, ErrWrongTokenType},
+		{"other secret", signWith(t, jwt.SigningMethodHS256, []byte("other secret"), refresh), model.TokenTypeRefresh, jwt.ErrTokenSignatureInvalid},
+		{"other HMAC method", signWith(t, jwt.SigningMethodHS512, secret, refresh), model.TokenTypeRefresh, jwt.ErrTokenSignatureInvalid},
+		{"alg none", signWith(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, refresh), model.TokenTypeRefresh, jwt.ErrTokenSignatureInvalid},
+		{"expired", signWith(t, jwt.SigningMethodHS256, secret, expired), model.TokenTypeRefresh, jwt.ErrTokenExpired},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := ParseInternalToken(tt.token, tt.tokenType)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("ParseInternalToken returned %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseInternalToken failed: %s", err)
+			}
+			if claims.Subject != "7" || claims.Type != tt.tokenType {
+				t.Fatalf("claims are for user %s with type %q, want 7 and %q", claims.Subject, claims.Type, tt.tokenType)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/base64"
+	"image/png"
+	"strings"
+	"time"
+
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+)
+
+const (
+	totpIssuer = "App"
+	totpPeriod = 30
+
+	RecoveryCodeCount = 10
+)
+
+// GenerateTOTPKey returns a new TOTP secret for accountName along with its
+// otpauth URI and a QR code PNG of the URI as a data URL.
+func GenerateTOTPKey(accountName string) (string, string, string, error) {
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      totpIssuer,
+		AccountName: accountName,
+		Period:      totpPeriod,
+	})
+	if err != nil {
+		return "", "", "", err
+	}
+
+	image, err := key.Image(256, 256)
+	if err != nil {
+		return "", "", "", err
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image); err != nil {
+		return "", "", "", err
+	}
+	qrCode := "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes())
+
+	return key.Secret(), key.URL(), qrCode, nil
+}
+
+// ValidateTOTP checks code against secret, allowing one period of clock
+// drift either way. Codes from periods up to lastCounter were already used
+// and are refused, so a code can't be replayed. On success it returns the
+// counter to remember as the new lastCounter.
+func ValidateTOTP(secret string, code string, lastCounter int64) (int64, bool) {
+	now := time.Now()
+	for _, skew := range []int64{-1, 0, 1} {
+		at := now.Add(time.Duration(skew*totpPeriod) * time.Second)
+		counter := at.Unix() / totpPeriod
+		if counter <= lastCounter {
+			continue
+		}
+
+		expected, err := totp.GenerateCodeCustom(secret, at, totp.ValidateOpts{
+			Period:    totpPeriod,
+			Digits:    otp.DigitsSix,
+			Algorithm: otp.AlgorithmSHA1,
+		})
+		if err == nil && expected == strings.TrimSpace(code) {
+			return counter, true
+		}
+	}
+	return lastCounter, false
+}
+
+// GenerateRecoveryCodes returns RecoveryCodeCount one-time codes such as
+// "k3f9a-2mxq7" and the hashes to store for them.
+func GenerateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, RecoveryCodeCount)
+	hashes := make([]string, 0, RecoveryCodeCount)
+	for i := 0; i < RecoveryCodeCount; i++ {
+		b := make([]byte, 7)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		raw := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b))[:10]
+		code := raw[:5] + "-" + raw[5:]
+		codes = append(codes, code)
+		hashes = append(hashes, HashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+// HashRecoveryCode hashes code ignoring case, spaces and dashes, so users
+// can type it either way.
+func HashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	return HashOpaqueToken(normalized)
+}
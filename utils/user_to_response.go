@@ -3,13 +3,21 @@ package utils
 import "github.com/kazimovzaman2/Go-jwt-gorm/model"
 
 func UserToResponse(user model.User) model.UserResponse {
-	return model.UserResponse{
+	response := model.UserResponse{
 		ID:           user.ID,
 		Email:        user.Email,
 		FirstName:    user.FirstName,
 		LastName:     user.LastName,
 		ProfileImage: user.ProfileImage,
+		HideLastSeen: user.HideLastSeen,
 		CreatedAt:    user.CreatedAt.Format("2006-01-02 15:04:05"),
 		UpdatedAt:    user.UpdatedAt.Format("2006-01-02 15:04:05"),
 	}
+
+	if user.LastSeenAt != nil && !user.HideLastSeen {
+		lastSeenAt := user.LastSeenAt.Format("2006-01-02 15:04:05")
+		response.LastSeenAt = &lastSeenAt
+	}
+
+	return response
 }
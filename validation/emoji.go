@@ -0,0 +1,136 @@
+package validation
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/rivo/uniseg"
+)
+
+const (
+	zeroWidthJoiner     = 0x200D
+	textPresentation    = 0xFE0E
+	emojiPresentation   = 0xFE0F
+	combiningKeycap     = 0x20E3
+	blackFlag           = 0x1F3F4
+	cancelTag           = 0xE007F
+	firstTag, lastTag   = 0xE0020, 0xE007E
+	firstRegional       = 0x1F1E6
+	lastRegional        = 0x1F1FF
+	firstModifier       = 0x1F3FB
+	lastModifier        = 0x1F3FF
+	keycapBases         = "0123456789#*"
+	maxEmojiSequenceLen = 16
+)
+
+// pictographs holds the code points emoji are drawn from: the symbol
+// blocks with emoji in them and the pictographic planes, leaving out
+// regional indicators and skin tone modifiers, which only count as part of
+// a flag or after another emoji.
+var pictographs = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{Lo: 0x00A9, Hi: 0x00A9, Stride: 1},
+		{Lo: 0x00AE, Hi: 0x00AE, Stride: 1},
+		{Lo: 0x203C, Hi: 0x203C, Stride: 1},
+		{Lo: 0x2049, Hi: 0x2049, Stride: 1},
+		{Lo: 0x2122, Hi: 0x2122, Stride: 1},
+		{Lo: 0x2139, Hi: 0x2139, Stride: 1},
+		{Lo: 0x2194, Hi: 0x2199, Stride: 1},
+		{Lo: 0x21A9, Hi: 0x21AA, Stride: 1},
+		{Lo: 0x231A, Hi: 0x231B, Stride: 1},
+		{Lo: 0x2328, Hi: 0x2328, Stride: 1},
+		{Lo: 0x23CF, Hi: 0x23CF, Stride: 1},
+		{Lo: 0x23E9, Hi: 0x23F3, Stride: 1},
+		{Lo: 0x23F8, Hi: 0x23FA, Stride: 1},
+		{Lo: 0x24C2, Hi: 0x24C2, Stride: 1},
+		{Lo: 0x25AA, Hi: 0x25AB, Stride: 1},
+		{Lo: 0x25B6, Hi: 0x25B6, Stride: 1},
+		{Lo: 0x25C0, Hi: 0x25C0, Stride: 1},
+		{Lo: 0x25FB, Hi: 0x25FE, Stride: 1},
+		{Lo: 0x2600, Hi: 0x27BF, Stride: 1},
+		{Lo: 0x2934, Hi: 0x2935, Stride: 1},
+		{Lo: 0x2B05, Hi: 0x2B07, Stride: 1},
+		{Lo: 0x2B1B, Hi: 0x2B1C, Stride: 1},
+		{Lo: 0x2B50, Hi: 0x2B50, Stride: 1},
+		{Lo: 0x2B55, Hi: 0x2B55, Stride: 1},
+		{Lo: 0x3030, Hi: 0x3030, Stride: 1},
+		{Lo: 0x303D, Hi: 0x303D, Stride: 1},
+		{Lo: 0x3297, Hi: 0x3297, Stride: 1},
+		{Lo: 0x3299, Hi: 0x3299, Stride: 1},
+	},
+	R32: []unicode.Range32{
+		{Lo: 0x1F000, Hi: 0x1F1E5, Stride: 1},
+		{Lo: 0x1F200, Hi: 0x1F3FA, Stride: 1},
+		{Lo: 0x1F400, Hi: 0x1FAFF, Stride: 1},
+	},
+	LatinOffset: 2,
+}
+
+func init() {
+	validate.RegisterValidation("emoji", func(fl validator.FieldLevel) bool {
+		return IsEmoji(fl.Field().String())
+	})
+}
+
+// IsEmoji reports whether s is exactly one emoji: a pictograph with an
+// optional skin tone and presentation selector, several of them joined
+// with zero width joiners, a flag, or a keycap.
+func IsEmoji(s string) bool {
+	if uniseg.GraphemeClusterCount(s) != 1 {
+		return false
+	}
+	runes := []rune(s)
+	if len(runes) > maxEmojiSequenceLen {
+		return false
+	}
+
+	switch {
+	case len(runes) == 2 && isRegional(runes[0]) && isRegional(runes[1]):
+		return true
+	case len(runes) >= 2 && runes[len(runes)-1] == combiningKeycap:
+		base := runes[:len(runes)-1]
+		if len(base) == 2 && base[1] == emojiPresentation {
+			base = base[:1]
+		}
+		return len(base) == 1 && strings.ContainsRune(keycapBases, base[0])
+	}
+
+	i := 0
+	for {
+		if i >= len(runes) || !unicode.Is(pictographs, runes[i]) {
+			return false
+		}
+		base := runes[i]
+		i++
+
+		// Subdivision flags are the black flag followed by tag letters.
+		if base == blackFlag && i < len(runes) && runes[i] >= firstTag && runes[i] <= lastTag {
+			for i < len(runes) && runes[i] >= firstTag && runes[i] <= lastTag {
+				i++
+			}
+			if i >= len(runes) || runes[i] != cancelTag {
+				return false
+			}
+			i++
+		}
+		if i < len(runes) && runes[i] >= firstModifier && runes[i] <= lastModifier {
+			i++
+		}
+		if i < len(runes) && (runes[i] == emojiPresentation || runes[i] == textPresentation) {
+			i++
+		}
+
+		if i == len(runes) {
+			return true
+		}
+		if runes[i] != zeroWidthJoiner {
+			return false
+		}
+		i++
+	}
+}
+
+func isRegional(r rune) bool {
+	return r >= firstRegional && r <= lastRegional
+}
@@ -0,0 +1,69 @@
+package validation
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kazimovzaman2/Go-jwt-gorm/model"
+)
+
+func TestIsEmoji(t *testing.T) {
+	tests := []struct {
+		name  string
+		emoji string
+		want  bool
+	}{
+		{"pictograph", "😀", true},
+		{"symbol", "❤", true},
+		{"emoji presentation", "❤\uFE0F", true},
+		{"text presentation", "❤\uFE0E", true},
+		{"skin tone", "👍🏽", true},
+		{"zwj sequence", "👨\u200D👩\u200D👧\u200D👦", true},
+		{"zwj sequence with skin tones", "🧑🏽\u200D🤝\u200D🧑🏿", true},
+		{"zwj sequence with presentation selectors", "🏳\uFE0F\u200D🌈", true},
+		{"gendered with skin tone", "🏌🏽\u200D♀\uFE0F", true},
+		{"flag", "🇦🇿", true},
+		{"subdivision flag", "🏴\U000E0067\U000E0062\U000E0073\U000E0063\U000E0074\U000E007F", true},
+		{"keycap", "#\uFE0F\u20E3", true},
+		{"keycap without selector", "1\u20E3", true},
+		{"copyright sign", "©\uFE0F", true},
+		{"empty", "", false},
+		{"word", "lol", false},
+		{"letter", "a", false},
+		{"digit", "1", false},
+		{"html", "<b>", false},
+		{"two emoji", "😀😀", false},
+		{"emoji and text", "😀 lol", false},
+		{"text and emoji", "lol😀", false},
+		{"lone regional indicator", "🇦", false},
+		{"three regional indicators", "🇦🇿🇦", false},
+		{"lone skin tone", "🏽", false},
+		{"trailing joiner", "👨\u200D", false},
+		{"leading joiner", "\u200D👨", false},
+		{"joined letter", "👨\u200Da", false},
+		{"combining mark", "😀\u0301", false},
+		{"keycap on a letter", "a\u20E3", false},
+		{"unterminated tag sequence", "🏴\U000E0067\U000E0062", false},
+		{"lone variation selector", "\uFE0F", false},
+		{"cjk", "笑", false},
+		{"too long", strings.Repeat("👨\u200D", 16) + "👨", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsEmoji(tt.emoji); got != tt.want {
+				t.Fatalf("IsEmoji(%q) = %v, want %v", tt.emoji, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateReactionInput(t *testing.T) {
+	if errs := ValidateStruct(&model.ReactionInput{Emoji: "🎉"}); len(errs) != 0 {
+		t.Fatalf("ValidateStruct returned %d errors for an emoji", len(errs))
+	}
+	errs := ValidateStruct(&model.ReactionInput{Emoji: "lol"})
+	if len(errs) != 1 || errs[0].Message != "Emoji must be a single emoji" {
+		t.Fatalf("ValidateStruct of text returned %v, want one emoji error", errs)
+	}
+}
@@ -0,0 +1,43 @@
+package validation
+
+import (
+	"github.com/go-playground/validator/v10"
+	"github.com/kazimovzaman2/Go-jwt-gorm/model"
+)
+
+var validate = validator.New()
+
+func ValidateStruct(s interface{}) []*model.ErrorResponse {
+	var errors []*model.ErrorResponse
+
+	errs := validate.Struct(s)
+	if errs != nil {
+		for _, err := range errs.(validator.ValidationErrors) {
+			field := err.Field()
+			var message string
+			switch err.Tag() {
+			case "required":
+				message = field + " is required"
+			case "email":
+				message = field + " must be a valid email address"
+			case "gte", "min":
+				message = field + " must be at least " + err.Param()
+			case "lte", "max":
+				message = field + " must be at most " + err.Param()
+			case "oneof":
+				message = field + " must be one of: " + err.Param()
+			case "emoji":
+				message = field + " must be a single emoji"
+			default:
+				message = "Validation error on field: " + field
+			}
+			errors = append(errors, &model.ErrorResponse{
+				Status:  "error",
+				Message: message,
+				Errors:  err.Error(),
+			})
+		}
+	}
+
+	return errors
+}